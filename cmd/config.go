@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/config"
+)
+
+// parseFlags parses the command line and applies the values of the --config
+// file to every flag that was neither given on the command line nor set via
+// its environment variable. It exits on errors like flag.Parse.
+func parseFlags(args []string) {
+	// flag.CommandLine exits on parse errors.
+	_ = flag.CommandLine.Parse(args)
+	if *configFile == "" {
+		return
+	}
+
+	file, err := config.Load(*configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for _, f := range file.Flags() {
+		if set[f.Name] || os.Getenv(envName(f.Name)) != "" {
+			continue
+		}
+		if err := flag.Set(f.Name, f.Value); err != nil {
+			fmt.Fprintf(os.Stderr, "%v: invalid value %q for %v: %v\n", *configFile, f.Value, f.Name, err)
+			os.Exit(2)
+		}
+	}
+}
+
+// envName returns the environment variable of a flag.
+func envName(name string) string {
+	return "STUB_SERVER_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// setupLogging configures the default logger.
+func setupLogging(level string, format string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
+	switch format {
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, opts)))
+	default:
+		return fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/openapi"
+)
+
+// generate reads the --openapi document and writes a JSON stub for every
+// operation and response status into the first --http directory.
+func generate(w io.Writer) error {
+	slog.SetDefault(slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	if *openAPI == "" {
+		return errors.New("--openapi is required")
+	}
+	stubDir, _ := stubDirs(*httpStubDir)
+	if stubDir == "" {
+		return errors.New("--http is required")
+	}
+
+	doc, err := openapi.Load(*openAPI)
+	if err != nil {
+		return err
+	}
+	stubs, genErr := doc.Stubs()
+
+	written, err := openapi.WriteStubs(stubDir, stubs)
+	for _, path := range written {
+		fmt.Fprintln(w, "wrote", path)
+	}
+	return errors.Join(genErr, err)
+}
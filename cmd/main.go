@@ -3,19 +3,18 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
-	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
-	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
+	"time"
 
 	_ "cloud.google.com/go/longrunning/autogen/longrunningpb"
 	"github.com/randomenterprisesolutions/stub-server/internal/handler"
-	"golang.org/x/sync/errgroup"
+	"github.com/randomenterprisesolutions/stub-server/internal/openapi"
 	_ "google.golang.org/protobuf/types/known/anypb"
 	_ "google.golang.org/protobuf/types/known/durationpb"
 	_ "google.golang.org/protobuf/types/known/emptypb"
@@ -23,71 +22,136 @@ import (
 )
 
 var (
-	address      = flag.String("address", envOrDefault("STUB_SERVER_ADDRESS", ":50051"), "Port to listen on")
-	protoDir     = flag.String("proto", envOrDefault("STUB_SERVER_PROTO", ""), "Path to proto files")
-	protoStubDir = flag.String("stubs", envOrDefault("STUB_SERVER_STUBS", ""), "Path to gRPC stubs")
-	httpStubDir  = flag.String("http", envOrDefault("STUB_SERVER_HTTP", ""), "Path to HTTP stubs")
-	tlsCert      = flag.String("cert", envOrDefault("STUB_SERVER_CERT", ""), "Path to TLS certificate")
-	tlsCertKey   = flag.String("key", envOrDefault("STUB_SERVER_KEY", ""), "Path to TLS certificate key")
+	address        = flag.String("address", envOrDefault("STUB_SERVER_ADDRESS", ":50051"), "Port to listen on")
+	protoDir       = flag.String("proto", envOrDefault("STUB_SERVER_PROTO", ""), "Comma-separated list of proto import paths")
+	protoFiles     = flag.String("proto-files", envOrDefault("STUB_SERVER_PROTO_FILES", ""), "Comma-separated list of proto entry files to load instead of all files of the first import path")
+	protoSets      = flag.String("protoset", envOrDefault("STUB_SERVER_PROTOSET", ""), "Comma-separated list of FileDescriptorSet files")
+	protoStubDir   = flag.String("stubs", envOrDefault("STUB_SERVER_STUBS", ""), "Comma-separated list of gRPC stub directories; recorded and scaffolded stubs go to the first")
+	proxyGRPC      = flag.String("proxy-grpc", envOrDefault("STUB_SERVER_PROXY_GRPC", ""), "Upstream gRPC address to forward calls without stubs to and record as stubs")
+	httpStubDir    = flag.String("http", envOrDefault("STUB_SERVER_HTTP", ""), "Comma-separated list of HTTP stub directories; recorded and generated stubs go to the first")
+	httpVHosts     = flag.Bool("http-vhosts", envBoolOrDefault("STUB_SERVER_HTTP_VHOSTS", false), "Serve a separate HTTP stub set per host directory of --http")
+	openAPI        = flag.String("openapi", envOrDefault("STUB_SERVER_OPENAPI", ""), "Path to an OpenAPI 3 document to derive HTTP stubs from")
+	openAPIMode    = flag.String("openapi-validation", envOrDefault("STUB_SERVER_OPENAPI_VALIDATION", "enforce"), "Validation of HTTP requests and responses against the OpenAPI document: off, warn or enforce")
+	proxyHTTP      = flag.String("proxy-http", envOrDefault("STUB_SERVER_PROXY_HTTP", ""), "Upstream URL to forward unmatched HTTP requests to and record as stubs")
+	proxyConfig    = flag.String("proxy-config", envOrDefault("STUB_SERVER_PROXY_CONFIG", ""), "Path to a JSON file with upstreams to proxy requests without stubs to")
+	tlsCert        = flag.String("cert", envOrDefault("STUB_SERVER_CERT", ""), "Path to TLS certificate")
+	tlsCertKey     = flag.String("key", envOrDefault("STUB_SERVER_KEY", ""), "Path to TLS certificate key")
+	tlsClientCA    = flag.String("client-ca", envOrDefault("STUB_SERVER_CLIENT_CA", ""), "Path to a PEM bundle of CAs to verify client certificates with")
+	autoTLS        = flag.String("auto-tls", envOrDefault("STUB_SERVER_AUTO_TLS", ""), "Serve TLS with a generated certificate and write its CA certificate to this path")
+	listen         = listVar("listen", strings.Fields(envOrDefault("STUB_SERVER_LISTEN", "")), "Listener as <protocols>=<address>[;<option>...], may be repeated; replaces --address")
+	grpcFake       = flag.Bool("grpc-fake", envBoolOrDefault("STUB_SERVER_GRPC_FAKE", false), "Generate fake responses for gRPC methods without stubs")
+	grpcFakeSeed   = flag.Int64("grpc-fake-seed", envInt64OrDefault("STUB_SERVER_GRPC_FAKE_SEED", 1), "Seed for generated fake gRPC responses")
+	grpcValidate   = flag.Bool("grpc-validate", envBoolOrDefault("STUB_SERVER_GRPC_VALIDATE", false), "Reject gRPC requests violating buf.validate constraints")
 	grpcReflection = flag.Bool("grpc-reflection", envBoolOrDefault("STUB_SERVER_GRPC_REFLECTION", true), "Enable gRPC reflection")
+	latency        = flag.Duration("latency", envDurationOrDefault("STUB_SERVER_LATENCY", 0), "Delay every HTTP and gRPC response by this duration")
+	logLevel       = flag.String("log-level", envOrDefault("STUB_SERVER_LOG_LEVEL", "info"), "Log level: debug, info, warn or error")
+	logFormat      = flag.String("log-format", envOrDefault("STUB_SERVER_LOG_FORMAT", "text"), "Log format: text or json")
+	configFile     = flag.String("config", envOrDefault("STUB_SERVER_CONFIG", ""), "Path to a YAML configuration file; flags and environment variables override its values")
 )
 
 func main() {
-	flag.Parse()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			parseFlags(os.Args[2:])
+			os.Exit(validate(os.Stderr))
+		case "scaffold":
+			parseFlags(os.Args[2:])
+			if err := scaffold(os.Stderr); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		case "generate":
+			parseFlags(os.Args[2:])
+			if err := generate(os.Stderr); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	parseFlags(os.Args[1:])
+
+	if err := setupLogging(*logLevel, *logFormat); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
 	ctx := context.Background()
 	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
 	defer cancel()
 
-	handler, err := handler.NewWithOptions(*httpStubDir, *protoDir, *protoStubDir, handler.Options{
+	var proxy handler.ProxyConfig
+	if *proxyConfig != "" {
+		var err error
+		if proxy, err = handler.LoadProxyConfig(*proxyConfig); err != nil {
+			slog.ErrorContext(ctx, "Failed to load proxy config", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+	}
+
+	validation, err := openapi.ParseValidationMode(*openAPIMode)
+	if err != nil {
+		slog.ErrorContext(ctx, "Invalid OpenAPI validation mode", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	httpDir, httpDirs := stubDirs(*httpStubDir)
+	protoStubs, protoStubDirs := stubDirs(*protoStubDir)
+	srv, err := handler.NewServer(httpDir, "", protoStubs, handler.Options{
 		EnableGRPCReflection: *grpcReflection,
+		ProtoDescriptorSets:  splitList(*protoSets),
+		ProtoImportPaths:     splitList(*protoDir),
+		ProtoFiles:           splitList(*protoFiles),
+		FakeGRPCResponses:    *grpcFake,
+		FakeSeed:             *grpcFakeSeed,
+		ValidateGRPCRequests: *grpcValidate,
+		HTTPStubDirs:         httpDirs,
+		GRPCStubDirs:         protoStubDirs,
+		HTTPVirtualHosts:     *httpVHosts,
+		OpenAPI:              *openAPI,
+		OpenAPIValidation:    validation,
+		Proxy:                proxy,
+		RecordGRPCUpstream:   *proxyGRPC,
+		RecordHTTPUpstream:   *proxyHTTP,
+		Latency:              *latency,
 	})
 	if err != nil {
 		slog.ErrorContext(ctx, "Failed to create handler", slog.String("error", err.Error()))
 		os.Exit(1)
 	}
 
-	tls, err := loadTLS(*tlsCert, *tlsCertKey)
+	servers, err := newServers(srv)
 	if err != nil {
-		slog.ErrorContext(ctx, "Failed to load TLS config", slog.String("error", err.Error()))
-	}
-
-	srv := &http.Server{
-		Addr:      *address,
-		Handler:   handler,
-		TLSConfig: tls,
+		slog.ErrorContext(ctx, "Failed to configure listeners", slog.String("error", err.Error()))
+		os.Exit(1)
 	}
 
-	eg := new(errgroup.Group)
-	eg.Go(func() error {
-		slog.Info("Listening", slog.String("address", srv.Addr))
-		return srv.ListenAndServe()
-	})
-
-	eg.Go(func() error {
-		<-ctx.Done()
-		slog.Info("Shutting down server")
-		return srv.Shutdown(context.Background())
-	})
-
-	err = eg.Wait()
-	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+	if err := serve(ctx, servers); err != nil {
 		slog.ErrorContext(ctx, "Server stopped", slog.String("error", err.Error()))
+		os.Exit(1)
 	}
 }
 
-func loadTLS(certFile string, keyFile string) (*tls.Config, error) {
-	if certFile == "" || keyFile == "" {
-		return nil, nil
+func splitList(value string) []string {
+	var out []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
 	}
+	return out
+}
 
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-	if err != nil {
-		return nil, fmt.Errorf("load cert: %w", err)
+// stubDirs splits a list of stub directories into the first one, which
+// recorded stubs are written to, and the others.
+func stubDirs(value string) (string, []string) {
+	dirs := splitList(value)
+	if len(dirs) == 0 {
+		return "", nil
 	}
-	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
-
-	return cfg, nil
+	return dirs[0], dirs[1:]
 }
 
 func envOrDefault(key, fallback string) string {
@@ -106,3 +170,23 @@ func envBoolOrDefault(key string, fallback bool) bool {
 	}
 	return fallback
 }
+
+func envInt64OrDefault(key string, fallback int64) int64 {
+	if value := os.Getenv(key); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err == nil {
+			return parsed
+		}
+	}
+	return fallback
+}
+
+func envDurationOrDefault(key string, fallback time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err == nil {
+			return parsed
+		}
+	}
+	return fallback
+}
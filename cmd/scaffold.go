@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/grpcstub"
+)
+
+// scaffold loads the configured protos and writes a skeleton stub for every
+// method without a stub file into the first --stubs directory.
+func scaffold(w io.Writer) error {
+	slog.SetDefault(slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	stubDir, _ := stubDirs(*protoStubDir)
+	if stubDir == "" {
+		return errors.New("--stubs is required")
+	}
+
+	service, err := grpcstub.NewService("", "", grpcstub.ServerOptions{
+		DescriptorSets: splitList(*protoSets),
+		ImportPaths:    splitList(*protoDir),
+		ProtoFiles:     splitList(*protoFiles),
+	})
+	if err != nil {
+		return fmt.Errorf("load protos: %w", err)
+	}
+
+	written, err := service.Scaffold(stubDir)
+	for _, path := range written {
+		fmt.Fprintln(w, "wrote", path)
+	}
+	return err
+}
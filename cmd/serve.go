@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/certs"
+	"github.com/randomenterprisesolutions/stub-server/internal/handler"
+	"golang.org/x/sync/errgroup"
+)
+
+// listener is an opened listener together with the server serving it.
+type listener struct {
+	def    handler.Listener
+	ln     net.Listener
+	server *http.Server
+}
+
+// newServers opens the listeners given by --listen, or a single listener on
+// --address serving HTTP and gRPC. The TLS flags apply to all listeners not
+// opting out with no-tls. Listeners sharing TLS settings share one
+// certificate, so a generated CA is only written once.
+func newServers(srv *handler.Server) ([]listener, error) {
+	defaults := certs.Options{
+		CertFile:     *tlsCert,
+		KeyFile:      *tlsCertKey,
+		ClientCAFile: *tlsClientCA,
+		AutoCAFile:   *autoTLS,
+	}
+
+	specs := listen.values
+	if len(specs) == 0 {
+		specs = []string{"http,grpc=" + *address}
+	}
+
+	var defs []handler.Listener
+	hosts := map[string][]string{}
+	for _, spec := range specs {
+		def, err := handler.ParseListener(spec, defaults)
+		if err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+		hosts[tlsKey(def.TLSOptions)] = append(hosts[tlsKey(def.TLSOptions)], def.TLSOptions.Hosts...)
+	}
+
+	configs := map[string]*tls.Config{}
+	metrics := handler.NewMetrics()
+	var listeners []listener
+	for _, def := range defs {
+		var cfg *tls.Config
+		if def.TLS {
+			key := tlsKey(def.TLSOptions)
+			if configs[key] == nil {
+				opts := def.TLSOptions
+				opts.Hosts = hosts[key]
+				c, err := certs.ServerConfig(opts)
+				if err != nil {
+					closeAll(listeners)
+					return nil, err
+				}
+				if opts.AutoCAFile != "" {
+					slog.Info("Generated TLS certificate", slog.String("ca", opts.AutoCAFile))
+				}
+				configs[key] = c
+			}
+			cfg = configs[key]
+		}
+
+		ln, err := def.Listen()
+		if err != nil {
+			closeAll(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, listener{def: def, ln: ln, server: newServer(srv, def, cfg, metrics)})
+	}
+
+	return listeners, nil
+}
+
+// newServer creates the HTTP server of a listener. Without TLS, listeners
+// serving only gRPC accept HTTP/2 with prior knowledge only, others HTTP/1.1
+// and h2c.
+func newServer(srv *handler.Server, def handler.Listener, cfg *tls.Config, metrics *handler.Metrics) *http.Server {
+	h := metrics.Instrument(def.String(), srv.Handler(def.Protocols, metrics))
+
+	protocols := new(http.Protocols)
+	switch {
+	case def.Protocols == handler.ProtocolGRPC && cfg != nil:
+		protocols.SetHTTP2(true)
+	case def.Protocols == handler.ProtocolGRPC:
+		protocols.SetUnencryptedHTTP2(true)
+	case cfg != nil:
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+	default:
+		protocols.SetHTTP1(true)
+		h = handler.AllowH2c(h)
+	}
+
+	return &http.Server{Handler: h, TLSConfig: cfg, Protocols: protocols}
+}
+
+// serve serves all listeners until ctx is done or one of them fails, then
+// shuts all of them down.
+func serve(ctx context.Context, listeners []listener) error {
+	eg, egCtx := errgroup.WithContext(ctx)
+	for _, l := range listeners {
+		eg.Go(func() error {
+			slog.Info("Listening",
+				slog.String("address", l.def.String()),
+				slog.String("protocols", l.def.Protocols.String()),
+				slog.Bool("tls", l.server.TLSConfig != nil))
+
+			var err error
+			if l.server.TLSConfig != nil {
+				err = l.server.ServeTLS(l.ln, "", "")
+			} else {
+				err = l.server.Serve(l.ln)
+			}
+			if errors.Is(err, http.ErrServerClosed) {
+				return nil
+			}
+			return err
+		})
+	}
+
+	eg.Go(func() error {
+		<-egCtx.Done()
+		slog.Info("Shutting down server")
+		var errs []error
+		for _, l := range listeners {
+			errs = append(errs, l.server.Shutdown(context.Background()))
+		}
+		return errors.Join(errs...)
+	})
+
+	return eg.Wait()
+}
+
+func closeAll(listeners []listener) {
+	for _, l := range listeners {
+		_ = l.ln.Close()
+	}
+}
+
+// tlsKey identifies listeners sharing a certificate.
+func tlsKey(opts certs.Options) string {
+	return strings.Join([]string{opts.CertFile, opts.KeyFile, opts.ClientCAFile, opts.AutoCAFile}, "\x00")
+}
+
+// listFlag is a flag that may be given several times. Values given on the
+// command line replace the defaults.
+type listFlag struct {
+	values []string
+	set    bool
+}
+
+func listVar(name string, defaults []string, usage string) *listFlag {
+	f := &listFlag{values: defaults}
+	flag.Var(f, name, usage)
+	return f
+}
+
+func (f *listFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return strings.Join(f.values, " ")
+}
+
+func (f *listFlag) Set(value string) error {
+	if !f.set {
+		f.values = nil
+		f.set = true
+	}
+	f.values = append(f.values, value)
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/diag"
+	"github.com/randomenterprisesolutions/stub-server/internal/grpcstub"
+	"github.com/randomenterprisesolutions/stub-server/internal/httpstub"
+)
+
+// validate loads the configured stub and proto directories the way the server
+// does, prints every problem found to w and returns the process exit code.
+func validate(w io.Writer) int {
+	// Only warnings and errors are of interest, not the registered methods.
+	slog.SetDefault(slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	var problems []error
+	for _, dir := range splitList(*httpStubDir) {
+		if *httpVHosts {
+			problems = append(problems, diag.Flatten(httpstub.ValidateVirtualHosts(dir))...)
+		} else {
+			problems = append(problems, diag.Flatten(httpstub.Validate(dir))...)
+		}
+	}
+
+	importPaths := splitList(*protoDir)
+	descriptorSets := splitList(*protoSets)
+	protoStubs, protoStubDirs := stubDirs(*protoStubDir)
+	if len(importPaths) > 0 || len(descriptorSets) > 0 {
+		_, err := grpcstub.NewService("", protoStubs, grpcstub.ServerOptions{
+			StubDirs:       protoStubDirs,
+			DescriptorSets: descriptorSets,
+			ImportPaths:    importPaths,
+			ProtoFiles:     splitList(*protoFiles),
+		})
+		problems = append(problems, diag.Flatten(err)...)
+	}
+
+	for _, p := range problems {
+		fmt.Fprintln(w, p)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(w, "%d problem(s) found\n", len(problems))
+		return 1
+	}
+	return 0
+}
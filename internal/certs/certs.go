@@ -0,0 +1,95 @@
+// Package certs builds the TLS configuration of the stub server and matches
+// stubs against the certificates presented by clients.
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Options configures the server TLS settings.
+type Options struct {
+	// CertFile and KeyFile are the PEM encoded server certificate and key.
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is a PEM bundle of CAs client certificates must be signed
+	// by. Clients without a valid certificate are rejected if set.
+	ClientCAFile string
+	// AutoCAFile enables a generated certificate signed by an in-memory CA
+	// whose certificate is written to this path for clients to trust.
+	AutoCAFile string
+	// Hosts are added to the generated certificate in addition to localhost.
+	Hosts []string
+}
+
+// ServerConfig returns the TLS configuration for opts, or nil if TLS is not
+// configured. The configuration offers h2 via ALPN so gRPC works over TLS.
+func ServerConfig(opts Options) (*tls.Config, error) {
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return nil, errors.New("both a certificate and a key are required")
+	}
+	if opts.CertFile != "" && opts.AutoCAFile != "" {
+		return nil, errors.New("a certificate can't be combined with a generated one")
+	}
+
+	var cert tls.Certificate
+	switch {
+	case opts.CertFile != "":
+		var err error
+		cert, err = tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load cert: %w", err)
+		}
+	case opts.AutoCAFile != "":
+		var err error
+		cert, err = generate(opts.AutoCAFile, opts.Hosts)
+		if err != nil {
+			return nil, fmt.Errorf("generate cert: %w", err)
+		}
+	case opts.ClientCAFile != "":
+		return nil, errors.New("client certificate verification requires a server certificate")
+	default:
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if opts.ClientCAFile != "" {
+		pool, err := loadPool(opts.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+func loadPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("client CA %v contains no PEM certificates", path)
+	}
+	return pool, nil
+}
+
+// Peer returns the leaf certificate the client presented during the
+// handshake, or nil.
+func Peer(state *tls.ConnectionState) *x509.Certificate {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	return state.PeerCertificates[0]
+}
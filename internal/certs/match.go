@@ -0,0 +1,76 @@
+package certs
+
+import (
+	"crypto/x509"
+	"errors"
+)
+
+// Matcher restricts a stub to clients presenting a matching certificate.
+// Subject matches the common name or the full distinguished name in RFC 2253
+// form, e.g. "CN=alice,O=Acme". SAN matches any DNS name, email address, IP
+// address or URI of the certificate. Both must match if set.
+type Matcher struct {
+	Subject string `json:"subject,omitempty"`
+	SAN     string `json:"san,omitempty"`
+}
+
+// Validate checks that the matcher matches on something.
+func (m *Matcher) Validate() error {
+	if m.Subject == "" && m.SAN == "" {
+		return errors.New(`"subject" or "san" is required`)
+	}
+	return nil
+}
+
+// Matches reports whether cert satisfies the matcher. A nil matcher matches
+// every request, a missing certificate none.
+func (m *Matcher) Matches(cert *x509.Certificate) bool {
+	if m == nil {
+		return true
+	}
+	if cert == nil {
+		return false
+	}
+	if m.Subject != "" && m.Subject != cert.Subject.CommonName && m.Subject != cert.Subject.String() {
+		return false
+	}
+	if m.SAN != "" && !hasSAN(cert, m.SAN) {
+		return false
+	}
+	return true
+}
+
+// Covers reports whether every certificate matched by other is matched by m.
+func (m *Matcher) Covers(other *Matcher) bool {
+	if m == nil {
+		return true
+	}
+	if other == nil {
+		return false
+	}
+	return (m.Subject == "" || m.Subject == other.Subject) && (m.SAN == "" || m.SAN == other.SAN)
+}
+
+func hasSAN(cert *x509.Certificate, san string) bool {
+	for _, name := range cert.DNSNames {
+		if name == san {
+			return true
+		}
+	}
+	for _, email := range cert.EmailAddresses {
+		if email == san {
+			return true
+		}
+	}
+	for _, ip := range cert.IPAddresses {
+		if ip.String() == san {
+			return true
+		}
+	}
+	for _, uri := range cert.URIs {
+		if uri.String() == san {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,241 @@
+// Package config loads the YAML configuration file of the stub server and
+// translates it into command line flags, so flags and environment variables
+// can override every value of the file.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is the configuration file. All values are kept as written, after
+// environment variable interpolation, and validated by the flags they are
+// translated to.
+type File struct {
+	Address   string     `yaml:"address"`
+	Listeners []Listener `yaml:"listeners"`
+	TLS       TLS        `yaml:"tls"`
+	HTTP      HTTP       `yaml:"http"`
+	GRPC      GRPC       `yaml:"grpc"`
+	// ProxyConfig is the path of the JSON proxy configuration.
+	ProxyConfig string  `yaml:"proxyConfig"`
+	Logging     Logging `yaml:"logging"`
+	// Latency delays every stub response, e.g. "50ms".
+	Latency string `yaml:"latency"`
+}
+
+// Listener is an address serving a set of protocols, see --listen.
+type Listener struct {
+	Protocols []string    `yaml:"protocols"`
+	Address   string      `yaml:"address"`
+	TLS       ListenerTLS `yaml:"tls"`
+}
+
+// ListenerTLS enables TLS for a listener. It is either a boolean to use the
+// global TLS settings or TLS settings overriding them.
+type ListenerTLS struct {
+	Enabled string
+	TLS
+}
+
+// UnmarshalYAML accepts a boolean or TLS settings.
+func (t *ListenerTLS) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		t.Enabled = node.Value
+		return nil
+	}
+	t.Enabled = "true"
+	return node.Decode(&t.TLS)
+}
+
+// TLS holds the TLS settings.
+type TLS struct {
+	Cert     string `yaml:"cert"`
+	Key      string `yaml:"key"`
+	ClientCA string `yaml:"clientCA"`
+	// Auto is the path the CA of a generated certificate is written to.
+	Auto string `yaml:"auto"`
+}
+
+// HTTP configures the HTTP stubs.
+type HTTP struct {
+	// Stubs lists the stub directories. Recorded stubs are written to the
+	// first one.
+	Stubs             []string `yaml:"stubs"`
+	VirtualHosts      string   `yaml:"virtualHosts"`
+	OpenAPI           string   `yaml:"openapi"`
+	OpenAPIValidation string   `yaml:"openapiValidation"`
+	// Record is the upstream URL unmatched requests are recorded from.
+	Record string `yaml:"record"`
+}
+
+// GRPC configures the gRPC stubs.
+type GRPC struct {
+	Protos     []string `yaml:"protos"`
+	ProtoFiles []string `yaml:"protoFiles"`
+	Protosets  []string `yaml:"protosets"`
+	// Stubs lists the stub directories. Recorded and scaffolded stubs are
+	// written to the first one.
+	Stubs      []string `yaml:"stubs"`
+	Reflection string   `yaml:"reflection"`
+	Fake       string   `yaml:"fake"`
+	FakeSeed   string   `yaml:"fakeSeed"`
+	Validate   string   `yaml:"validate"`
+	// Record is the upstream address unmatched calls are recorded from.
+	Record string `yaml:"record"`
+}
+
+// Logging configures the log output.
+type Logging struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// Flag is a command line flag and its value.
+type Flag struct {
+	Name  string
+	Value string
+}
+
+// Load reads the configuration file at path. ${VAR} references in values are
+// replaced by the environment variable VAR, ${VAR:-default} by default if VAR
+// is unset or empty. Unknown keys and undefined variables are errors.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	f, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return f, nil
+}
+
+// Parse parses a configuration file, see Load.
+func Parse(data []byte) (*File, error) {
+	var f File
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	var errs []error
+	expandStrings(reflect.ValueOf(&f).Elem(), func(s string) string {
+		v, err := interpolate(s)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		return v
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// interpolate replaces environment variable references in s.
+func interpolate(s string) (string, error) {
+	var errs []error
+	v := os.Expand(s, func(ref string) string {
+		name, fallback, hasFallback := strings.Cut(ref, ":-")
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+		if hasFallback {
+			return fallback
+		}
+		if _, ok := os.LookupEnv(name); !ok {
+			errs = append(errs, fmt.Errorf("undefined environment variable %q", name))
+		}
+		return ""
+	})
+	return v, errors.Join(errs...)
+}
+
+// expandStrings applies fn to every string in v.
+func expandStrings(v reflect.Value, fn func(string) string) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(fn(v.String()))
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			expandStrings(v.Index(i), fn)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			expandStrings(v.Field(i), fn)
+		}
+	}
+}
+
+// Flags returns the flags equivalent to the file, in the order they are
+// applied. Values that aren't set are omitted.
+func (f *File) Flags() []Flag {
+	var flags []Flag
+	add := func(name string, value string) {
+		if value != "" {
+			flags = append(flags, Flag{Name: name, Value: value})
+		}
+	}
+
+	add("address", f.Address)
+	for _, l := range f.Listeners {
+		add("listen", l.spec())
+	}
+	add("cert", f.TLS.Cert)
+	add("key", f.TLS.Key)
+	add("client-ca", f.TLS.ClientCA)
+	add("auto-tls", f.TLS.Auto)
+
+	add("http", strings.Join(f.HTTP.Stubs, ","))
+	add("http-vhosts", f.HTTP.VirtualHosts)
+	add("openapi", f.HTTP.OpenAPI)
+	add("openapi-validation", f.HTTP.OpenAPIValidation)
+	add("proxy-http", f.HTTP.Record)
+
+	add("proto", strings.Join(f.GRPC.Protos, ","))
+	add("proto-files", strings.Join(f.GRPC.ProtoFiles, ","))
+	add("protoset", strings.Join(f.GRPC.Protosets, ","))
+	add("stubs", strings.Join(f.GRPC.Stubs, ","))
+	add("grpc-reflection", f.GRPC.Reflection)
+	add("grpc-fake", f.GRPC.Fake)
+	add("grpc-fake-seed", f.GRPC.FakeSeed)
+	add("grpc-validate", f.GRPC.Validate)
+	add("proxy-grpc", f.GRPC.Record)
+
+	add("proxy-config", f.ProxyConfig)
+	add("log-level", f.Logging.Level)
+	add("log-format", f.Logging.Format)
+	add("latency", f.Latency)
+
+	return flags
+}
+
+// spec returns the --listen value of the listener.
+func (l Listener) spec() string {
+	spec := strings.Join(l.Protocols, ",") + "=" + l.Address
+	if l.TLS.Enabled == "" || l.TLS.Enabled == "false" {
+		return spec
+	}
+	spec += ";tls"
+	for _, option := range []Flag{
+		{Name: "cert", Value: l.TLS.Cert},
+		{Name: "key", Value: l.TLS.Key},
+		{Name: "client-ca", Value: l.TLS.ClientCA},
+		{Name: "auto-tls", Value: l.TLS.Auto},
+	} {
+		if option.Value != "" {
+			spec += ";" + option.Name + "=" + option.Value
+		}
+	}
+	return spec
+}
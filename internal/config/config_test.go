@@ -0,0 +1,90 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	t.Setenv("STUB_CONFIG_TEST_CERTS", "/etc/certs")
+	t.Setenv("STUB_CONFIG_TEST_EMPTY", "")
+
+	path := filepath.Join(t.TempDir(), "stub-server.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+listeners:
+  - protocols: [http, grpc]
+    address: ":8080"
+  - protocols: [grpc]
+    address: ":8443"
+    tls: true
+  - protocols: [admin]
+    address: unix:///tmp/admin.sock
+    tls:
+      auto: ${STUB_CONFIG_TEST_CERTS}/ca.pem
+tls:
+  cert: ${STUB_CONFIG_TEST_CERTS}/server.pem
+  key: ${STUB_CONFIG_TEST_CERTS}/server.key
+http:
+  stubs: [stubs/http, shared/http]
+  virtualHosts: true
+grpc:
+  protos: [protos, third_party]
+  stubs: [stubs/grpc]
+  reflection: ${STUB_CONFIG_TEST_REFLECTION:-false}
+  fakeSeed: 42
+logging:
+  level: debug
+  format: ${STUB_CONFIG_TEST_EMPTY:-json}
+latency: 50ms
+`), 0o644))
+
+	f, err := config.Load(path)
+	require.NoError(t, err)
+	require.Equal(t, []config.Flag{
+		{Name: "listen", Value: "http,grpc=:8080"},
+		{Name: "listen", Value: "grpc=:8443;tls"},
+		{Name: "listen", Value: "admin=unix:///tmp/admin.sock;tls;auto-tls=/etc/certs/ca.pem"},
+		{Name: "cert", Value: "/etc/certs/server.pem"},
+		{Name: "key", Value: "/etc/certs/server.key"},
+		{Name: "http", Value: "stubs/http,shared/http"},
+		{Name: "http-vhosts", Value: "true"},
+		{Name: "proto", Value: "protos,third_party"},
+		{Name: "stubs", Value: "stubs/grpc"},
+		{Name: "grpc-reflection", Value: "false"},
+		{Name: "grpc-fake-seed", Value: "42"},
+		{Name: "log-level", Value: "debug"},
+		{Name: "log-format", Value: "json"},
+		{Name: "latency", Value: "50ms"},
+	}, f.Flags())
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "unknown key", data: "http:\n  stub: [stubs]\n", wantErr: "field stub not found"},
+		{name: "undefined variable", data: "address: ${STUB_CONFIG_TEST_UNDEFINED}\n", wantErr: `undefined environment variable "STUB_CONFIG_TEST_UNDEFINED"`},
+		{name: "invalid yaml", data: "listeners: {\n", wantErr: "yaml"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := config.Parse([]byte(tc.data))
+			require.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+
+	f, err := config.Parse(nil)
+	require.NoError(t, err)
+	require.Empty(t, f.Flags())
+}
@@ -0,0 +1,147 @@
+// Package diag attaches file and line information to errors found while
+// loading stub files.
+package diag
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Error is a problem located in a file. Line is 0 if the position is unknown.
+// Document is the 1-based index of the stub in a file holding several stubs,
+// or 0.
+type Error struct {
+	File     string
+	Line     int
+	Document int
+	Err      error
+}
+
+func (e *Error) Error() string {
+	prefix := e.File
+	if e.Line > 0 {
+		prefix = fmt.Sprintf("%v:%d", e.File, e.Line)
+	}
+	if e.Document > 0 {
+		return fmt.Sprintf("%v: document %d: %v", prefix, e.Document, e.Err)
+	}
+	return fmt.Sprintf("%v: %v", prefix, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// FieldError is a problem with the value of a JSON field.
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+// Field wraps err as a problem with the given JSON field.
+func Field(field string, err error) error {
+	return &FieldError{Field: field, Err: err}
+}
+
+func (e *FieldError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Locate wraps err in an Error for file. The line is taken from JSON syntax
+// and type errors, or from the first occurrence of the key named by a
+// FieldError. Joined errors are located individually.
+func Locate(file string, data []byte, err error) error {
+	return LocateFunc(file, 0, err, func(err error) int {
+		return JSONLine(data, err)
+	})
+}
+
+// LocateFunc wraps err in an Error for the given document of file, taking the
+// line from line. Joined errors are located individually.
+func LocateFunc(file string, document int, err error, line func(error) int) error {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs := joined.Unwrap()
+		located := make([]error, 0, len(errs))
+		for _, e := range errs {
+			located = append(located, LocateFunc(file, document, e, line))
+		}
+		return errors.Join(located...)
+	}
+	return &Error{File: file, Line: line(err), Document: document, Err: err}
+}
+
+// JSONLine returns the line of err in the JSON data: the position of a syntax
+// or type error, or the first occurrence of the key named by a FieldError. It
+// returns 0 if the position is unknown.
+func JSONLine(data []byte, err error) int {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var fieldErr *FieldError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return LineAt(data, syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		return LineAt(data, typeErr.Offset)
+	case errors.As(err, &fieldErr):
+		return KeyLine(data, fieldErr.Field)
+	}
+	return 0
+}
+
+// LineAt returns the 1-based line of the byte offset in data.
+func LineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// KeyLine returns the line of the first occurrence of the JSON object key,
+// or 0 if the key is not present.
+func KeyLine(data []byte, key string) int {
+	re := regexp.MustCompile(`"` + regexp.QuoteMeta(key) + `"\s*:`)
+	loc := re.FindIndex(data)
+	if loc == nil {
+		return 0
+	}
+	return LineAt(data, int64(loc[0]))
+}
+
+// Flatten splits err into its individual problems. Joined errors are
+// expanded, also when wrapped, while other errors are kept with their context.
+func Flatten(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []error
+		for _, e := range joined.Unwrap() {
+			errs = append(errs, Flatten(e)...)
+		}
+		return errs
+	}
+	if _, ok := err.(*Error); ok {
+		return []error{err}
+	}
+	if inner := errors.Unwrap(err); inner != nil {
+		if errs := Flatten(inner); len(errs) > 1 {
+			return errs
+		} else if _, ok := errs[0].(*Error); ok {
+			return errs
+		}
+	}
+	return []error{err}
+}
@@ -0,0 +1,39 @@
+package diag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocate(t *testing.T) {
+	data := []byte("{\n  \"path\": \"/a\",\n  \"method\": 1\n}")
+
+	var v struct {
+		Method string `json:"method"`
+	}
+	err := Locate("stub.json", data, json.Unmarshal(data, &v))
+	require.ErrorContains(t, err, "stub.json:3: json: cannot unmarshal number")
+
+	err = Locate("stub.json", data, Field("path", errors.New("bad path")))
+	require.EqualError(t, err, "stub.json:2: bad path")
+
+	err = Locate("stub.json", data, errors.New("no position"))
+	require.EqualError(t, err, "stub.json: no position")
+}
+
+func TestFlatten(t *testing.T) {
+	a := &Error{File: "a.json", Line: 1, Err: errors.New("a")}
+	b := &Error{File: "b.json", Err: errors.New("b")}
+	other := errors.New("other")
+
+	require.Nil(t, Flatten(nil))
+	require.Equal(t, []error{a, b}, Flatten(fmt.Errorf("load: %w", errors.Join(a, b))))
+	require.Equal(t, []error{a}, Flatten(fmt.Errorf("load: %w", a)))
+
+	wrapped := fmt.Errorf("load: %w", other)
+	require.Equal(t, []error{wrapped}, Flatten(wrapped))
+}
@@ -0,0 +1,73 @@
+package grpcstub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"buf.build/go/protovalidate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// newValidator builds a protovalidate validator for the inputs of all
+// registered methods. The rules are compiled eagerly so that invalid
+// constraints in the protos fail at startup instead of on the first call.
+func (s *GRPCService) newValidator() (protovalidate.Validator, error) {
+	var inputs []protoreflect.MessageDescriptor
+	for _, sd := range s.Services() {
+		for i := 0; i < sd.Methods().Len(); i++ {
+			inputs = append(inputs, sd.Methods().Get(i).Input())
+		}
+	}
+
+	v, err := protovalidate.New(
+		protovalidate.WithMessageDescriptors(inputs...),
+		protovalidate.WithExtensionTypeResolver(s.types),
+		protovalidate.WithDisableLazy(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("compile buf.validate rules: %w", err)
+	}
+	return v, nil
+}
+
+// validateInput checks the request message against its buf.validate
+// constraints. Violations are returned as codes.InvalidArgument with
+// errdetails.BadRequest details, like protovalidate interceptors do.
+func (s *GRPCService) validateInput(ctx context.Context, input proto.Message) error {
+	if s.validator == nil {
+		return nil
+	}
+
+	err := s.validator.Validate(input)
+	if err == nil {
+		return nil
+	}
+
+	var verr *protovalidate.ValidationError
+	if !errors.As(err, &verr) {
+		slog.ErrorContext(ctx, "Failed to validate input message", slog.String("error", err.Error()))
+		return status.Error(codes.Internal, "Failed to validate input message")
+	}
+
+	details := &errdetails.BadRequest{}
+	for _, v := range verr.Violations {
+		details.FieldViolations = append(details.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       protovalidate.FieldPathString(v.Proto.GetField()),
+			Description: v.Proto.GetMessage(),
+			Reason:      v.Proto.GetRuleId(),
+		})
+	}
+	slog.InfoContext(ctx, "Input message failed validation", slog.String("error", verr.Error()))
+
+	st, err := status.New(codes.InvalidArgument, verr.Error()).WithDetails(details)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, verr.Error())
+	}
+	return st.Err()
+}
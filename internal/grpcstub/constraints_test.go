@@ -0,0 +1,102 @@
+package grpcstub_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/grpcstub"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const validatedProto = `syntax = "proto3";
+package users;
+
+import "buf/validate/validate.proto";
+
+service Users {
+  rpc Create(User) returns (User);
+}
+
+message User {
+  string email = 1 [(buf.validate.field).string.email = true];
+  int32 age = 2 [(buf.validate.field).int32 = {gte: 0, lte: 150}];
+}
+`
+
+func TestValidateRequests(t *testing.T) {
+	t.Parallel()
+
+	protoDir, stubDir := setupProtoAndStub(t, "users", validatedProto, `{
+  "service": "users.Users",
+  "method": "Create",
+  "output": {"data": {"email": "created@example.com"}}
+}`)
+
+	call := startValidatingServer(t, protoDir, stubDir, grpcstub.ServerOptions{ValidateRequests: true})
+
+	out, err := call(`{"email": "alice@example.com", "age": 30}`)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"email": "created@example.com"}`, out)
+
+	_, err = call(`{"email": "alice", "age": 200}`)
+	st := status.Convert(err)
+	require.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 1)
+	badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+	require.True(t, ok)
+
+	violations := map[string]string{}
+	for _, v := range badRequest.GetFieldViolations() {
+		violations[v.GetField()] = v.GetReason()
+	}
+	require.Equal(t, map[string]string{"email": "string.email", "age": "int32.gte_lte"}, violations)
+
+	// Without the option the constraints are ignored.
+	call = startValidatingServer(t, protoDir, stubDir, grpcstub.ServerOptions{})
+	_, err = call(`{"email": "alice", "age": 200}`)
+	require.NoError(t, err)
+}
+
+func startValidatingServer(t *testing.T, protoDir, stubDir string, opts grpcstub.ServerOptions) func(input string) (string, error) {
+	t.Helper()
+
+	svc, err := grpcstub.NewService(protoDir, stubDir, opts)
+	require.NoError(t, err)
+	method, ok := svc.FindMethod("users.Users", "Create")
+	require.True(t, ok)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = svc.Server().Serve(listener)
+	}()
+	t.Cleanup(svc.Server().Stop)
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return func(input string) (string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		req := dynamicpb.NewMessage(method.Input())
+		require.NoError(t, protojson.Unmarshal([]byte(input), req))
+		resp := dynamicpb.NewMessage(method.Output())
+		if err := conn.Invoke(ctx, "/users.Users/Create", req, resp); err != nil {
+			return "", err
+		}
+		b, err := protojson.Marshal(resp)
+		require.NoError(t, err)
+		return string(b), nil
+	}
+}
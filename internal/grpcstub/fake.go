@@ -0,0 +1,170 @@
+package grpcstub
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	// fakeMaxRepeated is the maximum number of elements of fake repeated
+	// fields, maps and streams.
+	fakeMaxRepeated = 3
+	// fakeDepth limits how deep recursive messages are populated.
+	fakeDepth = 3
+)
+
+var (
+	fakeFirstNames = []string{"Ada", "Grace", "Alan", "Edsger", "Barbara", "Donald", "Margaret", "Ken"}
+	fakeLastNames  = []string{"Lovelace", "Hopper", "Turing", "Dijkstra", "Liskov", "Knuth", "Hamilton", "Thompson"}
+	fakeCities     = []string{"Berlin", "Lisbon", "Oslo", "Toronto", "Osaka", "Austin"}
+	fakeCountries  = []string{"DE", "PT", "NO", "CA", "JP", "US"}
+	fakeWords      = []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel"}
+)
+
+// fakeOutput synthesizes a stub output for the method. Values are derived
+// from the field names and are deterministic for the seed and method, so
+// repeated calls return the same response.
+func (s *GRPCService) fakeOutput(md protoreflect.MethodDescriptor) (Output, error) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(md.FullName()))
+	f := &faker{rnd: rand.New(rand.NewPCG(uint64(s.fakeSeed), h.Sum64()))} //nolint:gosec // fake data
+
+	smp := &sampler{
+		scalar:    f.scalar,
+		count:     func(protoreflect.FieldDescriptor) int { return f.rnd.IntN(fakeMaxRepeated) + 1 },
+		timestamp: func() int64 { return 1577836800 + f.rnd.Int64N(5*365*24*3600) },
+		maxDepth:  fakeDepth,
+	}
+
+	fake := func() (json.RawMessage, error) {
+		b, err := protojson.Marshal(smp.message(md.Output()))
+		if err != nil {
+			return nil, fmt.Errorf("marshal fake %v: %w", md.Output().FullName(), err)
+		}
+		return b, nil
+	}
+
+	if !md.IsStreamingServer() {
+		data, err := fake()
+		return Output{Data: data}, err
+	}
+
+	stream := &Stream{}
+	for n := f.rnd.IntN(fakeMaxRepeated) + 1; n > 0; n-- {
+		data, err := fake()
+		if err != nil {
+			return Output{}, err
+		}
+		stream.Data = append(stream.Data, data)
+	}
+	return Output{Stream: stream}, nil
+}
+
+// faker returns fake scalar values based on the field name.
+type faker struct {
+	rnd *rand.Rand
+}
+
+func (f *faker) scalar(fd protoreflect.FieldDescriptor) protoreflect.Value {
+	name := strings.ToLower(string(fd.Name()))
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(f.text(name))
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(f.rnd.IntN(2) == 1)
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		if values.Len() > 1 {
+			return protoreflect.ValueOfEnum(values.Get(f.rnd.IntN(values.Len()-1) + 1).Number())
+		}
+		return protoreflect.ValueOfEnum(values.Get(0).Number())
+	case protoreflect.BytesKind:
+		b := make([]byte, 8)
+		for i := range b {
+			b[i] = byte(f.rnd.UintN(256))
+		}
+		return protoreflect.ValueOfBytes(b)
+	case protoreflect.FloatKind:
+		return protoreflect.ValueOfFloat32(float32(f.float(name)))
+	case protoreflect.DoubleKind:
+		return protoreflect.ValueOfFloat64(f.float(name))
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return protoreflect.ValueOfInt32(int32(f.int(name)))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return protoreflect.ValueOfInt64(f.int(name))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return protoreflect.ValueOfUint32(uint32(f.int(name)))
+	default:
+		return protoreflect.ValueOfUint64(uint64(f.int(name)))
+	}
+}
+
+func (f *faker) text(name string) string {
+	pick := func(values []string) string { return values[f.rnd.IntN(len(values))] }
+
+	switch {
+	case strings.Contains(name, "email"):
+		return strings.ToLower(pick(fakeFirstNames)+"."+pick(fakeLastNames)) + "@example.com"
+	case name == "id" || strings.HasSuffix(name, "_id") || strings.Contains(name, "uuid"):
+		return fmt.Sprintf("%08x-%04x-4%03x-%04x-%012x",
+			f.rnd.Uint32(), f.rnd.UintN(1<<16), f.rnd.UintN(1<<12), f.rnd.UintN(1<<14)|0x8000, f.rnd.Uint64N(1<<48))
+	case strings.Contains(name, "first_name") || name == "given_name":
+		return pick(fakeFirstNames)
+	case strings.Contains(name, "last_name") || name == "family_name" || name == "surname":
+		return pick(fakeLastNames)
+	case strings.Contains(name, "name"):
+		return pick(fakeFirstNames) + " " + pick(fakeLastNames)
+	case hasWord(name, "url", "uri", "link", "website"):
+		return "https://example.com/" + pick(fakeWords)
+	case strings.Contains(name, "phone"):
+		return fmt.Sprintf("+1555%07d", f.rnd.IntN(10000000))
+	case strings.Contains(name, "city"):
+		return pick(fakeCities)
+	case strings.Contains(name, "country"):
+		return pick(fakeCountries)
+	default:
+		return pick(fakeWords) + " " + pick(fakeWords)
+	}
+}
+
+func (f *faker) int(name string) int64 {
+	switch {
+	case hasWord(name, "age"):
+		return 18 + f.rnd.Int64N(70)
+	case hasWord(name, "year"):
+		return 1990 + f.rnd.Int64N(36)
+	case hasWord(name, "count", "total", "size"):
+		return f.rnd.Int64N(100)
+	default:
+		return 1 + f.rnd.Int64N(1000)
+	}
+}
+
+func (f *faker) float(name string) float64 {
+	switch {
+	case hasWord(name, "lat", "latitude"):
+		return float64(f.rnd.IntN(180_000_000)-90_000_000) / 1e6
+	case hasWord(name, "lon", "lng", "longitude"):
+		return float64(f.rnd.IntN(360_000_000)-180_000_000) / 1e6
+	default:
+		return float64(f.rnd.IntN(100_000)) / 100
+	}
+}
+
+// hasWord reports whether one of the words is a part of the snake_case name.
+func hasWord(name string, words ...string) bool {
+	for _, part := range strings.Split(name, "_") {
+		for _, w := range words {
+			if part == w {
+				return true
+			}
+		}
+	}
+	return false
+}
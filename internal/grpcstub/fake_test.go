@@ -0,0 +1,90 @@
+package grpcstub_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/grpcstub"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	routeguidepb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestFakeResponses(t *testing.T) {
+	t.Parallel()
+
+	client := startFakeServer(t, grpcstub.ServerOptions{FakeResponses: true, FakeSeed: 42})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	t.Cleanup(cancel)
+
+	first, err := client.GetFeature(ctx, &routeguidepb.Point{})
+	require.NoError(t, err)
+	require.NotEmpty(t, first.GetName())
+	require.NotNil(t, first.GetLocation())
+
+	second, err := client.GetFeature(ctx, &routeguidepb.Point{Latitude: 1})
+	require.NoError(t, err)
+	require.True(t, proto.Equal(first, second), "fake responses are deterministic")
+
+	stream, err := client.ListFeatures(ctx, &routeguidepb.Rectangle{})
+	require.NoError(t, err)
+	count := 0
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		count++
+	}
+	require.GreaterOrEqual(t, count, 1)
+	require.LessOrEqual(t, count, 3)
+
+	other := startFakeServer(t, grpcstub.ServerOptions{FakeResponses: true, FakeSeed: 7})
+	reseeded, err := other.GetFeature(ctx, &routeguidepb.Point{})
+	require.NoError(t, err)
+	require.False(t, proto.Equal(first, reseeded), "the seed changes the fake responses")
+}
+
+func TestFakeResponsesDisabled(t *testing.T) {
+	t.Parallel()
+
+	client := startFakeServer(t, grpcstub.ServerOptions{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	t.Cleanup(cancel)
+
+	_, err := client.GetFeature(ctx, &routeguidepb.Point{})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func startFakeServer(t *testing.T, opts grpcstub.ServerOptions) routeguidepb.RouteGuideClient {
+	t.Helper()
+
+	srv, err := grpcstub.NewServerWithOptions("../../examples/protos", "", opts)
+	require.NoError(t, err)
+
+	listener := bufconn.Listen(bufSize)
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+	t.Cleanup(srv.Stop)
+
+	dialer := func(context.Context, string) (net.Conn, error) {
+		return listener.Dial()
+	}
+	conn, err := grpc.NewClient("passthrough:///bufnet", grpc.WithContextDialer(dialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return routeguidepb.NewRouteGuideClient(conn)
+}
@@ -0,0 +1,37 @@
+package grpcstub
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakerText(t *testing.T) {
+	f := &faker{rnd: rand.New(rand.NewPCG(1, 2))} //nolint:gosec // test data
+
+	require.True(t, strings.HasSuffix(f.text("contact_email"), "@example.com"))
+	require.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, f.text("user_id"))
+	require.Contains(t, fakeFirstNames, f.text("first_name"))
+	require.Contains(t, fakeLastNames, f.text("last_name"))
+	require.Len(t, strings.Fields(f.text("display_name")), 2)
+	require.True(t, strings.HasPrefix(f.text("avatar_url"), "https://example.com/"))
+}
+
+func TestFakerNumbers(t *testing.T) {
+	f := &faker{rnd: rand.New(rand.NewPCG(1, 2))} //nolint:gosec // test data
+
+	for i := 0; i < 100; i++ {
+		require.GreaterOrEqual(t, f.int("age"), int64(18))
+		require.Less(t, f.int("page_size"), int64(100))
+		require.InDelta(t, 0, f.float("latitude"), 90)
+		require.InDelta(t, 0, f.float("lng"), 180)
+	}
+}
+
+func TestHasWord(t *testing.T) {
+	require.True(t, hasWord("user_age", "age"))
+	require.False(t, hasWord("message", "age"))
+	require.True(t, hasWord("item_count", "count", "total"))
+}
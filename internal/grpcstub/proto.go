@@ -1,16 +1,23 @@
 package grpcstub
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"os"
-	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 
-	"github.com/bufbuild/protocompile/parser"
-	"github.com/bufbuild/protocompile/reporter"
+	_ "buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go/buf/validate" // register buf/validate/validate.proto
+	"github.com/bufbuild/protocompile"
+	_ "google.golang.org/genproto/googleapis/api/annotations" // register google/api/annotations.proto
+	_ "google.golang.org/genproto/googleapis/api/httpbody"    // register google/api/httpbody.proto
+	_ "google.golang.org/genproto/googleapis/rpc/code"        // register google/rpc/code.proto
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails"  // register google/rpc/error_details.proto
+	_ "google.golang.org/genproto/googleapis/rpc/status"      // register google/rpc/status.proto
 	"google.golang.org/grpc"
 	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
@@ -18,32 +25,64 @@ import (
 	"google.golang.org/protobuf/types/dynamicpb"
 )
 
-// registerTypes loads all .proto files from the specified directory and registers them
-// with the gRPC server.
-func (s *GRPCService) registerTypes(protoDir string) error {
-	err := filepath.WalkDir(protoDir, func(path string, d os.DirEntry, err error) error {
+// registerTypes compiles the .proto files found in the proto directory, the
+// first import path, and registers them together with all FileDescriptorSet
+// files found there. The other import paths only resolve imports, so vendored
+// roots don't expose all of their services; directories of the proto
+// directory that are import paths themselves are skipped. Files with a
+// descriptor set extension that don't hold one are skipped with a warning,
+// unless the proto directory names the file itself. If entryFiles is not
+// empty only those files and their imports are compiled.
+func (s *GRPCService) registerTypes(importPaths []string, entryFiles []string) error {
+	if len(importPaths) == 0 {
+		return nil
+	}
+
+	root := importPaths[0]
+	nested := map[string]bool{}
+	for _, p := range importPaths[1:] {
+		if abs, err := filepath.Abs(p); err == nil {
+			nested[abs] = true
+		}
+	}
+
+	var sources []string
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if !d.IsDir() {
-			if filepath.Ext(path) != ".proto" {
-				return nil
+		if d.IsDir() {
+			if abs, err := filepath.Abs(path); err == nil && path != root && nested[abs] {
+				return filepath.SkipDir
 			}
-			n, err := filepath.Rel(protoDir, path)
-			if err != nil {
-				return err
+			return nil
+		}
+		if isDescriptorSet(path) {
+			err := s.registerDescriptorSet(path)
+			if errors.Is(err, errNotDescriptorSet) && path != root {
+				slog.Warn("Skipping file that is not a descriptor set", slog.String("file", path), slog.String("error", err.Error()))
+				return nil
 			}
-
-			return s.registerProto(protoDir, n)
+			return err
+		}
+		if filepath.Ext(path) != ".proto" || len(entryFiles) > 0 {
+			return nil
 		}
+		n, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, filepath.ToSlash(n))
 		return nil
 	})
-
 	if err != nil {
 		return fmt.Errorf("register services: %w", err)
 	}
+	for _, f := range entryFiles {
+		sources = append(sources, filepath.ToSlash(f))
+	}
 
-	return nil
+	return s.compileProtos(importPaths, sources)
 }
 
 func (s *GRPCService) registerServices() {
@@ -72,56 +111,99 @@ func (s *GRPCService) registerServices() {
 	})
 }
 
-func (s *GRPCService) registerProto(protoDir string, protoFileName string) (err error) {
-	protoFileName = strings.ReplaceAll(protoFileName, "\\", "/")
-
-	// Skip the file if it is already registered
-	if _, err := s.files.FindFileByPath(protoFileName); err == nil {
+// compileProtos compiles and links the given files, resolving imports from the
+// import paths, the already registered descriptor sets and the protos bundled
+// in the binary.
+func (s *GRPCService) compileProtos(importPaths []string, files []string) error {
+	if len(files) == 0 {
 		return nil
 	}
 
-	fullPath := path.Join(protoDir, protoFileName)
-	f, err := os.Open(fullPath)
+	resolver := &importResolver{
+		source:      &protocompile.SourceResolver{ImportPaths: importPaths},
+		importPaths: importPaths,
+		files:       s.files,
+		bundled:     map[string]bool{},
+	}
+	compiler := protocompile.Compiler{Resolver: resolver}
+	compiled, err := compiler.Compile(context.Background(), files...)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) && isWellKnownProto(protoFileName) {
-			if err := s.registerWellKnown(protoFileName); err != nil {
-				return fmt.Errorf("open file: %w (well-known proto dependency %s missing from registry)", err, protoFileName)
-			}
-			return nil
-		}
-		return fmt.Errorf("open file: %w", err)
+		return fmt.Errorf("compile protos: %w", err)
 	}
-	defer func() {
-		closeErr := f.Close()
-		if closeErr != nil {
-			err = errors.Join(err, fmt.Errorf("close file: %w", closeErr))
-		}
-	}()
 
-	handler := reporter.NewHandler(nil)
-	node, err := parser.Parse(protoFileName, f, handler)
-	if err != nil {
-		return fmt.Errorf("parse proto: %w", err)
+	for _, fd := range compiled {
+		if err := s.registerCompiled(fd, resolver); err != nil {
+			return fmt.Errorf("register %s: %w", fd.Path(), err)
+		}
 	}
+	return nil
+}
 
-	res, err := parser.ResultFromAST(node, true, handler)
-	if err != nil {
-		return fmt.Errorf("convert from AST: %w", err)
+// registerCompiled registers a linked file after its imports. Bundled files are
+// taken from the global registry so that their generated Go types are reused.
+func (s *GRPCService) registerCompiled(fd protoreflect.FileDescriptor, resolver *importResolver) error {
+	if _, err := s.files.FindFileByPath(fd.Path()); err == nil {
+		return nil
+	}
+	if resolver.isBundled(fd.Path()) {
+		return s.registerWellKnown(fd.Path())
 	}
 
-	// recursively register dependencies
-	for _, d := range res.FileDescriptorProto().Dependency {
-		err = s.registerProto(protoDir, d)
-		if err != nil {
+	for i := 0; i < fd.Imports().Len(); i++ {
+		if err := s.registerCompiled(fd.Imports().Get(i).FileDescriptor, resolver); err != nil {
 			return err
 		}
 	}
 
-	fd, err := protodesc.NewFile(res.FileDescriptorProto(), s.files)
+	converted, err := protodesc.NewFile(protodesc.ToFileDescriptorProto(fd), s.files)
 	if err != nil {
 		return fmt.Errorf("convert to FileDescriptor: %w", err)
 	}
+	return s.registerFile(converted)
+}
+
+// importResolver resolves imports from the import paths first, then from files
+// already loaded from descriptor sets and finally from the protos bundled in
+// the binary.
+type importResolver struct {
+	source      *protocompile.SourceResolver
+	importPaths []string
+	files       *protoregistry.Files
+
+	mu      sync.Mutex
+	bundled map[string]bool
+}
+
+func (r *importResolver) FindFileByPath(path string) (protocompile.SearchResult, error) {
+	res, err := r.source.FindFileByPath(path)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return res, err
+	}
+
+	if fd, err := r.files.FindFileByPath(path); err == nil {
+		return protocompile.SearchResult{Desc: fd}, nil
+	}
+	if isWellKnownProto(path) {
+		if fd, err := protoregistry.GlobalFiles.FindFileByPath(path); err == nil {
+			r.mu.Lock()
+			r.bundled[path] = true
+			r.mu.Unlock()
+			return protocompile.SearchResult{Desc: fd}, nil
+		}
+	}
+
+	return protocompile.SearchResult{}, fmt.Errorf("%s not found in import paths [%s] or bundled protos: %w",
+		path, strings.Join(r.importPaths, ", "), fs.ErrNotExist)
+}
+
+func (r *importResolver) isBundled(path string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.bundled[path]
+}
 
+// registerFile registers the file and its top-level messages and extensions.
+func (s *GRPCService) registerFile(fd protoreflect.FileDescriptor) error {
 	if err := s.files.RegisterFile(fd); err != nil {
 		return fmt.Errorf("register file: %w", err)
 	}
@@ -142,15 +224,30 @@ func (s *GRPCService) registerProto(protoDir string, protoFileName string) (err
 	return nil
 }
 
+// isWellKnownProto reports whether the proto file may be resolved from the
+// global registry if it isn't present in the import paths. Besides the
+// protobuf well-known types this covers the googleapis protos bundled in the
+// binary, such as google/api/annotations.proto and google/rpc/status.proto,
+// and the protovalidate constraints in buf/validate/validate.proto.
 func isWellKnownProto(path string) bool {
-	return strings.HasPrefix(path, "google/protobuf/")
+	return strings.HasPrefix(path, "google/protobuf/") || strings.HasPrefix(path, "google/api/") ||
+		strings.HasPrefix(path, "google/rpc/") || strings.HasPrefix(path, "buf/validate/")
 }
 
 func (s *GRPCService) registerWellKnown(protoFileName string) error {
+	if _, err := s.files.FindFileByPath(protoFileName); err == nil {
+		return nil
+	}
+
 	fd, err := protoregistry.GlobalFiles.FindFileByPath(protoFileName)
 	if err != nil {
 		return err
 	}
+	for i := 0; i < fd.Imports().Len(); i++ {
+		if err := s.registerWellKnown(fd.Imports().Get(i).Path()); err != nil {
+			return err
+		}
+	}
 	if err := s.files.RegisterFile(fd); err != nil {
 		return err
 	}
@@ -0,0 +1,140 @@
+package grpcstub_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/grpcstub"
+	"github.com/stretchr/testify/require"
+)
+
+const orderProto = `syntax = "proto3";
+package shop;
+
+import "common/money.proto";
+import "google/api/annotations.proto";
+import "google/rpc/status.proto";
+
+service Orders {
+  rpc GetOrder(GetOrderRequest) returns (Order) {
+    option (google.api.http) = {get: "/v1/orders/{id}"};
+  }
+}
+
+message GetOrderRequest {
+  string id = 1;
+}
+
+message Order {
+  string id = 1;
+  common.Money total = 2;
+  google.rpc.Status status = 3;
+}
+`
+
+const moneyProto = `syntax = "proto3";
+package common;
+
+message Money {
+  string currency = 1;
+  int64 units = 2;
+}
+`
+
+const brokenProto = `syntax = "proto3";
+package broken;
+
+import "missing/dep.proto";
+
+message Broken {
+  missing.Dep dep = 1;
+}
+`
+
+func TestMultipleImportPaths(t *testing.T) {
+	t.Parallel()
+
+	protoDir, importDir, stubDir := setupImportPaths(t)
+
+	_, err := grpcstub.NewServer(protoDir, stubDir)
+	require.ErrorContains(t, err, "common/money.proto not found in import paths")
+
+	srv, err := grpcstub.NewService(protoDir, stubDir, grpcstub.ServerOptions{
+		ImportPaths: []string{importDir},
+	})
+	require.NoError(t, err)
+
+	md, ok := srv.FindMethod("shop.Orders", "GetOrder")
+	require.True(t, ok)
+	require.Equal(t, "common.Money", string(md.Output().Fields().ByName("total").Message().FullName()))
+	require.Equal(t, "google.rpc.Status", string(md.Output().Fields().ByName("status").Message().FullName()))
+}
+
+func TestProtoEntryFiles(t *testing.T) {
+	t.Parallel()
+
+	protoDir, importDir, stubDir := setupImportPaths(t)
+	require.NoError(t, os.WriteFile(filepath.Join(protoDir, "broken.proto"), []byte(brokenProto), 0o644))
+
+	_, err := grpcstub.NewService(protoDir, stubDir, grpcstub.ServerOptions{
+		ImportPaths: []string{importDir},
+	})
+	require.ErrorContains(t, err, "missing/dep.proto not found in import paths")
+
+	srv, err := grpcstub.NewService(protoDir, stubDir, grpcstub.ServerOptions{
+		ImportPaths: []string{importDir},
+		ProtoFiles:  []string{"shop/order.proto"},
+	})
+	require.NoError(t, err)
+	require.Len(t, srv.Services(), 1)
+}
+
+const billingProto = `syntax = "proto3";
+package vendor;
+
+service Billing {
+  rpc Charge(Invoice) returns (Invoice);
+}
+
+message Invoice {
+  string id = 1;
+}
+`
+
+func TestImportPathsResolvedLazily(t *testing.T) {
+	t.Parallel()
+
+	protoDir, _, stubDir := setupImportPaths(t)
+	// The vendored root lies inside the proto directory and holds services
+	// that aren't imported.
+	vendored := filepath.Join(protoDir, "third_party")
+	require.NoError(t, os.MkdirAll(filepath.Join(vendored, "common"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(vendored, "vendor"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(vendored, "common", "money.proto"), []byte(moneyProto), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(vendored, "vendor", "billing.proto"), []byte(billingProto), 0o644))
+
+	srv, err := grpcstub.NewService("", stubDir, grpcstub.ServerOptions{
+		ImportPaths: []string{protoDir, vendored},
+	})
+	require.NoError(t, err)
+	require.Len(t, srv.Services(), 1)
+	require.Equal(t, "shop.Orders", string(srv.Services()[0].FullName()))
+}
+
+func setupImportPaths(t *testing.T) (string, string, string) {
+	t.Helper()
+
+	root := t.TempDir()
+	protoDir := filepath.Join(root, "protos")
+	importDir := filepath.Join(root, "third_party")
+	stubDir := filepath.Join(root, "stubs")
+	require.NoError(t, os.MkdirAll(filepath.Join(protoDir, "shop"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(importDir, "common"), 0o755))
+	require.NoError(t, os.MkdirAll(stubDir, 0o755))
+
+	require.NoError(t, os.WriteFile(filepath.Join(protoDir, "shop", "order.proto"), []byte(orderProto), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(importDir, "common", "money.proto"), []byte(moneyProto), 0o644))
+
+	return protoDir, importDir, stubDir
+}
@@ -0,0 +1,92 @@
+package grpcstub
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// isDescriptorSet reports whether the file is a serialized FileDescriptorSet,
+// as written by `protoc --descriptor_set_out` or `buf build -o`, based on its
+// extension.
+func isDescriptorSet(path string) bool {
+	switch filepath.Ext(path) {
+	case ".pb", ".binpb", ".protoset":
+		return true
+	}
+	return false
+}
+
+// errNotDescriptorSet marks files that don't hold a FileDescriptorSet.
+var errNotDescriptorSet = errors.New("not a descriptor set")
+
+// registerDescriptorSet loads a FileDescriptorSet and registers all files it
+// contains. Buf images are wire compatible with FileDescriptorSet and can be
+// loaded as well. Imports missing from the set are resolved from the
+// well-known protos. Files that can't be parsed as a set, contain fields
+// unknown to it or no files at all fail with errNotDescriptorSet.
+func (s *GRPCService) registerDescriptorSet(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read descriptor set: %w", err)
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(b, set); err != nil {
+		return fmt.Errorf("unmarshal descriptor set %v: %w: %w", path, errNotDescriptorSet, err)
+	}
+	if len(set.ProtoReflect().GetUnknown()) > 0 || len(set.GetFile()) == 0 {
+		return fmt.Errorf("unmarshal descriptor set %v: %w", path, errNotDescriptorSet)
+	}
+
+	files := make(map[string]*descriptorpb.FileDescriptorProto, len(set.GetFile()))
+	for _, fdp := range set.GetFile() {
+		files[fdp.GetName()] = fdp
+	}
+
+	for _, fdp := range set.GetFile() {
+		if err := s.registerFileProto(fdp, files); err != nil {
+			return fmt.Errorf("register descriptor set %v: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// registerFileProto registers a file of a descriptor set after registering
+// its dependencies.
+func (s *GRPCService) registerFileProto(fdp *descriptorpb.FileDescriptorProto, set map[string]*descriptorpb.FileDescriptorProto) error {
+	if _, err := s.files.FindFileByPath(fdp.GetName()); err == nil {
+		return nil
+	}
+
+	for _, dep := range fdp.GetDependency() {
+		if depProto, ok := set[dep]; ok {
+			if err := s.registerFileProto(depProto, set); err != nil {
+				return err
+			}
+			continue
+		}
+		if isWellKnownProto(dep) {
+			if err := s.registerWellKnown(dep); err != nil {
+				return fmt.Errorf("%v: import %q: %w", fdp.GetName(), dep, err)
+			}
+			continue
+		}
+		if _, err := s.files.FindFileByPath(dep); err != nil {
+			return fmt.Errorf("%v: import %q not found in descriptor set", fdp.GetName(), dep)
+		}
+	}
+
+	fd, err := protodesc.NewFile(fdp, s.files)
+	if err != nil {
+		return fmt.Errorf("convert %v to FileDescriptor: %w", fdp.GetName(), err)
+	}
+
+	return s.registerFile(fd)
+}
@@ -0,0 +1,116 @@
+package grpcstub_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/grpcstub"
+	"github.com/stretchr/testify/require"
+	helloworldpb "google.golang.org/grpc/examples/helloworld/helloworld"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestDescriptorSetAutoDetected(t *testing.T) {
+	t.Parallel()
+
+	for _, ext := range []string{".pb", ".binpb", ".protoset"} {
+		t.Run(ext, func(t *testing.T) {
+			t.Parallel()
+
+			protoDir, stubDir := setupDescriptorSet(t, "image"+ext)
+
+			conn, cleanup := startBufConnServer(t, protoDir, stubDir)
+			t.Cleanup(cleanup)
+
+			require.Contains(t, listServices(t, conn), "helloworld.Greeter")
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			t.Cleanup(cancel)
+
+			reply, err := helloworldpb.NewGreeterClient(conn).SayHello(ctx, &helloworldpb.HelloRequest{Name: "Jane"})
+			require.NoError(t, err)
+			require.Equal(t, "ok", reply.GetMessage())
+		})
+	}
+}
+
+func TestDescriptorSetAutoDetectedSkipsOtherFiles(t *testing.T) {
+	t.Parallel()
+
+	protoDir, stubDir := setupDescriptorSet(t, "image.binpb")
+	junk := filepath.Join(protoDir, "model.pb")
+	require.NoError(t, os.WriteFile(junk, []byte("\x00\x01 not a descriptor set \xff"), 0o644))
+
+	svc, err := grpcstub.NewService(protoDir, stubDir, grpcstub.ServerOptions{})
+	require.NoError(t, err)
+	_, ok := svc.FindMethod("helloworld.Greeter", "SayHello")
+	require.True(t, ok)
+
+	// Descriptor sets given explicitly must be valid.
+	_, err = grpcstub.NewService("", stubDir, grpcstub.ServerOptions{DescriptorSets: []string{junk}})
+	require.ErrorContains(t, err, "not a descriptor set")
+	_, err = grpcstub.NewService(junk, stubDir, grpcstub.ServerOptions{})
+	require.ErrorContains(t, err, "not a descriptor set")
+}
+
+func TestDescriptorSetOption(t *testing.T) {
+	t.Parallel()
+
+	protoDir, stubDir := setupDescriptorSet(t, "image.bin")
+
+	_, err := grpcstub.NewServerWithOptions("", stubDir, grpcstub.ServerOptions{})
+	require.Error(t, err)
+
+	_, err = grpcstub.NewServerWithOptions("", stubDir, grpcstub.ServerOptions{
+		DescriptorSets: []string{filepath.Join(protoDir, "image.bin")},
+	})
+	require.NoError(t, err)
+}
+
+func TestDescriptorSetMissingImport(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	fdp := protodesc.ToFileDescriptorProto(helloworldpb.File_examples_helloworld_helloworld_helloworld_proto)
+	fdp.Dependency = append(fdp.Dependency, "missing/dep.proto")
+	writeDescriptorSet(t, filepath.Join(root, "image.binpb"), fdp)
+
+	_, err := grpcstub.NewServer(root, t.TempDir())
+	require.ErrorContains(t, err, `import "missing/dep.proto" not found in descriptor set`)
+}
+
+func setupDescriptorSet(t *testing.T, name string) (string, string) {
+	t.Helper()
+
+	root := t.TempDir()
+	protoDir := filepath.Join(root, "protos")
+	stubDir := filepath.Join(root, "stubs")
+	require.NoError(t, os.MkdirAll(protoDir, 0o755))
+	require.NoError(t, os.MkdirAll(stubDir, 0o755))
+
+	writeDescriptorSet(t, filepath.Join(protoDir, name),
+		protodesc.ToFileDescriptorProto(emptypb.File_google_protobuf_empty_proto),
+		protodesc.ToFileDescriptorProto(helloworldpb.File_examples_helloworld_helloworld_helloworld_proto),
+	)
+	require.NoError(t, os.WriteFile(filepath.Join(stubDir, "hello.json"), []byte(`{
+  "service": "helloworld.Greeter",
+  "method": "SayHello",
+  "output": {"data": {"message": "ok"}}
+}`), 0o644))
+
+	return protoDir, stubDir
+}
+
+func writeDescriptorSet(t *testing.T, path string, files ...*descriptorpb.FileDescriptorProto) {
+	t.Helper()
+
+	b, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: files})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, b, 0o644))
+}
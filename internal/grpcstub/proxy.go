@@ -0,0 +1,82 @@
+package grpcstub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ProxyRoute forwards calls of a service without a matching stub to an
+// upstream gRPC server.
+type ProxyRoute struct {
+	// Service is the fully-qualified name of the proxied service. Routes
+	// without service, or with "*", apply to all services.
+	Service string `json:"service"`
+	// Upstream is the address of the upstream server, e.g. localhost:50051.
+	Upstream string `json:"upstream"`
+	// SetMetadata adds or replaces request metadata sent to the upstream.
+	SetMetadata map[string]string `json:"setMetadata,omitempty"`
+	// RemoveMetadata lists request metadata keys not sent to the upstream.
+	RemoveMetadata []string `json:"removeMetadata,omitempty"`
+}
+
+// proxy forwards calls without a matching stub to the upstream configured for
+// their service, without recording them.
+type proxy struct {
+	services map[string]*upstream
+	fallback *upstream
+}
+
+// newProxy connects to the upstreams of the routes. Routes must name a
+// registered service.
+func (s *GRPCService) newProxy(routes []ProxyRoute) (*proxy, error) {
+	p := &proxy{services: map[string]*upstream{}}
+	var errs []error
+	for _, route := range routes {
+		if route.Upstream == "" {
+			errs = append(errs, fmt.Errorf("proxy route for %q: upstream is required", route.Service))
+			continue
+		}
+		catchAll := route.Service == "" || route.Service == "*"
+		if !catchAll && s.sdMap[route.Service] == nil {
+			errs = append(errs, fmt.Errorf("proxy route for %q: service is not loaded", route.Service))
+			continue
+		}
+
+		u, err := newUpstream(route.Upstream)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("proxy route for %q: %w", route.Service, err))
+			continue
+		}
+		u.setMetadata = route.SetMetadata
+		u.removeMetadata = route.RemoveMetadata
+
+		if catchAll {
+			p.fallback = u
+		} else {
+			p.services[route.Service] = u
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// route returns the upstream of the method's service, if any.
+func (p *proxy) route(ctx context.Context, md protoreflect.MethodDescriptor) (*upstream, bool) {
+	if p == nil {
+		return nil, false
+	}
+	u, ok := p.services[string(md.Parent().FullName())]
+	if !ok {
+		u, ok = p.fallback, p.fallback != nil
+	}
+	if ok {
+		slog.InfoContext(ctx, "No stub configured, proxying call", slog.String("method", string(md.FullName())), slog.String("upstream", u.conn.Target()))
+	}
+	return u, ok
+}
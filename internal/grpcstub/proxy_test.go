@@ -0,0 +1,121 @@
+package grpcstub_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/grpcstub"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	routeguidepb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type metadataEcho struct {
+	routeguidepb.UnimplementedRouteGuideServer
+}
+
+func (metadataEcho) GetFeature(ctx context.Context, _ *routeguidepb.Point) (*routeguidepb.Feature, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return &routeguidepb.Feature{Name: "upstream auth=" + first(md.Get("authorization")) + " debug=" + first(md.Get("x-debug"))}, nil
+}
+
+// RouteChat echoes every note and ends the call once the client half-closes.
+func (metadataEcho) RouteChat(stream routeguidepb.RouteGuide_RouteChatServer) error {
+	for {
+		note, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&routeguidepb.RouteNote{Message: "echo " + note.GetMessage()}); err != nil {
+			return err
+		}
+	}
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func TestProxyRoutes(t *testing.T) {
+	t.Parallel()
+
+	upstream := grpc.NewServer()
+	routeguidepb.RegisterRouteGuideServer(upstream, metadataEcho{})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = upstream.Serve(listener)
+	}()
+	t.Cleanup(upstream.Stop)
+
+	stubDir := t.TempDir()
+	writeStub(t, stubDir, "feature.json", `{
+		"service": "routeguide.RouteGuide",
+		"method": "GetFeature",
+		"input": {"latitude": 1},
+		"output": {"data": {"name": "stub"}}
+	}`)
+	srv, err := grpcstub.NewServerWithOptions("../../examples/protos", stubDir, grpcstub.ServerOptions{
+		Proxy: []grpcstub.ProxyRoute{{
+			Service:        "routeguide.RouteGuide",
+			Upstream:       listener.Addr().String(),
+			SetMetadata:    map[string]string{"authorization": "Bearer upstream"},
+			RemoveMetadata: []string{"X-Debug"},
+		}},
+	})
+	require.NoError(t, err)
+	client := serveTCP(t, srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer client", "x-debug", "1")
+
+	feature, err := client.GetFeature(ctx, &routeguidepb.Point{Latitude: 1})
+	require.NoError(t, err)
+	require.Equal(t, "stub", feature.GetName())
+
+	feature, err = client.GetFeature(ctx, &routeguidepb.Point{Latitude: 2})
+	require.NoError(t, err)
+	require.Equal(t, "upstream auth=Bearer upstream debug=", feature.GetName())
+
+	// Bidirectional streams relay every message in both directions.
+	chat, err := client.RouteChat(ctx)
+	require.NoError(t, err)
+	for _, msg := range []string{"a", "b", "c"} {
+		require.NoError(t, chat.Send(&routeguidepb.RouteNote{Message: msg}))
+		note, err := chat.Recv()
+		require.NoError(t, err)
+		require.Equal(t, "echo "+msg, note.GetMessage())
+	}
+	require.NoError(t, chat.CloseSend())
+	_, err = chat.Recv()
+	require.ErrorIs(t, err, io.EOF)
+
+	// Upstream errors are passed through.
+	stream, err := client.ListFeatures(ctx, &routeguidepb.Rectangle{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestProxyRouteUnknownService(t *testing.T) {
+	t.Parallel()
+
+	_, err := grpcstub.NewServerWithOptions("../../examples/protos", t.TempDir(), grpcstub.ServerOptions{
+		Proxy: []grpcstub.ProxyRoute{{Service: "routeguide.Missing", Upstream: "localhost:50051"}},
+	})
+	require.ErrorContains(t, err, `proxy route for "routeguide.Missing": service is not loaded`)
+}
@@ -0,0 +1,161 @@
+package grpcstub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/stubfile"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// recorder forwards calls without a matching stub to an upstream gRPC server
+// and saves the request and response pairs as stubs.
+type recorder struct {
+	upstream *upstream
+	dir      string
+	stubs    Repository
+}
+
+func newRecorder(target string, dir string, stubs Repository) (*recorder, error) {
+	if dir == "" {
+		return nil, errors.New("recording requires a stub directory")
+	}
+	u, err := newUpstream(target)
+	if err != nil {
+		return nil, err
+	}
+	return &recorder{upstream: u, dir: dir, stubs: stubs}, nil
+}
+
+// unary forwards a unary call and records its response or error status.
+func (r *recorder) unary(ctx context.Context, md protoreflect.MethodDescriptor, input proto.Message) (proto.Message, error) {
+	output, err := r.upstream.unary(ctx, md, input)
+
+	stub := ProtoStub{Input: marshalRequest(input)}
+	if err != nil {
+		stub.Output.Code, stub.Output.Error = statusOf(err)
+		r.record(ctx, md, stub, err)
+		return nil, err
+	}
+	stub.Output.Data = marshalJSON(output)
+	r.record(ctx, md, stub, nil)
+	return output, nil
+}
+
+// serverStream forwards a server streaming call and records the sequence of
+// responses.
+func (r *recorder) serverStream(stream grpc.ServerStream, md protoreflect.MethodDescriptor, input proto.Message) error {
+	outputs, err := r.upstream.serverStream(stream, md, input)
+	if errors.Is(err, errRelay) {
+		return err
+	}
+	r.record(stream.Context(), md, ProtoStub{Input: marshalRequest(input), Output: Output{Stream: recordedStream(outputs, err)}}, err)
+	return err
+}
+
+// bidiStream forwards all messages of a bidirectional streaming call and
+// records the sequence of responses. Stubs only match the first request
+// message, so calls in which the client sent further messages are not
+// recorded rather than saved as a stub that ignores them.
+func (r *recorder) bidiStream(stream grpc.ServerStream, md protoreflect.MethodDescriptor, first proto.Message) error {
+	outputs, sent, err := r.upstream.bidiStream(stream, md, first)
+	if errors.Is(err, errRelay) {
+		return err
+	}
+	if sent > 1 {
+		slog.WarnContext(stream.Context(), "Bidirectional stream with several request messages not recorded, stubs only match the first message",
+			slog.String("method", string(md.FullName())),
+			slog.Int("messages", sent),
+		)
+		return err
+	}
+	r.record(stream.Context(), md, ProtoStub{Input: marshalRequest(first), Output: Output{Stream: recordedStream(outputs, err)}}, err)
+	return err
+}
+
+// recordedStream returns the stream output replaying the responses and the
+// status of a streaming call.
+func recordedStream(outputs []proto.Message, err error) *Stream {
+	recorded := &Stream{}
+	for _, output := range outputs {
+		recorded.Data = append(recorded.Data, marshalJSON(output))
+	}
+	if err != nil {
+		recorded.Code, recorded.Error = statusOf(err)
+	}
+	if len(recorded.Data) == 0 && err == nil {
+		// An empty stream can't be expressed as a stub, record an OK status.
+		code := codes.OK
+		recorded.Code = &code
+	}
+	return recorded
+}
+
+// clientStream forwards all received request messages of a client streaming
+// call and records the response.
+func (r *recorder) clientStream(stream grpc.ServerStream, md protoreflect.MethodDescriptor, inputs []proto.Message) error {
+	ctx := stream.Context()
+	output, err := r.upstream.clientStream(stream, md, inputs)
+
+	stub := ProtoStub{Input: marshalInputs(inputs)}
+	if err != nil {
+		stub.Output.Code, stub.Output.Error = statusOf(err)
+		r.record(ctx, md, stub, err)
+		return err
+	}
+	stub.Output.Data = marshalJSON(output)
+	r.record(ctx, md, stub, nil)
+	return stream.SendMsg(output)
+}
+
+// record saves the stub to <dir>/<service>/<method>.recorded.json and adds it
+// to the repository. Calls that failed because the client gave up or the
+// upstream was unreachable are not recorded.
+func (r *recorder) record(ctx context.Context, md protoreflect.MethodDescriptor, stub ProtoStub, callErr error) {
+	switch status.Code(callErr) {
+	case codes.Canceled, codes.Unavailable:
+		return
+	case codes.DeadlineExceeded:
+		if ctx.Err() != nil {
+			return
+		}
+	}
+
+	stub.Service = string(md.Parent().FullName())
+	stub.Method = string(md.Name())
+
+	b, err := json.MarshalIndent(stub, "", "  ")
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to marshal recorded stub", slog.String("error", err.Error()))
+		return
+	}
+	path, err := stubfile.CreateUnique(filepath.Join(r.dir, stub.Service), stub.Method+".recorded", ".json", append(b, '\n'))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to record stub", slog.String("method", string(md.FullName())), slog.String("error", err.Error()))
+		return
+	}
+	r.stubs.Add(stub)
+	slog.InfoContext(ctx, "Recorded stub", slog.String("file", path))
+}
+
+func statusOf(err error) (*codes.Code, string) {
+	st := status.Convert(err)
+	code := st.Code()
+	return &code, st.Message()
+}
+
+func marshalJSON(msg proto.Message) json.RawMessage {
+	b, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil
+	}
+	return b
+}
@@ -0,0 +1,212 @@
+package grpcstub_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/grpcstub"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	routeguidepb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/status"
+)
+
+func TestRecordMode(t *testing.T) {
+	t.Parallel()
+
+	upstreamStubs := t.TempDir()
+	writeStub(t, upstreamStubs, "feature.json", `{
+		"service": "routeguide.RouteGuide",
+		"method": "GetFeature",
+		"input": {"latitude": 1},
+		"output": {"data": {"name": "one"}}
+	}`)
+	writeStub(t, upstreamStubs, "missing.json", `{
+		"service": "routeguide.RouteGuide",
+		"method": "GetFeature",
+		"input": {"latitude": 2},
+		"output": {"code": 5, "error": "no feature"}
+	}`)
+	writeStub(t, upstreamStubs, "list.json", `{
+		"service": "routeguide.RouteGuide",
+		"method": "ListFeatures",
+		"output": {"stream": {"data": [{"name": "a"}, {"name": "b"}]}}
+	}`)
+	writeStub(t, upstreamStubs, "route.json", `{
+		"service": "routeguide.RouteGuide",
+		"method": "RecordRoute",
+		"output": {"data": {"point_count": 2}}
+	}`)
+	upstream, err := grpcstub.NewServer("../../examples/protos", upstreamStubs)
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = upstream.Serve(listener)
+	}()
+
+	recordDir := t.TempDir()
+	recording, err := grpcstub.NewServerWithOptions("../../examples/protos", recordDir, grpcstub.ServerOptions{
+		RecordUpstream: listener.Addr().String(),
+	})
+	require.NoError(t, err)
+	client := serveTCP(t, recording)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	feature, err := client.GetFeature(ctx, &routeguidepb.Point{Latitude: 1})
+	require.NoError(t, err)
+	require.Equal(t, "one", feature.GetName())
+
+	_, err = client.GetFeature(ctx, &routeguidepb.Point{Latitude: 2})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	require.Equal(t, []string{"a", "b"}, listFeatureNames(ctx, t, client))
+
+	route, err := client.RecordRoute(ctx)
+	require.NoError(t, err)
+	require.NoError(t, route.Send(&routeguidepb.Point{Latitude: 1}))
+	require.NoError(t, route.Send(&routeguidepb.Point{Latitude: 2}))
+	summary, err := route.CloseAndRecv()
+	require.NoError(t, err)
+	require.Equal(t, int32(2), summary.GetPointCount())
+
+	files, err := filepath.Glob(filepath.Join(recordDir, "routeguide.RouteGuide", "*.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 4)
+
+	// The recorded stubs replay the upstream responses without the upstream.
+	upstream.Stop()
+	replaying, err := grpcstub.NewServer("../../examples/protos", recordDir)
+	require.NoError(t, err)
+	client = serveTCP(t, replaying)
+
+	feature, err = client.GetFeature(ctx, &routeguidepb.Point{Latitude: 1})
+	require.NoError(t, err)
+	require.Equal(t, "one", feature.GetName())
+
+	_, err = client.GetFeature(ctx, &routeguidepb.Point{Latitude: 2})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	require.Equal(t, "no feature", status.Convert(err).Message())
+
+	_, err = client.GetFeature(ctx, &routeguidepb.Point{Latitude: 3})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	require.Equal(t, []string{"a", "b"}, listFeatureNames(ctx, t, client))
+
+	route, err = client.RecordRoute(ctx)
+	require.NoError(t, err)
+	require.NoError(t, route.Send(&routeguidepb.Point{Latitude: 1}))
+	require.NoError(t, route.Send(&routeguidepb.Point{Latitude: 2}))
+	summary, err = route.CloseAndRecv()
+	require.NoError(t, err)
+	require.Equal(t, int32(2), summary.GetPointCount())
+}
+
+func TestRecordModeBidiStream(t *testing.T) {
+	t.Parallel()
+
+	upstream := grpc.NewServer()
+	routeguidepb.RegisterRouteGuideServer(upstream, metadataEcho{})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = upstream.Serve(listener)
+	}()
+	t.Cleanup(upstream.Stop)
+
+	recordDir := t.TempDir()
+	recording, err := grpcstub.NewServerWithOptions("../../examples/protos", recordDir, grpcstub.ServerOptions{
+		RecordUpstream: listener.Addr().String(),
+	})
+	require.NoError(t, err)
+	client := serveTCP(t, recording)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	// Every message is relayed, but only the call with a single request
+	// message can be recorded.
+	require.Equal(t, []string{"echo a"}, chat(ctx, t, client, "a"))
+	require.Equal(t, []string{"echo b", "echo c"}, chat(ctx, t, client, "b", "c"))
+
+	files, err := filepath.Glob(filepath.Join(recordDir, "routeguide.RouteGuide", "RouteChat.recorded*.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	upstream.Stop()
+	replaying, err := grpcstub.NewServer("../../examples/protos", recordDir)
+	require.NoError(t, err)
+	client = serveTCP(t, replaying)
+	require.Equal(t, []string{"echo a"}, chat(ctx, t, client, "a"))
+}
+
+// chat sends the messages to RouteChat, waiting for a note after each, then
+// half-closes and returns the messages of all received notes.
+func chat(ctx context.Context, t *testing.T, client routeguidepb.RouteGuideClient, messages ...string) []string {
+	t.Helper()
+
+	stream, err := client.RouteChat(ctx)
+	require.NoError(t, err)
+	var received []string
+	for _, msg := range messages {
+		require.NoError(t, stream.Send(&routeguidepb.RouteNote{Message: msg}))
+		note, err := stream.Recv()
+		require.NoError(t, err)
+		received = append(received, note.GetMessage())
+	}
+	require.NoError(t, stream.CloseSend())
+	for {
+		note, err := stream.Recv()
+		if err == io.EOF {
+			return received
+		}
+		require.NoError(t, err)
+		received = append(received, note.GetMessage())
+	}
+}
+
+func writeStub(t *testing.T, dir string, name string, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+}
+
+func serveTCP(t *testing.T, srv *grpc.Server) routeguidepb.RouteGuideClient {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return routeguidepb.NewRouteGuideClient(conn)
+}
+
+func listFeatureNames(ctx context.Context, t *testing.T, client routeguidepb.RouteGuideClient) []string {
+	t.Helper()
+
+	stream, err := client.ListFeatures(ctx, &routeguidepb.Rectangle{})
+	require.NoError(t, err)
+	var names []string
+	for {
+		feature, err := stream.Recv()
+		if err == io.EOF {
+			return names
+		}
+		require.NoError(t, err)
+		names = append(names, feature.GetName())
+	}
+}
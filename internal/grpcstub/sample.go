@@ -0,0 +1,146 @@
+package grpcstub
+
+import (
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// sampleDepth limits how deep recursive messages are populated.
+const sampleDepth = 5
+
+// sampler populates messages with a value for every field. Only the first
+// alternative of a oneof is set and recursive messages stop at maxDepth.
+type sampler struct {
+	// scalar returns the value of a non-message field.
+	scalar func(fd protoreflect.FieldDescriptor) protoreflect.Value
+	// count returns the number of elements of a repeated field or map.
+	count func(fd protoreflect.FieldDescriptor) int
+	// timestamp returns the seconds of a google.protobuf.Timestamp field.
+	timestamp func() int64
+	maxDepth  int
+}
+
+// newSampler returns a sampler using fixed, type-appropriate values and a
+// single element for repeated fields and maps.
+func newSampler() *sampler {
+	return &sampler{
+		scalar:    sampleScalar,
+		count:     func(protoreflect.FieldDescriptor) int { return 1 },
+		timestamp: func() int64 { return 1704067200 },
+		maxDepth:  sampleDepth,
+	}
+}
+
+func (s *sampler) message(md protoreflect.MessageDescriptor) *dynamicpb.Message {
+	msg := dynamicpb.NewMessage(md)
+	s.populate(msg, 0)
+	return msg
+}
+
+func (s *sampler) populate(msg protoreflect.Message, depth int) {
+	if s.wellKnown(msg) {
+		return
+	}
+
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if oneof := fd.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() && oneof.Fields().Get(0) != fd {
+			continue
+		}
+		if fd.Message() != nil && depth >= s.maxDepth {
+			continue
+		}
+
+		switch {
+		case fd.IsMap():
+			m := msg.Mutable(fd).Map()
+			for n := s.count(fd); n > 0; n-- {
+				m.Set(s.scalar(fd.MapKey()).MapKey(), s.value(m.NewValue, fd.MapValue(), depth))
+			}
+		case fd.IsList():
+			l := msg.Mutable(fd).List()
+			for n := s.count(fd); n > 0; n-- {
+				l.Append(s.value(l.NewElement, fd, depth))
+			}
+		case fd.Message() != nil:
+			s.populate(msg.Mutable(fd).Message(), depth+1)
+		default:
+			msg.Set(fd, s.scalar(fd))
+		}
+	}
+}
+
+// value returns a sample element for a list or map, using newValue to create
+// message elements.
+func (s *sampler) value(newValue func() protoreflect.Value, fd protoreflect.FieldDescriptor, depth int) protoreflect.Value {
+	if fd.Message() == nil {
+		return s.scalar(fd)
+	}
+	v := newValue()
+	s.populate(v.Message(), depth+1)
+	return v
+}
+
+// wellKnown populates well-known types whose JSON form isn't a plain object
+// and reports whether msg was one of them.
+func (s *sampler) wellKnown(msg protoreflect.Message) bool {
+	fields := msg.Descriptor().Fields()
+	switch msg.Descriptor().FullName() {
+	case "google.protobuf.Timestamp":
+		msg.Set(fields.ByName("seconds"), protoreflect.ValueOfInt64(s.timestamp()))
+	case "google.protobuf.Duration":
+		msg.Set(fields.ByName("seconds"), protoreflect.ValueOfInt64(1))
+	case "google.protobuf.Value":
+		msg.Set(fields.ByName("string_value"), protoreflect.ValueOfString("value"))
+	case "google.protobuf.Struct":
+		m := msg.Mutable(fields.ByName("fields")).Map()
+		v := m.NewValue()
+		s.wellKnown(v.Message())
+		m.Set(protoreflect.ValueOfString("key").MapKey(), v)
+	case "google.protobuf.ListValue":
+		l := msg.Mutable(fields.ByName("values")).List()
+		v := l.NewElement()
+		s.wellKnown(v.Message())
+		l.Append(v)
+	case "google.protobuf.FieldMask":
+		msg.Mutable(fields.ByName("paths")).List().Append(protoreflect.ValueOfString("name"))
+	case "google.protobuf.Any", "google.protobuf.Empty":
+	default:
+		return false
+	}
+	return true
+}
+
+// sampleScalar returns a fixed value for the field's kind. Strings are set to
+// the field name so the generated JSON is easy to edit.
+func sampleScalar(fd protoreflect.FieldDescriptor) protoreflect.Value {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(true)
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		for i := 0; i < values.Len(); i++ {
+			if values.Get(i).Number() != 0 {
+				return protoreflect.ValueOfEnum(values.Get(i).Number())
+			}
+		}
+		return protoreflect.ValueOfEnum(values.Get(0).Number())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return protoreflect.ValueOfInt32(1)
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return protoreflect.ValueOfInt64(1)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return protoreflect.ValueOfUint32(1)
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return protoreflect.ValueOfUint64(1)
+	case protoreflect.FloatKind:
+		return protoreflect.ValueOfFloat32(1.5)
+	case protoreflect.DoubleKind:
+		return protoreflect.ValueOfFloat64(1.5)
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte(fd.Name()))
+	default:
+		return protoreflect.ValueOfString(string(fd.Name()))
+	}
+}
@@ -0,0 +1,69 @@
+package grpcstub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Scaffold writes a skeleton stub file for every method of the registered
+// services to dir/<service>/<method>.json. Output fields are populated with
+// sample values. Existing files are left untouched. It returns the paths of
+// the written files.
+func (s *GRPCService) Scaffold(dir string) ([]string, error) {
+	var written []string
+	for _, sd := range s.Services() {
+		for i := 0; i < sd.Methods().Len(); i++ {
+			md := sd.Methods().Get(i)
+			path := filepath.Join(dir, string(sd.FullName()), string(md.Name())+".json")
+			if _, err := os.Stat(path); err == nil {
+				continue
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return written, fmt.Errorf("stat %v: %w", path, err)
+			}
+
+			b, err := scaffoldStub(md)
+			if err != nil {
+				return written, fmt.Errorf("scaffold %v: %w", md.FullName(), err)
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return written, fmt.Errorf("create dir: %w", err)
+			}
+			if err := os.WriteFile(path, b, 0o644); err != nil {
+				return written, fmt.Errorf("write stub: %w", err)
+			}
+			written = append(written, path)
+		}
+	}
+	return written, nil
+}
+
+// scaffoldStub returns the JSON of a stub for the method. Server streaming
+// methods get a stream of two sample messages, all others a single one.
+func scaffoldStub(md protoreflect.MethodDescriptor) ([]byte, error) {
+	data, err := protojson.Marshal(newSampler().message(md.Output()))
+	if err != nil {
+		return nil, fmt.Errorf("marshal sample: %w", err)
+	}
+
+	stub := ProtoStub{
+		Service: string(md.Parent().FullName()),
+		Method:  string(md.Name()),
+	}
+	if md.IsStreamingServer() {
+		stub.Output.Stream = &Stream{Data: []json.RawMessage{data, data}}
+	} else {
+		stub.Output.Data = data
+	}
+
+	b, err := json.MarshalIndent(stub, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal stub: %w", err)
+	}
+	return append(b, '\n'), nil
+}
@@ -0,0 +1,95 @@
+package grpcstub_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/grpcstub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const scaffoldProto = `syntax = "proto3";
+package shop;
+
+import "google/protobuf/timestamp.proto";
+import "google/protobuf/struct.proto";
+
+service Catalog {
+  rpc GetProduct(Query) returns (Product);
+  rpc WatchProducts(Query) returns (stream Product);
+  rpc Upload(stream Product) returns (Query);
+}
+
+enum Status {
+  STATUS_UNSPECIFIED = 0;
+  STATUS_ACTIVE = 1;
+}
+
+message Query {
+  string id = 1;
+}
+
+message Product {
+  string id = 1;
+  int64 stock = 2;
+  double price = 3;
+  bool available = 4;
+  Status status = 5;
+  repeated string tags = 6;
+  map<string, int32> counts = 7;
+  oneof discount {
+    int32 percent = 8;
+    int32 amount = 9;
+  }
+  google.protobuf.Timestamp created_at = 10;
+  google.protobuf.Struct attributes = 11;
+  Product parent = 12;
+  optional string note = 13;
+}
+`
+
+func TestScaffold(t *testing.T) {
+	t.Parallel()
+
+	protoDir, _ := setupProtoAndStub(t, "shop", scaffoldProto, "{}")
+	out := t.TempDir()
+
+	srv, err := grpcstub.NewService(protoDir, "", grpcstub.ServerOptions{})
+	require.NoError(t, err)
+
+	existing := filepath.Join(out, "shop.Catalog", "Upload.json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(existing), 0o755))
+	require.NoError(t, os.WriteFile(existing, []byte(`{"service": "shop.Catalog", "method": "Upload", "output": {"data": {}}}`), 0o644))
+
+	written, err := srv.Scaffold(out)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(out, "shop.Catalog", "GetProduct.json"),
+		filepath.Join(out, "shop.Catalog", "WatchProducts.json"),
+	}, written)
+
+	unary, err := os.ReadFile(written[0])
+	require.NoError(t, err)
+	stream, err := os.ReadFile(written[1])
+	require.NoError(t, err)
+
+	assert.Contains(t, string(stream), `"stream": {`)
+	assert.Contains(t, string(unary), `"stock": "1"`)
+	assert.Contains(t, string(unary), `"price": 1.5`)
+	assert.Contains(t, string(unary), `"available": true`)
+	assert.Contains(t, string(unary), `"status": "STATUS_ACTIVE"`)
+	assert.Contains(t, string(unary), `"tags": [`)
+	assert.Contains(t, string(unary), `"counts": {`)
+	assert.Contains(t, string(unary), `"percent": 1`)
+	assert.NotContains(t, string(unary), `"amount"`)
+	assert.Contains(t, string(unary), `"createdAt": "2024-01-01T00:00:00Z"`)
+	assert.Contains(t, string(unary), `"attributes": {`)
+	assert.Contains(t, string(unary), `"parent": {`)
+	assert.Contains(t, string(unary), `"note": "note"`)
+
+	// The generated stubs load without validation errors.
+	_, err = grpcstub.NewService(protoDir, out, grpcstub.ServerOptions{})
+	require.NoError(t, err)
+}
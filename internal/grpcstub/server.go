@@ -4,19 +4,27 @@ package grpcstub
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"sort"
 	"strings"
 	"time"
 
+	"buf.build/go/protovalidate"
+	"github.com/randomenterprisesolutions/stub-server/internal/certs"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
 	grpcreflection "google.golang.org/grpc/reflection"
 	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/dynamicpb"
@@ -26,16 +34,25 @@ import (
 type Repository interface {
 	Add(stub ProtoStub)
 	Get(service string, method string) (Output, bool)
+	// Find returns the output of a stub whose matchers match the JSON
+	// encoded request and the client certificate, falling back to the stub
+	// without matchers.
+	Find(service string, method string, input []byte, cert *x509.Certificate) (Output, bool)
 }
 
 // GRPCService represents a gRPC service that can handle requests based on loaded stubs.
 type GRPCService struct {
-	stubs      Repository
-	sdMap      map[string]protoreflect.ServiceDescriptor
-	grpcServer *grpc.Server
-	files      *protoregistry.Files
-	types      *protoregistry.Types
+	stubs            Repository
+	sdMap            map[string]protoreflect.ServiceDescriptor
+	grpcServer       *grpc.Server
+	files            *protoregistry.Files
+	types            *protoregistry.Types
 	enableReflection bool
+	fakeResponses    bool
+	fakeSeed         int64
+	recorder         *recorder
+	proxy            *proxy
+	validator        protovalidate.Validator
 }
 
 // NewServer creates a new gRPC server, loads proto definitions from the
@@ -47,32 +64,118 @@ func NewServer(protoDir string, protoStubDir string) (*grpc.Server, error) {
 // ServerOptions controls optional gRPC server features.
 type ServerOptions struct {
 	EnableReflection bool
+	// FakeResponses synthesizes responses for methods without a stub instead
+	// of returning codes.NotFound.
+	FakeResponses bool
+	// FakeSeed seeds the generated fake values.
+	FakeSeed int64
+	// ValidateRequests checks request messages against the buf.validate
+	// constraints declared in the protos before matching stubs, and rejects
+	// invalid requests with codes.InvalidArgument.
+	ValidateRequests bool
+	// Proxy forwards calls without a stub to an upstream server per service,
+	// before recording or fake responses are considered.
+	Proxy []ProxyRoute
+	// RecordUpstream is the address of a gRPC server calls without a stub
+	// are forwarded to. The calls are recorded as stubs in the stub directory.
+	RecordUpstream string
+	// DescriptorSets lists FileDescriptorSet files to load in addition to the
+	// proto directory.
+	DescriptorSets []string
+	// ImportPaths lists additional proto import roots searched after the
+	// proto directory, like protoc's -I flag. Without a proto directory the
+	// first import path is used as such.
+	ImportPaths []string
+	// ProtoFiles restricts loading to these entry files, relative to an
+	// import path. All .proto files in the proto directory are loaded if
+	// empty; the other import paths only resolve imports.
+	ProtoFiles []string
+	// StubDirs lists additional stub directories loaded after the stub
+	// directory. Recorded stubs are written to the stub directory.
+	StubDirs []string
 }
 
 // NewServerWithOptions creates a new gRPC server with configurable options.
 func NewServerWithOptions(protoDir string, protoStubDir string, opts ServerOptions) (*grpc.Server, error) {
+	s, err := NewService(protoDir, protoStubDir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Server(), nil
+}
+
+// NewService creates a new GRPCService backed by a new gRPC server. Use it
+// instead of NewServerWithOptions when access to the loaded descriptors is
+// needed, e.g. to translate other protocols into gRPC calls.
+func NewService(protoDir string, protoStubDir string, opts ServerOptions) (*GRPCService, error) {
 	server := grpc.NewServer()
-	if err := registerServices(server, protoDir, protoStubDir, NewStorage(), opts); err != nil {
+	s, err := registerServices(server, protoDir, protoStubDir, NewStorage(), opts)
+	if err != nil {
 		return nil, fmt.Errorf("register services: %w", err)
 	}
 
-	return server, nil
+	return s, nil
+}
+
+// Server returns the gRPC server the stub services are registered with.
+func (s *GRPCService) Server() *grpc.Server {
+	return s.grpcServer
+}
+
+// FindMethod returns the descriptor of a registered method by its service and
+// method name.
+func (s *GRPCService) FindMethod(serviceName string, methodName string) (protoreflect.MethodDescriptor, bool) {
+	service, ok := s.sdMap[serviceName]
+	if !ok {
+		return nil, false
+	}
+
+	method := service.Methods().ByName(protoreflect.Name(methodName))
+	if method == nil {
+		return nil, false
+	}
+
+	return method, true
+}
+
+// Services returns the descriptors of all registered services sorted by name.
+func (s *GRPCService) Services() []protoreflect.ServiceDescriptor {
+	services := make([]protoreflect.ServiceDescriptor, 0, len(s.sdMap))
+	for _, sd := range s.sdMap {
+		services = append(services, sd)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].FullName() < services[j].FullName()
+	})
+	return services
 }
 
 // registerServices loads proto files from the specified protoDir, registers them with the provided
 // gRPC server, and loads stub definitions from the specified stubDir into the provided Repository.
-func registerServices(srv *grpc.Server, protoDir string, stubDir string, r Repository, opts ServerOptions) error {
+func registerServices(srv *grpc.Server, protoDir string, stubDir string, r Repository, opts ServerOptions) (*GRPCService, error) {
 	s := &GRPCService{
-		stubs:      r,
-		sdMap:      map[string]protoreflect.ServiceDescriptor{},
-		grpcServer: srv,
-		files:      &protoregistry.Files{},
-		types:      &protoregistry.Types{},
+		stubs:            r,
+		sdMap:            map[string]protoreflect.ServiceDescriptor{},
+		grpcServer:       srv,
+		files:            &protoregistry.Files{},
+		types:            &protoregistry.Types{},
 		enableReflection: opts.EnableReflection,
+		fakeResponses:    opts.FakeResponses,
+		fakeSeed:         opts.FakeSeed,
 	}
 
-	if err := s.registerTypes(protoDir); err != nil {
-		return fmt.Errorf("load protos from %v: %w", protoDir, err)
+	for _, set := range opts.DescriptorSets {
+		if err := s.registerDescriptorSet(set); err != nil {
+			return nil, fmt.Errorf("load descriptor set %v: %w", set, err)
+		}
+	}
+	importPaths := opts.ImportPaths
+	if protoDir != "" {
+		importPaths = append([]string{protoDir}, importPaths...)
+	}
+	if err := s.registerTypes(importPaths, opts.ProtoFiles); err != nil {
+		return nil, fmt.Errorf("load protos from %v: %w", strings.Join(importPaths, ", "), err)
 	}
 
 	s.registerServices()
@@ -80,11 +183,36 @@ func registerServices(srv *grpc.Server, protoDir string, stubDir string, r Repos
 		s.registerReflection()
 	}
 
-	if err := s.loadStubs(stubDir); err != nil {
-		return fmt.Errorf("load stubs from %v: %w", stubDir, err)
+	if opts.ValidateRequests {
+		v, err := s.newValidator()
+		if err != nil {
+			return nil, err
+		}
+		s.validator = v
 	}
 
-	return nil
+	for _, dir := range append([]string{stubDir}, opts.StubDirs...) {
+		if err := s.loadStubs(dir); err != nil {
+			return nil, fmt.Errorf("load stubs from %v: %w", dir, err)
+		}
+	}
+
+	if len(opts.Proxy) > 0 {
+		p, err := s.newProxy(opts.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("configure proxy: %w", err)
+		}
+		s.proxy = p
+	}
+	if opts.RecordUpstream != "" {
+		rec, err := newRecorder(opts.RecordUpstream, stubDir, s.stubs)
+		if err != nil {
+			return nil, fmt.Errorf("configure recording: %w", err)
+		}
+		s.recorder = rec
+	}
+
+	return s, nil
 }
 
 func (s *GRPCService) registerReflection() {
@@ -119,14 +247,27 @@ func (s *GRPCService) Handler(_ any, ctx context.Context, decode func(any) error
 		return nil, status.Error(codes.Unimplemented, "Method "+methodName+" not found")
 	}
 
-	// Decode to consume and validate the request payload even if we don't match on it.
 	input := dynamicpb.NewMessage(method.Input())
 	if err := decode(input); err != nil {
 		slog.ErrorContext(ctx, "Failed to decode input message", slog.String("error", err.Error()))
 		return nil, status.Error(codes.InvalidArgument, "Failed to decode input message")
 	}
+	if err := s.validateInput(ctx, input); err != nil {
+		return nil, err
+	}
 
-	resp, ok := s.stubs.Get(serviceName, methodName)
+	resp, ok := s.stubs.Find(serviceName, methodName, marshalRequest(input), clientCert(ctx))
+	if !ok {
+		if u, routed := s.proxy.route(ctx, method); routed {
+			return u.unary(ctx, method, input)
+		}
+	}
+	if !ok && s.recorder != nil {
+		return s.recorder.unary(ctx, method, input)
+	}
+	if !ok {
+		resp, ok = s.fakeResponse(ctx, method)
+	}
 	if !ok {
 		slog.ErrorContext(ctx, "No stub configured", slog.String("service", serviceName), slog.String("method", methodName))
 		return nil, status.Error(codes.NotFound, "No stub configured")
@@ -179,15 +320,37 @@ func (s *GRPCService) ServerStreamHandler(_ any, stream grpc.ServerStream) error
 		slog.ErrorContext(ctx, "Failed to receive input message", slog.String("error", err.Error()))
 		return status.Error(codes.InvalidArgument, "Failed to receive input message")
 	}
+	if err := s.validateInput(ctx, input); err != nil {
+		return err
+	}
 
-	jsonInput, err := protojson.Marshal(input)
+	jsonInput, err := requestOptions.Marshal(input)
 	if err != nil {
 		slog.Error("Failed to marshall input", slog.String("error", err.Error()))
 		return status.Error(codes.InvalidArgument, "Failed to marshall input")
 	}
 	slog.InfoContext(ctx, "Received message", slog.String("input", string(jsonInput)))
 
-	resp, ok := s.stubs.Get(serviceName, methodName)
+	resp, ok := s.stubs.Find(serviceName, methodName, jsonInput, clientCert(ctx))
+	if !ok {
+		if u, routed := s.proxy.route(ctx, method); routed {
+			if method.IsStreamingClient() {
+				_, _, err := u.bidiStream(stream, method, input)
+				return err
+			}
+			_, err := u.serverStream(stream, method, input)
+			return err
+		}
+	}
+	if !ok && s.recorder != nil {
+		if method.IsStreamingClient() {
+			return s.recorder.bidiStream(stream, method, input)
+		}
+		return s.recorder.serverStream(stream, method, input)
+	}
+	if !ok {
+		resp, ok = s.fakeResponse(ctx, method)
+	}
 	if !ok {
 		slog.ErrorContext(ctx, "No stub configured", slog.String("service", serviceName), slog.String("method", methodName))
 		return status.Error(codes.NotFound, "No stub configured")
@@ -215,9 +378,11 @@ func (s *GRPCService) ServerStreamHandler(_ any, stream grpc.ServerStream) error
 				}
 			}
 		}
-		return nil
 	}
 
+	if resp.Stream != nil && resp.Stream.Code != nil {
+		return status.Error(*resp.Stream.Code, resp.Stream.Error)
+	}
 	return nil
 }
 
@@ -245,11 +410,8 @@ func (s *GRPCService) ClientStreamHandler(_ any, stream grpc.ServerStream) error
 		return status.Error(codes.Unimplemented, "method "+methodName+" not found")
 	}
 
-	resp, ok := s.stubs.Get(serviceName, methodName)
-	if !ok {
-		return status.Error(codes.NotFound, "no stub found")
-	}
-
+	var inputs []proto.Message
+	var jsonInputs []json.RawMessage
 	for {
 		input := dynamicpb.NewMessage(method.Input())
 		if err := stream.RecvMsg(input); err != nil {
@@ -265,12 +427,38 @@ func (s *GRPCService) ClientStreamHandler(_ any, stream grpc.ServerStream) error
 			slog.ErrorContext(ctx, "Failed to receive input message", slog.String("error", err.Error()))
 			return status.Error(codes.InvalidArgument, "failed to receive input message")
 		}
-		jsonInput, err := protojson.Marshal(input)
+		if err := s.validateInput(ctx, input); err != nil {
+			return err
+		}
+		jsonInput, err := requestOptions.Marshal(input)
 		if err != nil {
 			slog.Error("Failed to marshall input", slog.String("error", err.Error()))
 			return status.Error(codes.InvalidArgument, "failed to marshall input")
 		}
 		slog.InfoContext(ctx, "Received message", slog.String("input", string(jsonInput)))
+		inputs = append(inputs, input)
+		jsonInputs = append(jsonInputs, jsonInput)
+	}
+
+	allInputs, _ := json.Marshal(jsonInputs)
+	resp, ok := s.stubs.Find(serviceName, methodName, allInputs, clientCert(ctx))
+	if !ok {
+		if u, routed := s.proxy.route(ctx, method); routed {
+			output, err := u.clientStream(stream, method, inputs)
+			if err != nil {
+				return err
+			}
+			return stream.SendMsg(output)
+		}
+	}
+	if !ok && s.recorder != nil {
+		return s.recorder.clientStream(stream, method, inputs)
+	}
+	if !ok {
+		resp, ok = s.fakeResponse(ctx, method)
+	}
+	if !ok {
+		return status.Error(codes.NotFound, "no stub found")
 	}
 
 	if resp.Data != nil {
@@ -301,6 +489,36 @@ func (s *GRPCService) ClientStreamHandler(_ any, stream grpc.ServerStream) error
 	return nil
 }
 
+// fakeResponse synthesizes an output for a method without a stub if fake
+// responses are enabled.
+func (s *GRPCService) fakeResponse(ctx context.Context, md protoreflect.MethodDescriptor) (Output, bool) {
+	if !s.fakeResponses {
+		return Output{}, false
+	}
+
+	out, err := s.fakeOutput(md)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to generate fake response", slog.String("error", err.Error()))
+		return Output{}, false
+	}
+	slog.InfoContext(ctx, "No stub configured, sending fake response", slog.String("method", string(md.FullName())))
+	return out, true
+}
+
+// clientCert returns the certificate the client authenticated with over
+// mutual TLS, or nil.
+func clientCert(ctx context.Context) *x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
+	}
+	return certs.Peer(&info.State)
+}
+
 func parseGRPCMethod(fullMethod string) (string, string, error) {
 	parts := strings.Split(fullMethod, "/")
 	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
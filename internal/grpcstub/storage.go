@@ -1,11 +1,16 @@
 package grpcstub
 
-import "sync"
+import (
+	"crypto/x509"
+	"encoding/json"
+	"reflect"
+	"sync"
+)
 
 // Storage is an in-memory storage for gRPC stubs.
 type Storage struct {
 	// represents [serviceName][methodName]
-	stubs map[string]map[string]Output
+	stubs map[string]map[string][]ProtoStub
 
 	m sync.Mutex
 }
@@ -15,7 +20,7 @@ var _ Repository = &Storage{}
 // NewStorage creates a new instance of Storage.
 func NewStorage() *Storage {
 	return &Storage{
-		stubs: map[string]map[string]Output{},
+		stubs: map[string]map[string][]ProtoStub{},
 		m:     sync.Mutex{},
 	}
 }
@@ -26,20 +31,87 @@ func (p *Storage) Add(s ProtoStub) {
 	defer p.m.Unlock()
 
 	if p.stubs[s.Service] == nil {
-		p.stubs[s.Service] = map[string]Output{}
+		p.stubs[s.Service] = map[string][]ProtoStub{}
 	}
-	p.stubs[s.Service][s.Method] = s.Output
+	p.stubs[s.Service][s.Method] = append(p.stubs[s.Service][s.Method], s)
 }
 
-// Get retrieves the Output for a given service and method.
+// Get retrieves the Output of the last added stub without input matcher for a
+// given service and method.
 func (p *Storage) Get(service string, method string) (Output, bool) {
+	return p.Find(service, method, nil, nil)
+}
+
+// Find retrieves the Output for a given service and method whose input and
+// client certificate matchers match the JSON encoded request and the
+// certificate of the client, which may be nil. The first stub with matching
+// matchers is preferred over the last added stub without matchers.
+func (p *Storage) Find(service string, method string, input []byte, cert *x509.Certificate) (Output, bool) {
 	p.m.Lock()
 	defer p.m.Unlock()
 
-	s, ok := p.stubs[service][method]
-	if !ok {
+	var request any
+	if input != nil {
+		if err := json.Unmarshal(input, &request); err != nil {
+			request = nil
+		}
+	}
+
+	var fallback *ProtoStub
+	for i, s := range p.stubs[service][method] {
+		if s.Input == nil && s.ClientCert == nil {
+			fallback = &p.stubs[service][method][i]
+			continue
+		}
+		if !s.ClientCert.Matches(cert) {
+			continue
+		}
+		if s.Input == nil {
+			return s.Output, true
+		}
+		if request == nil {
+			continue
+		}
+		var want any
+		if err := json.Unmarshal(s.Input, &want); err == nil && jsonContains(request, want) {
+			return s.Output, true
+		}
+	}
+
+	if fallback == nil {
 		return Output{}, false
 	}
+	return fallback.Output, true
+}
 
-	return s, true
+// jsonContains reports whether got contains want. Objects match if every
+// field of want is contained in got, arrays if they have the same length and
+// contain each other element-wise, and other values if they are equal.
+func jsonContains(got any, want any) bool {
+	switch want := want.(type) {
+	case map[string]any:
+		got, ok := got.(map[string]any)
+		if !ok {
+			return false
+		}
+		for k, v := range want {
+			if !jsonContains(got[k], v) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		got, ok := got.([]any)
+		if !ok || len(got) != len(want) {
+			return false
+		}
+		for i := range want {
+			if !jsonContains(got[i], want[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(got, want)
+	}
 }
@@ -1,11 +1,14 @@
 package grpcstub
 
 import (
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/randomenterprisesolutions/stub-server/internal/certs"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc/codes"
 )
@@ -31,6 +34,73 @@ func TestStorageAddGet(t *testing.T) {
 	require.False(t, ok)
 }
 
+func TestStorageFind(t *testing.T) {
+	storage := NewStorage()
+	storage.Add(ProtoStub{Service: "svc", Method: "Get", Output: Output{Error: "first fallback"}})
+	storage.Add(ProtoStub{Service: "svc", Method: "Get", Input: json.RawMessage(`{"name":"a"}`), Output: Output{Error: "a"}})
+	storage.Add(ProtoStub{Service: "svc", Method: "Get", Input: json.RawMessage(`{"tags":["x","y"]}`), Output: Output{Error: "tags"}})
+	storage.Add(ProtoStub{Service: "svc", Method: "Get", Output: Output{Error: "fallback"}})
+
+	cases := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "matching field", input: `{"name":"a","id":1}`, want: "a"},
+		{name: "matching array", input: `{"tags":["x","y"]}`, want: "tags"},
+		{name: "array of different length", input: `{"tags":["x"]}`, want: "fallback"},
+		{name: "no match", input: `{"name":"b"}`, want: "fallback"},
+		{name: "no input", want: "fallback"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var input []byte
+			if tc.input != "" {
+				input = []byte(tc.input)
+			}
+			out, ok := storage.Find("svc", "Get", input, nil)
+			require.True(t, ok)
+			require.Equal(t, tc.want, out.Error)
+		})
+	}
+
+	storage = NewStorage()
+	storage.Add(ProtoStub{Service: "svc", Method: "Get", Input: json.RawMessage(`{"name":"a"}`), Output: Output{Error: "a"}})
+	_, ok := storage.Find("svc", "Get", []byte(`{"name":"b"}`), nil)
+	require.False(t, ok)
+}
+
+func TestStorageFindClientCert(t *testing.T) {
+	storage := NewStorage()
+	storage.Add(ProtoStub{Service: "svc", Method: "Get", ClientCert: &certs.Matcher{Subject: "alice"}, Input: json.RawMessage(`{"name":"a"}`), Output: Output{Error: "alice a"}})
+	storage.Add(ProtoStub{Service: "svc", Method: "Get", ClientCert: &certs.Matcher{SAN: "bob@example.com"}, Output: Output{Error: "bob"}})
+	storage.Add(ProtoStub{Service: "svc", Method: "Get", Output: Output{Error: "fallback"}})
+
+	alice := &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}}
+	bob := &x509.Certificate{Subject: pkix.Name{CommonName: "bob"}, EmailAddresses: []string{"bob@example.com"}}
+
+	cases := []struct {
+		name  string
+		input string
+		cert  *x509.Certificate
+		want  string
+	}{
+		{name: "subject and input", input: `{"name":"a"}`, cert: alice, want: "alice a"},
+		{name: "subject without input match", input: `{"name":"b"}`, cert: alice, want: "fallback"},
+		{name: "san", input: `{"name":"a"}`, cert: bob, want: "bob"},
+		{name: "no certificate", input: `{"name":"a"}`, want: "fallback"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, ok := storage.Find("svc", "Get", []byte(tc.input), tc.cert)
+			require.True(t, ok)
+			require.Equal(t, tc.want, out.Error)
+		})
+	}
+}
+
 func TestStreamValidate(t *testing.T) {
 	cases := []struct {
 		name    string
@@ -122,9 +192,41 @@ func TestLoadFile(t *testing.T) {
 }`
 	require.NoError(t, os.WriteFile(stubPath, []byte(payload), 0o644))
 
-	stub, err := loadFile(stubPath)
+	files, err := loadFile(stubPath)
 	require.NoError(t, err)
+	require.Len(t, files, 1)
+	stub := files[0].stub
 	require.Equal(t, "svc", stub.Service)
 	require.Equal(t, "Get", stub.Method)
 	require.Equal(t, "boom", stub.Output.Error)
 }
+
+func TestLoadFileYAML(t *testing.T) {
+	root := t.TempDir()
+	stubPath := filepath.Join(root, "stubs.yaml")
+	payload := `service: svc
+method: Get
+output:
+  data: {name: first}
+---
+service: svc
+method: List
+output:
+  stream:
+    data:
+      - {name: a}
+      - {name: b}
+---
+service: svc
+output: {error: boom}
+`
+	require.NoError(t, os.WriteFile(stubPath, []byte(payload), 0o644))
+
+	files, err := loadFile(stubPath)
+	require.ErrorContains(t, err, stubPath+":14: document 3: stub validation")
+	require.Len(t, files, 2)
+	require.Equal(t, "Get", files[0].stub.Method)
+	require.JSONEq(t, `{"name": "first"}`, string(files[0].stub.Output.Data))
+	require.Equal(t, "List", files[1].stub.Method)
+	require.Len(t, files[1].stub.Output.Stream.Data, 2)
+}
@@ -1,19 +1,27 @@
 package grpcstub
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 
+	"github.com/randomenterprisesolutions/stub-server/internal/certs"
+	"github.com/randomenterprisesolutions/stub-server/internal/diag"
+	"github.com/randomenterprisesolutions/stub-server/internal/stubfile"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
 )
 
 // Stream represents a stream of gRPC responses.
 type Stream struct {
-	Data  []json.RawMessage `json:"data"`
-	Error string            `json:"error"`
+	Data  []json.RawMessage `json:"data,omitempty"`
+	Error string            `json:"error,omitempty"`
 	Code  *codes.Code       `json:"code,omitempty"`
 	Delay int               `json:"delay,omitempty"`
 }
@@ -27,10 +35,10 @@ func (s *Stream) validate() error {
 
 // Output represents the output of a gRPC method, which can be a single response or a stream.
 type Output struct {
-	Data   json.RawMessage `json:"data"`
-	Error  string          `json:"error"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Error  string          `json:"error,omitempty"`
 	Code   *codes.Code     `json:"code,omitempty"`
-	Stream *Stream         `json:"stream"`
+	Stream *Stream         `json:"stream,omitempty"`
 }
 
 func (o *Output) validate() error {
@@ -44,12 +52,18 @@ func (o *Output) validate() error {
 	return nil
 }
 
-// ProtoStub represents a gRPC stub definition.
+// ProtoStub represents a gRPC stub definition. If Input is set the stub is
+// only used for requests containing all of its fields. For client streaming
+// methods Input is an array matched against all received messages.
+// ClientCert restricts the stub to clients authenticated with a matching
+// certificate.
 type ProtoStub struct {
-	Service string `json:"service"`
-	Method  string `json:"method"`
-	Matcher string `json:"matcher"`
-	Output  Output `json:"output"`
+	Service    string          `json:"service"`
+	Method     string          `json:"method"`
+	Matcher    string          `json:"matcher,omitempty"`
+	Input      json.RawMessage `json:"input,omitempty"`
+	ClientCert *certs.Matcher  `json:"clientCert,omitempty"`
+	Output     Output          `json:"output"`
 }
 
 func (s *ProtoStub) validate() error {
@@ -63,67 +77,243 @@ func (s *ProtoStub) validate() error {
 	return s.Output.validate()
 }
 
+// loadStubs loads all stubs from dir and validates them against the registered
+// descriptors. Errors of all stub files are reported at once.
 func (s *GRPCService) loadStubs(dir string) error {
+	if dir == "" {
+		return nil
+	}
+
+	var errs []error
 	stubs, err := load(dir)
 	if err != nil {
-		return fmt.Errorf("load stubs: %w", err)
+		errs = append(errs, fmt.Errorf("load stubs: %w", err))
 	}
 
-	for _, stub := range stubs {
-		if s.sdMap[stub.Service] == nil {
-			return fmt.Errorf(`no service "%v" registered`, stub.Service)
+	for _, f := range stubs {
+		if err := s.validateStub(&f.stub); err != nil {
+			errs = append(errs, f.doc.Locate(f.path, err))
+			continue
 		}
-		s.stubs.Add(stub)
+		s.stubs.Add(f.stub)
 	}
 
-	return nil
+	return errors.Join(errs...)
+}
+
+// validateStub checks that the stub's method exists, that the output matches
+// the streaming shape of the method and that all payloads unmarshal into the
+// input and output messages. The input matcher is normalized to the JSON
+// encoding of requests.
+func (s *GRPCService) validateStub(stub *ProtoStub) error {
+	sd := s.sdMap[stub.Service]
+	if sd == nil {
+		return diag.Field("service", fmt.Errorf(`no service "%v" registered`, stub.Service))
+	}
+	md := sd.Methods().ByName(protoreflect.Name(stub.Method))
+	if md == nil {
+		return diag.Field("method", fmt.Errorf(`no method "%v" in service "%v"`, stub.Method, stub.Service))
+	}
+
+	var errs []error
+	if stub.ClientCert != nil {
+		if err := stub.ClientCert.Validate(); err != nil {
+			errs = append(errs, diag.Field("clientCert", fmt.Errorf("client certificate matcher: %w", err)))
+		}
+	}
+	if stub.Input != nil {
+		input, err := normalizeInput(md, stub.Input)
+		if err != nil {
+			errs = append(errs, diag.Field("input", err))
+		}
+		stub.Input = input
+	}
+	if md.IsStreamingServer() {
+		if stub.Output.Data != nil {
+			errs = append(errs, diag.Field("data", errors.New(`"output.data" is not supported for server streaming methods, use "output.stream"`)))
+		}
+	} else if stub.Output.Stream != nil {
+		errs = append(errs, diag.Field("stream", errors.New(`"output.stream" is only supported for server streaming methods`)))
+	}
+
+	if stub.Output.Data != nil {
+		if err := protojson.Unmarshal(stub.Output.Data, dynamicpb.NewMessage(md.Output())); err != nil {
+			errs = append(errs, diag.Field("data", fmt.Errorf(`"output.data" is not a valid %v: %w`, md.Output().FullName(), err)))
+		}
+	}
+	if stub.Output.Stream != nil {
+		for i, d := range stub.Output.Stream.Data {
+			if err := protojson.Unmarshal(d, dynamicpb.NewMessage(md.Output())); err != nil {
+				errs = append(errs, diag.Field("stream", fmt.Errorf(`"output.stream.data[%d]" is not a valid %v: %w`, i, md.Output().FullName(), err)))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// normalizeInput re-encodes an input matcher the way requests are encoded so
+// that field names in either JSON or proto form match.
+func normalizeInput(md protoreflect.MethodDescriptor, input json.RawMessage) (json.RawMessage, error) {
+	if !md.IsStreamingClient() || md.IsStreamingServer() {
+		b, err := normalizeMessage(md.Input(), input)
+		if err != nil {
+			return nil, fmt.Errorf(`"input" is not a valid %v: %w`, md.Input().FullName(), err)
+		}
+		return b, nil
+	}
+
+	var inputs []json.RawMessage
+	if err := json.Unmarshal(input, &inputs); err != nil {
+		return nil, fmt.Errorf(`"input" of client streaming method must be an array: %w`, err)
+	}
+	normalized := make([]json.RawMessage, 0, len(inputs))
+	for i, in := range inputs {
+		b, err := normalizeMessage(md.Input(), in)
+		if err != nil {
+			return nil, fmt.Errorf(`"input[%d]" is not a valid %v: %w`, i, md.Input().FullName(), err)
+		}
+		normalized = append(normalized, b)
+	}
+	return json.Marshal(normalized)
 }
 
-func load(dir string) ([]ProtoStub, error) {
-	stubs := make([]ProtoStub, 0)
+// normalizeMessage re-encodes a message matcher like marshalRequest, keeping
+// only the fields present in the matcher. Fields set to their zero value are
+// kept, so they only match requests with the zero value.
+func normalizeMessage(md protoreflect.MessageDescriptor, input json.RawMessage) (json.RawMessage, error) {
+	msg := dynamicpb.NewMessage(md)
+	if err := protojson.Unmarshal(input, msg); err != nil {
+		return nil, err
+	}
+	b, err := requestOptions.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var encoded, given any
+	if err := json.Unmarshal(b, &encoded); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(input, &given); err != nil {
+		return nil, err
+	}
+	return json.Marshal(matcherFields(md, encoded, given))
+}
+
+// matcherFields returns the fields of the encoded message that are present
+// in the matcher given. Well-known types have their own JSON form and are
+// kept whole.
+func matcherFields(md protoreflect.MessageDescriptor, encoded any, given any) any {
+	fields, ok := encoded.(map[string]any)
+	matcher, gok := given.(map[string]any)
+	if !ok || !gok || md.FullName().Parent() == "google.protobuf" {
+		return encoded
+	}
+
+	out := make(map[string]any, len(matcher))
+	for key, g := range matcher {
+		fd := md.Fields().ByJSONName(key)
+		if fd == nil {
+			fd = md.Fields().ByTextName(key)
+		}
+		if fd == nil {
+			// Extensions and the like are encoded under their given key.
+			if v, ok := fields[key]; ok {
+				out[key] = v
+			}
+			continue
+		}
+
+		v := fields[fd.JSONName()]
+		switch {
+		case fd.IsMap() || fd.Message() == nil:
+		case fd.IsList():
+			list, _ := v.([]any)
+			givenList, _ := g.([]any)
+			if len(list) == len(givenList) {
+				for i := range list {
+					list[i] = matcherFields(fd.Message(), list[i], givenList[i])
+				}
+			}
+		default:
+			v = matcherFields(fd.Message(), v, g)
+		}
+		out[fd.JSONName()] = v
+	}
+	return out
+}
+
+// requestOptions encode requests for matching. Unpopulated fields are
+// emitted, so that matchers for zero values don't match every request.
+var requestOptions = protojson.MarshalOptions{EmitUnpopulated: true}
+
+// marshalRequest encodes a request message for matching and recording.
+func marshalRequest(msg proto.Message) json.RawMessage {
+	b, err := requestOptions.Marshal(msg)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// stubFile is a stub together with the file it was loaded from.
+type stubFile struct {
+	path string
+	doc  stubfile.Document
+	stub ProtoStub
+}
+
+// load reads all stub files in dir. Stubs that fail to load are skipped and
+// their errors are returned joined after the walk.
+func load(dir string) ([]stubFile, error) {
+	stubs := make([]stubFile, 0)
+	var errs []error
 	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 		if !d.IsDir() {
-			if filepath.Ext(path) != ".json" {
+			if !stubfile.IsStubFile(path) {
 				return nil
 			}
 
-			stub, err := loadFile(path)
+			files, err := loadFile(path)
 			if err != nil {
-				return fmt.Errorf("load stub from file %v: %w", path, err)
+				errs = append(errs, err)
 			}
-
-			stubs = append(stubs, stub)
+			stubs = append(stubs, files...)
 		}
 		return nil
 	})
 	if err != nil {
 		return nil, fmt.Errorf(`read dir "%v": %w`, dir, err)
 	}
-	return stubs, nil
+	return stubs, errors.Join(errs...)
 }
 
-func loadFile(path string) (s ProtoStub, err error) {
-	f, err := os.Open(path)
+// loadFile loads the stubs of a JSON or YAML file. Stubs that fail to load
+// are skipped and their errors returned joined.
+func loadFile(path string) ([]stubFile, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return ProtoStub{}, fmt.Errorf("open file: %v: %w", path, err)
-	}
-	defer func() {
-		closeErr := f.Close()
-		if closeErr != nil {
-			err = errors.Join(err, fmt.Errorf("close file: %w", closeErr))
-		}
-	}()
-
-	var stub ProtoStub
-	if err := json.NewDecoder(f).Decode(&stub); err != nil {
-		return ProtoStub{}, fmt.Errorf("unmarshal stub %v: %w", path, err)
+		return nil, fmt.Errorf("open file: %v: %w", path, err)
 	}
 
-	if err := stub.validate(); err != nil {
-		return ProtoStub{}, fmt.Errorf("stub validation %v: %w", path, err)
+	docs, err := stubfile.Split(path, data)
+	errs := []error{err}
+	var stubs []stubFile
+	for _, doc := range docs {
+		var stub ProtoStub
+		if err := json.NewDecoder(bytes.NewReader(doc.Data)).Decode(&stub); err != nil {
+			errs = append(errs, doc.Locate(path, fmt.Errorf("unmarshal stub: %w", err)))
+			continue
+		}
+		if err := stub.validate(); err != nil {
+			errs = append(errs, doc.Locate(path, fmt.Errorf("stub validation: %w", err)))
+			continue
+		}
+		stubs = append(stubs, stubFile{path: path, doc: doc, stub: stub})
 	}
-	return stub, nil
+	return stubs, errors.Join(errs...)
 }
@@ -0,0 +1,143 @@
+package grpcstub_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/grpcstub"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const streamProto = `syntax = "proto3";
+package streams;
+
+service Streams {
+  rpc Get(Item) returns (Item);
+  rpc Watch(Item) returns (stream Item);
+}
+
+message Item {
+  string name = 1;
+}
+`
+
+func TestStubValidationReportsAllErrors(t *testing.T) {
+	t.Parallel()
+
+	protoDir, stubDir := setupProtoAndStub(t, "streams", streamProto, `{
+  "service": "streams.Streams",
+  "method": "Get",
+  "output": {"data": {"name": "ok"}}
+}`)
+
+	invalid := map[string]string{
+		"unknown_method.json": `{"service": "streams.Streams", "method": "Gett", "output": {"data": {}}}`,
+		"unknown_field.json":  `{"service": "streams.Streams", "method": "Get", "output": {"data": {"nme": "x"}}}`,
+		"unary_stream.json":   `{"service": "streams.Streams", "method": "Get", "output": {"stream": {"data": [{}]}}}`,
+		"stream_data.json":    `{"service": "streams.Streams", "method": "Watch", "output": {"data": {}}}`,
+		"stream_field.json":   `{"service": "streams.Streams", "method": "Watch", "output": {"stream": {"data": [{"name": "a"}, {"name": 1}]}}}`,
+		"bad_input.json":      `{"service": "streams.Streams", "method": "Get", "input": {"nme": "x"}, "output": {"data": {}}}`,
+		"broken.json":         `{"service": `,
+	}
+	for name, content := range invalid {
+		require.NoError(t, os.WriteFile(filepath.Join(stubDir, name), []byte(content), 0o644))
+	}
+
+	_, err := grpcstub.NewServer(protoDir, stubDir)
+	require.Error(t, err)
+
+	for name := range invalid {
+		require.ErrorContains(t, err, filepath.Join(stubDir, name))
+	}
+	require.ErrorContains(t, err, `no method "Gett" in service "streams.Streams"`)
+	require.ErrorContains(t, err, `"output.data" is not a valid streams.Item`)
+	require.ErrorContains(t, err, `"output.stream" is only supported for server streaming methods`)
+	require.ErrorContains(t, err, `"output.data" is not supported for server streaming methods`)
+	require.ErrorContains(t, err, `"output.stream.data[1]" is not a valid streams.Item`)
+	require.ErrorContains(t, err, `"input" is not a valid streams.Item`)
+	require.NotContains(t, err.Error(), "streams.json")
+}
+
+const flagsProto = `syntax = "proto3";
+package flags;
+
+service Flags {
+  rpc Get(Request) returns (Reply);
+}
+
+message Request {
+  string name = 1;
+  bool is_active = 2;
+  Filter filter = 3;
+}
+
+message Filter {
+  int32 min = 1;
+  string label = 2;
+}
+
+message Reply {
+  string stub = 1;
+}
+`
+
+func TestInputMatcherZeroValues(t *testing.T) {
+	t.Parallel()
+
+	protoDir, stubDir := setupProtoAndStub(t, "flags", flagsProto, `{
+  "service": "flags.Flags",
+  "method": "Get",
+  "output": {"data": {"stub": "fallback"}}
+}`)
+	stubs := map[string]string{
+		"a_unnamed.json":  `{"service": "flags.Flags", "method": "Get", "input": {"name": "", "is_active": true}, "output": {"data": {"stub": "unnamed"}}}`,
+		"b_inactive.json": `{"service": "flags.Flags", "method": "Get", "input": {"isActive": false, "filter": {"min": 0}}, "output": {"data": {"stub": "inactive"}}}`,
+	}
+	for name, content := range stubs {
+		require.NoError(t, os.WriteFile(filepath.Join(stubDir, name), []byte(content), 0o644))
+	}
+
+	svc, err := grpcstub.NewService(protoDir, stubDir, grpcstub.ServerOptions{})
+	require.NoError(t, err)
+	method, ok := svc.FindMethod("flags.Flags", "Get")
+	require.True(t, ok)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = svc.Server().Serve(listener)
+	}()
+	t.Cleanup(svc.Server().Stop)
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	cases := []struct {
+		input string
+		want  string
+	}{
+		{input: `{"isActive": true}`, want: "unnamed"},
+		{input: `{"isActive": true, "name": "x"}`, want: "fallback"},
+		{input: `{"name": "x", "filter": {"label": "l"}}`, want: "inactive"},
+		{input: `{"name": "x", "filter": {"min": 3}}`, want: "fallback"},
+		{input: `{"name": "x"}`, want: "fallback"},
+	}
+	for _, tc := range cases {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		req := dynamicpb.NewMessage(method.Input())
+		require.NoError(t, protojson.Unmarshal([]byte(tc.input), req))
+		resp := dynamicpb.NewMessage(method.Output())
+		require.NoError(t, conn.Invoke(ctx, "/flags.Flags/Get", req, resp))
+		cancel()
+		b, err := protojson.Marshal(resp)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"stub": "`+tc.want+`"}`, string(b), tc.input)
+	}
+}
@@ -0,0 +1,221 @@
+package grpcstub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// errRelay marks errors sending an upstream response to the client. The
+// upstream call itself didn't fail.
+var errRelay = errors.New("relay upstream response")
+
+// upstream forwards calls to another gRPC server using the descriptors of the
+// called method, so no generated code is needed.
+type upstream struct {
+	conn *grpc.ClientConn
+	// setMetadata overrides request metadata sent to the upstream.
+	setMetadata map[string]string
+	// removeMetadata lists request metadata keys not sent to the upstream.
+	removeMetadata []string
+}
+
+func newUpstream(target string) (*upstream, error) {
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("create upstream client for %v: %w", target, err)
+	}
+	return &upstream{conn: conn}, nil
+}
+
+// unary forwards a unary call and relays the response headers and trailers.
+func (u *upstream) unary(ctx context.Context, md protoreflect.MethodDescriptor, input proto.Message) (proto.Message, error) {
+	output := dynamicpb.NewMessage(md.Output())
+	var header, trailer metadata.MD
+	err := u.conn.Invoke(u.outgoingContext(ctx), fullMethodName(md), input, output, grpc.Header(&header), grpc.Trailer(&trailer))
+	_ = grpc.SetHeader(ctx, header)
+	_ = grpc.SetTrailer(ctx, trailer)
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// serverStream forwards a server or bidirectional streaming call with a single
+// request message and relays the responses. It returns the relayed responses
+// and the status of the upstream call.
+func (u *upstream) serverStream(stream grpc.ServerStream, md protoreflect.MethodDescriptor, input proto.Message) ([]proto.Message, error) {
+	ctx := stream.Context()
+	desc := &grpc.StreamDesc{ServerStreams: true, ClientStreams: md.IsStreamingClient()}
+	up, err := u.conn.NewStream(u.outgoingContext(ctx), desc, fullMethodName(md))
+	if err != nil {
+		return nil, err
+	}
+	if err := up.SendMsg(input); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if err := up.CloseSend(); err != nil {
+		return nil, err
+	}
+	if header, err := up.Header(); err == nil && len(header) > 0 {
+		_ = stream.SendHeader(header)
+	}
+
+	var outputs []proto.Message
+	for {
+		output := dynamicpb.NewMessage(md.Output())
+		if err = up.RecvMsg(output); err != nil {
+			break
+		}
+		if err := stream.SendMsg(output); err != nil {
+			return outputs, fmt.Errorf("%w: %w", errRelay, err)
+		}
+		outputs = append(outputs, output)
+	}
+	stream.SetTrailer(up.Trailer())
+
+	if errors.Is(err, io.EOF) {
+		return outputs, nil
+	}
+	return outputs, err
+}
+
+// bidiStream forwards a bidirectional streaming call whose first request
+// message has already been received. Request and response messages are
+// relayed concurrently until the upstream ends the call; the client closing
+// its side is forwarded as a half-close. It returns the relayed responses,
+// the number of forwarded request messages and the status of the upstream
+// call.
+func (u *upstream) bidiStream(stream grpc.ServerStream, md protoreflect.MethodDescriptor, first proto.Message) ([]proto.Message, int, error) {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	desc := &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}
+	up, err := u.conn.NewStream(u.outgoingContext(ctx), desc, fullMethodName(md))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var sent atomic.Int64
+	go func() {
+		input := first
+		for {
+			if err := up.SendMsg(input); err != nil {
+				// The upstream ended the call, its status is reported by
+				// RecvMsg.
+				return
+			}
+			sent.Add(1)
+			input = dynamicpb.NewMessage(md.Input())
+			if err := stream.RecvMsg(input); err != nil {
+				if errors.Is(err, io.EOF) {
+					_ = up.CloseSend()
+				} else {
+					cancel()
+				}
+				return
+			}
+		}
+	}()
+
+	if header, err := up.Header(); err == nil && len(header) > 0 {
+		_ = stream.SendHeader(header)
+	}
+	var outputs []proto.Message
+	for {
+		output := dynamicpb.NewMessage(md.Output())
+		if err = up.RecvMsg(output); err != nil {
+			break
+		}
+		if err := stream.SendMsg(output); err != nil {
+			return outputs, int(sent.Load()), fmt.Errorf("%w: %w", errRelay, err)
+		}
+		outputs = append(outputs, output)
+	}
+	stream.SetTrailer(up.Trailer())
+
+	if errors.Is(err, io.EOF) {
+		return outputs, int(sent.Load()), nil
+	}
+	return outputs, int(sent.Load()), err
+}
+
+// clientStream forwards the request messages of a client streaming call and
+// returns the response. The response isn't sent to the client.
+func (u *upstream) clientStream(stream grpc.ServerStream, md protoreflect.MethodDescriptor, inputs []proto.Message) (proto.Message, error) {
+	ctx := stream.Context()
+	up, err := u.conn.NewStream(u.outgoingContext(ctx), &grpc.StreamDesc{ClientStreams: true}, fullMethodName(md))
+	if err != nil {
+		return nil, err
+	}
+
+	output := dynamicpb.NewMessage(md.Output())
+	err = func() error {
+		for _, input := range inputs {
+			if err := up.SendMsg(input); err != nil {
+				return err
+			}
+		}
+		if err := up.CloseSend(); err != nil {
+			return err
+		}
+		return up.RecvMsg(output)
+	}()
+	if errors.Is(err, io.EOF) {
+		// SendMsg returns io.EOF if the upstream ended the call; the status
+		// is reported by RecvMsg.
+		err = up.RecvMsg(output)
+	}
+	if header, headerErr := up.Header(); headerErr == nil && len(header) > 0 {
+		_ = stream.SendHeader(header)
+	}
+	stream.SetTrailer(up.Trailer())
+
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// outgoingContext forwards the incoming metadata except for headers set by
+// the transport, and applies the configured metadata rewrites.
+func (u *upstream) outgoingContext(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	out := metadata.MD{}
+	for k, v := range md {
+		if strings.HasPrefix(k, ":") || k == "content-type" || k == "user-agent" || strings.HasPrefix(k, "grpc-") {
+			continue
+		}
+		out[k] = v
+	}
+	for _, k := range u.removeMetadata {
+		delete(out, strings.ToLower(k))
+	}
+	for k, v := range u.setMetadata {
+		out.Set(k, v)
+	}
+	return metadata.NewOutgoingContext(ctx, out)
+}
+
+func fullMethodName(md protoreflect.MethodDescriptor) string {
+	return "/" + string(md.Parent().FullName()) + "/" + string(md.Name())
+}
+
+func marshalInputs(inputs []proto.Message) json.RawMessage {
+	raw := make([]json.RawMessage, 0, len(inputs))
+	for _, input := range inputs {
+		raw = append(raw, marshalRequest(input))
+	}
+	b, _ := json.Marshal(raw)
+	return b
+}
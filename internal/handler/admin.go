@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Metrics counts the requests served by each listener.
+type Metrics struct {
+	mu       sync.Mutex
+	requests map[requestKey]uint64
+	calls    map[callKey]uint64
+}
+
+type requestKey struct {
+	listener string
+	code     int
+}
+
+type callKey struct {
+	listener string
+	method   string
+	code     string
+}
+
+// NewMetrics creates empty Metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests: map[requestKey]uint64{},
+		calls:    map[callKey]uint64{},
+	}
+}
+
+// Instrument counts the requests handled by next under the listener label.
+// Native gRPC calls are additionally counted by method and status code.
+func (m *Metrics) Instrument(listener string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.requests[requestKey{listener: listener, code: status}]++
+		if isGRPCRequest(r) {
+			code := w.Header().Get("Grpc-Status")
+			if code == "" {
+				code = "unknown"
+			}
+			m.calls[callKey{listener: listener, method: r.URL.Path, code: code}]++
+		}
+	})
+}
+
+// ServeHTTP writes the counters in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	m.mu.Lock()
+	requests := make([]string, 0, len(m.requests))
+	for k, v := range m.requests {
+		requests = append(requests, fmt.Sprintf("stub_server_requests_total{listener=%q,code=%q} %d\n", k.listener, strconv.Itoa(k.code), v))
+	}
+	calls := make([]string, 0, len(m.calls))
+	for k, v := range m.calls {
+		calls = append(calls, fmt.Sprintf("stub_server_grpc_calls_total{listener=%q,method=%q,code=%q} %d\n", k.listener, k.method, k.code, v))
+	}
+	m.mu.Unlock()
+	sort.Strings(requests)
+	sort.Strings(calls)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprintln(w, "# HELP stub_server_requests_total Requests served by listener and HTTP status code.")
+	fmt.Fprintln(w, "# TYPE stub_server_requests_total counter")
+	for _, line := range requests {
+		fmt.Fprint(w, line)
+	}
+	fmt.Fprintln(w, "# HELP stub_server_grpc_calls_total Native gRPC calls served by listener, method and gRPC status code.")
+	fmt.Fprintln(w, "# TYPE stub_server_grpc_calls_total counter")
+	for _, line := range calls {
+		fmt.Fprint(w, line)
+	}
+}
+
+// adminHandler serves /healthz and /metrics.
+func (m *Metrics) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	mux.Handle("GET /metrics", m)
+	return mux
+}
+
+func isAdminPath(path string) bool {
+	return path == "/healthz" || path == "/metrics"
+}
+
+// statusRecorder captures the status code written by a handler. It forwards
+// Flush, which gRPC requires for streaming responses.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		if r.status == 0 {
+			r.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,445 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	connectCodecJSON  = "json"
+	connectCodecProto = "proto"
+
+	connectStreamContentTypePrefix = "application/connect+"
+
+	connectFlagCompressed byte = 0x01
+	connectFlagEndStream  byte = 0x02
+
+	// connectAcceptEncoding lists the compressions accepted for requests,
+	// advertised when a request uses another one.
+	connectAcceptEncoding = "gzip"
+)
+
+// errUnsupportedCompression is returned for request compressions other than
+// identity and gzip.
+var errUnsupportedCompression = errors.New("unsupported compression")
+
+// connectCall describes a Connect protocol request resolved against a
+// registered gRPC method.
+type connectCall struct {
+	method protoreflect.MethodDescriptor
+	codec  string
+	stream bool
+}
+
+// connectCall resolves the request to a Connect call. Requests are only treated
+// as Connect calls if their path names a registered gRPC method, so they can't
+// shadow HTTP stubs for other paths.
+func (s *Server) connectCall(r *http.Request) (connectCall, bool) {
+	if s.grpcService == nil {
+		return connectCall{}, false
+	}
+
+	serviceName, methodName, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if !ok {
+		return connectCall{}, false
+	}
+	method, ok := s.grpcService.FindMethod(serviceName, methodName)
+	if !ok {
+		return connectCall{}, false
+	}
+	streaming := method.IsStreamingClient() || method.IsStreamingServer()
+
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		if streaming || !query.Has("message") {
+			return connectCall{}, false
+		}
+		codec := query.Get("encoding")
+		if codec != connectCodecJSON && codec != connectCodecProto {
+			return connectCall{}, false
+		}
+		return connectCall{method: method, codec: codec}, true
+	case http.MethodPost:
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			return connectCall{}, false
+		}
+		if codec, ok := strings.CutPrefix(mediaType, connectStreamContentTypePrefix); ok && isConnectCodec(codec) {
+			return connectCall{method: method, codec: codec, stream: true}, true
+		}
+		if codec, ok := strings.CutPrefix(mediaType, "application/"); ok && isConnectCodec(codec) && !streaming {
+			return connectCall{method: method, codec: codec}, true
+		}
+	}
+
+	return connectCall{}, false
+}
+
+func isConnectCodec(codec string) bool {
+	return codec == connectCodecJSON || codec == connectCodecProto
+}
+
+// marshal converts a binary protobuf message into the call's codec.
+func (c connectCall) marshal(desc protoreflect.MessageDescriptor, b []byte) ([]byte, error) {
+	if c.codec == connectCodecProto {
+		return b, nil
+	}
+
+	msg := dynamicpb.NewMessage(desc)
+	if err := proto.Unmarshal(b, msg); err != nil {
+		return nil, fmt.Errorf("unmarshal %v: %w", desc.FullName(), err)
+	}
+	return protojson.Marshal(msg)
+}
+
+// unmarshal converts a message in the call's codec into binary protobuf.
+func (c connectCall) unmarshal(desc protoreflect.MessageDescriptor, b []byte) ([]byte, error) {
+	if c.codec == connectCodecProto {
+		return b, nil
+	}
+
+	msg := dynamicpb.NewMessage(desc)
+	if len(bytes.TrimSpace(b)) > 0 {
+		if err := protojson.Unmarshal(b, msg); err != nil {
+			return nil, fmt.Errorf("unmarshal %v: %w", desc.FullName(), err)
+		}
+	}
+	return proto.Marshal(msg)
+}
+
+// serveConnect translates a Connect request into a native gRPC request and
+// writes the gRPC server's answer back using the Connect protocol.
+func serveConnect(grpcServer http.Handler, call connectCall, w http.ResponseWriter, r *http.Request) {
+	if call.stream {
+		serveConnectStream(grpcServer, call, w, r)
+		return
+	}
+	serveConnectUnary(grpcServer, call, w, r)
+}
+
+func serveConnectUnary(grpcServer http.Handler, call connectCall, w http.ResponseWriter, r *http.Request) {
+	payload, err := readConnectUnaryPayload(r)
+	if errors.Is(err, errUnsupportedCompression) {
+		w.Header().Set("Accept-Encoding", connectAcceptEncoding)
+		writeConnectError(w, status.New(codes.Unimplemented, err.Error()), nil)
+		return
+	}
+	if err != nil {
+		writeConnectError(w, status.New(codes.InvalidArgument, err.Error()), nil)
+		return
+	}
+
+	msg, err := call.unmarshal(call.method.Input(), payload)
+	if err != nil {
+		writeConnectError(w, status.New(codes.InvalidArgument, err.Error()), nil)
+		return
+	}
+
+	var header http.Header
+	var messages [][]byte
+	reader := newGRPCResponseReader(
+		func(h http.Header) { header = h },
+		func(b []byte) error {
+			messages = append(messages, bytes.Clone(b))
+			return nil
+		},
+	)
+	grpcServer.ServeHTTP(reader, newConnectGRPCRequest(r, bytes.NewReader(grpcFrame(0, msg))))
+
+	metadata := http.Header{}
+	copyGRPCMetadata(metadata, header)
+	for k, v := range reader.trailers() {
+		if isGRPCMetadataHeader(k) {
+			metadata["Trailer-"+k] = v
+		}
+	}
+
+	st := reader.status()
+	if st.Code() != codes.OK {
+		writeConnectError(w, st, metadata)
+		return
+	}
+	if len(messages) != 1 {
+		writeConnectError(w, status.New(codes.Internal, fmt.Sprintf("expected 1 response message, got %d", len(messages))), metadata)
+		return
+	}
+
+	out, err := call.marshal(call.method.Output(), messages[0])
+	if err != nil {
+		writeConnectError(w, status.New(codes.Internal, err.Error()), metadata)
+		return
+	}
+
+	for k, v := range metadata {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Content-Type", "application/"+call.codec)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(out); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to write Connect response", slog.String("error", err.Error()))
+	}
+}
+
+// readConnectUnaryPayload returns the uncompressed request message, which is
+// either the request body or, for GET requests, the "message" query parameter.
+func readConnectUnaryPayload(r *http.Request) ([]byte, error) {
+	var payload []byte
+	var encoding string
+
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		payload = []byte(query.Get("message"))
+		if query.Get("base64") == "1" {
+			decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(string(payload), "="))
+			if err != nil {
+				return nil, fmt.Errorf("decode base64 message: %w", err)
+			}
+			payload = decoded
+		}
+		encoding = query.Get("compression")
+	} else {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("read body: %w", err)
+		}
+		payload = body
+		encoding = r.Header.Get("Content-Encoding")
+	}
+
+	return decompress(encoding, payload)
+}
+
+func decompress(encoding string, payload []byte) ([]byte, error) {
+	if !supportsCompression(encoding) {
+		return nil, fmt.Errorf("%w %q", errUnsupportedCompression, encoding)
+	}
+	if encoding != "gzip" {
+		return payload, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("decompress: %w", err)
+	}
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("decompress: %w", err)
+	}
+	return out, nil
+}
+
+// supportsCompression reports whether request messages may be compressed
+// with encoding.
+func supportsCompression(encoding string) bool {
+	switch encoding {
+	case "", "identity", "gzip":
+		return true
+	}
+	return false
+}
+
+func serveConnectStream(grpcServer http.Handler, call connectCall, w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	encoding := r.Header.Get("Connect-Content-Encoding")
+	if !supportsCompression(encoding) {
+		err := fmt.Errorf("%w %q", errUnsupportedCompression, encoding)
+		w.Header().Set("Connect-Accept-Encoding", connectAcceptEncoding)
+		w.Header().Set("Content-Type", contentType)
+		writeConnectEndStream(w, r, connectEndStream{Error: newConnectError(status.New(codes.Unimplemented, err.Error()))})
+		return
+	}
+
+	pr, pw := io.Pipe()
+	defer func() {
+		_ = pr.Close()
+	}()
+	go func() {
+		pw.CloseWithError(translateConnectEnvelopes(call, encoding, r.Body, pw))
+	}()
+
+	flusher, _ := w.(http.Flusher)
+	reader := newGRPCResponseReader(
+		func(h http.Header) {
+			copyGRPCMetadata(w.Header(), h)
+			w.Header().Set("Content-Type", contentType)
+			w.WriteHeader(http.StatusOK)
+		},
+		func(b []byte) error {
+			out, err := call.marshal(call.method.Output(), b)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(grpcFrame(0, out)); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return nil
+		},
+	)
+	grpcServer.ServeHTTP(reader, newConnectGRPCRequest(r, pr))
+	reader.WriteHeader(http.StatusOK)
+
+	end := connectEndStream{Metadata: map[string][]string{}}
+	for k, v := range reader.trailers() {
+		if isGRPCMetadataHeader(k) {
+			end.Metadata[k] = v
+		}
+	}
+	if st := reader.status(); st.Code() != codes.OK {
+		end.Error = newConnectError(st)
+	}
+
+	writeConnectEndStream(w, r, end)
+}
+
+// writeConnectEndStream writes the final envelope of a Connect streaming
+// response.
+func writeConnectEndStream(w http.ResponseWriter, r *http.Request, end connectEndStream) {
+	b, err := json.Marshal(end)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to marshal Connect end of stream", slog.String("error", err.Error()))
+		return
+	}
+	if _, err := w.Write(grpcFrame(connectFlagEndStream, b)); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to write Connect end of stream", slog.String("error", err.Error()))
+	}
+}
+
+// translateConnectEnvelopes reads Connect envelopes from src and writes them as
+// uncompressed binary gRPC frames to dst.
+func translateConnectEnvelopes(call connectCall, encoding string, src io.Reader, dst io.Writer) error {
+	prefix := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(src, prefix); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("read envelope: %w", err)
+		}
+
+		payload := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+		if _, err := io.ReadFull(src, payload); err != nil {
+			return fmt.Errorf("read envelope: %w", err)
+		}
+
+		if prefix[0]&connectFlagCompressed != 0 {
+			var err error
+			if payload, err = decompress(encoding, payload); err != nil {
+				return err
+			}
+		}
+
+		msg, err := call.unmarshal(call.method.Input(), payload)
+		if err != nil {
+			return err
+		}
+		if _, err := dst.Write(grpcFrame(0, msg)); err != nil {
+			return err
+		}
+	}
+}
+
+// newConnectGRPCRequest derives the native gRPC request for a Connect call.
+func newConnectGRPCRequest(r *http.Request, body io.Reader) *http.Request {
+	req := newGRPCRequest(r, body)
+	for _, k := range []string{
+		"Connect-Protocol-Version",
+		"Connect-Timeout-Ms",
+		"Connect-Content-Encoding",
+		"Connect-Accept-Encoding",
+		"Content-Encoding",
+		"Accept-Encoding",
+	} {
+		req.Header.Del(k)
+	}
+	if timeout, err := strconv.ParseInt(r.Header.Get("Connect-Timeout-Ms"), 10, 64); err == nil && timeout > 0 {
+		// grpc-timeout values are limited to 8 digits.
+		if timeout < 1e8 {
+			req.Header.Set("Grpc-Timeout", strconv.FormatInt(timeout, 10)+"m")
+		} else {
+			req.Header.Set("Grpc-Timeout", strconv.FormatInt(timeout/1000, 10)+"S")
+		}
+	}
+	return req
+}
+
+func copyGRPCMetadata(dst http.Header, src http.Header) {
+	for k, v := range src {
+		if isGRPCMetadataHeader(k) && !strings.HasPrefix(k, http.TrailerPrefix) {
+			dst[k] = v
+		}
+	}
+}
+
+// connectError is the JSON representation of an error in the Connect protocol.
+type connectError struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// connectEndStream is the JSON payload of the final envelope of a Connect
+// streaming response.
+type connectEndStream struct {
+	Error    *connectError       `json:"error,omitempty"`
+	Metadata map[string][]string `json:"metadata,omitempty"`
+}
+
+func newConnectError(st *status.Status) *connectError {
+	return &connectError{Code: connectCodeName(st.Code()), Message: st.Message()}
+}
+
+func writeConnectError(w http.ResponseWriter, st *status.Status, metadata http.Header) {
+	for k, v := range metadata {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatusFromCode(st.Code()))
+	_ = json.NewEncoder(w).Encode(newConnectError(st))
+}
+
+func connectCodeName(c codes.Code) string {
+	if name, ok := connectCodeNames[c]; ok {
+		return name
+	}
+	return connectCodeNames[codes.Unknown]
+}
+
+// connectCodeNames maps gRPC status codes to Connect error codes.
+var connectCodeNames = map[codes.Code]string{
+	codes.Canceled:           "canceled",
+	codes.Unknown:            "unknown",
+	codes.InvalidArgument:    "invalid_argument",
+	codes.DeadlineExceeded:   "deadline_exceeded",
+	codes.NotFound:           "not_found",
+	codes.AlreadyExists:      "already_exists",
+	codes.PermissionDenied:   "permission_denied",
+	codes.ResourceExhausted:  "resource_exhausted",
+	codes.FailedPrecondition: "failed_precondition",
+	codes.Aborted:            "aborted",
+	codes.OutOfRange:         "out_of_range",
+	codes.Unimplemented:      "unimplemented",
+	codes.Internal:           "internal",
+	codes.Unavailable:        "unavailable",
+	codes.DataLoss:           "data_loss",
+	codes.Unauthenticated:    "unauthenticated",
+}
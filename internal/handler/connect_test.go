@@ -0,0 +1,212 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	helloworldpb "google.golang.org/grpc/examples/helloworld/helloworld"
+	routeguide "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestConnectUnary(t *testing.T) {
+	t.Parallel()
+
+	t.Run("JSON", func(t *testing.T) {
+		t.Parallel()
+
+		resp := doConnect(t, http.MethodPost, "/helloworld.Greeter/SayHello", "application/json", []byte(`{"name": "Jane"}`))
+		require.Equal(t, http.StatusOK, resp.status)
+		assert.Equal(t, "application/json", resp.contentType)
+		assert.JSONEq(t, `{"message": "Hello from proto stub"}`, string(resp.body))
+	})
+
+	t.Run("proto", func(t *testing.T) {
+		t.Parallel()
+
+		msg, err := proto.Marshal(&helloworldpb.HelloRequest{Name: "Jane"})
+		require.NoError(t, err)
+
+		resp := doConnect(t, http.MethodPost, "/helloworld.Greeter/SayHello", "application/proto", msg)
+		require.Equal(t, http.StatusOK, resp.status)
+		assert.Equal(t, "application/proto", resp.contentType)
+
+		var reply helloworldpb.HelloReply
+		require.NoError(t, proto.Unmarshal(resp.body, &reply))
+		assert.Equal(t, "Hello from proto stub", reply.Message)
+	})
+
+	t.Run("GET", func(t *testing.T) {
+		t.Parallel()
+
+		query := url.Values{
+			"connect":  []string{"v1"},
+			"encoding": []string{"json"},
+			"base64":   []string{"1"},
+			"message":  []string{base64.RawURLEncoding.EncodeToString([]byte(`{"name": "Jane"}`))},
+		}
+		resp := doConnect(t, http.MethodGet, "/helloworld.Greeter/SayHello?"+query.Encode(), "", nil)
+		require.Equal(t, http.StatusOK, resp.status)
+		assert.JSONEq(t, `{"message": "Hello from proto stub"}`, string(resp.body))
+	})
+
+	t.Run("invalid message", func(t *testing.T) {
+		t.Parallel()
+
+		resp := doConnect(t, http.MethodPost, "/helloworld.Greeter/SayHello", "application/json", []byte(`{"unknown": 1}`))
+		require.Equal(t, http.StatusBadRequest, resp.status)
+		assert.Equal(t, "application/json", resp.contentType)
+
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(resp.body, &body))
+		assert.Equal(t, "invalid_argument", body["code"])
+	})
+}
+
+func TestConnectServerStream(t *testing.T) {
+	t.Parallel()
+
+	req := []byte(`{"lo": {"latitude": 1}, "hi": {"latitude": 2}}`)
+	resp := doConnect(t, http.MethodPost, "/routeguide.RouteGuide/ListFeatures", "application/connect+json", grpcWebFrame(0, req))
+	require.Equal(t, http.StatusOK, resp.status)
+	assert.Equal(t, "application/connect+json", resp.contentType)
+
+	frames := readGRPCWebFrames(t, resp.body)
+	require.Len(t, frames, 4)
+	for i, name := range []string{"#1", "#2", "#3"} {
+		require.Equal(t, byte(0), frames[i].flag)
+		var feature map[string]any
+		require.NoError(t, json.Unmarshal(frames[i].data, &feature))
+		assert.Equal(t, name, feature["name"])
+	}
+
+	require.Equal(t, byte(0x02), frames[3].flag)
+	assert.NotContains(t, string(frames[3].data), `"error"`)
+}
+
+func TestConnectStreamError(t *testing.T) {
+	t.Parallel()
+
+	msg, err := proto.Marshal(&routeguide.RouteNote{Message: "hello"})
+	require.NoError(t, err)
+
+	resp := doConnect(t, http.MethodPost, "/routeguide.RouteGuide/RouteChat", "application/connect+proto", grpcWebFrame(0, msg))
+	require.Equal(t, http.StatusOK, resp.status)
+
+	frames := readGRPCWebFrames(t, resp.body)
+	require.NotEmpty(t, frames)
+
+	end := frames[len(frames)-1]
+	require.Equal(t, byte(0x02), end.flag)
+
+	var payload struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(end.data, &payload))
+	assert.Equal(t, "not_found", payload.Error.Code)
+}
+
+func TestConnectUnsupportedCompression(t *testing.T) {
+	t.Parallel()
+
+	t.Run("unary", func(t *testing.T) {
+		t.Parallel()
+
+		req, err := http.NewRequest(http.MethodPost, serverURL+"/helloworld.Greeter/SayHello", bytes.NewReader([]byte(`{}`)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", "snappy")
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, resp.Body.Close())
+		}()
+
+		require.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+		assert.Equal(t, "gzip", resp.Header.Get("Accept-Encoding"))
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, "unimplemented", body["code"])
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		t.Parallel()
+
+		req, err := http.NewRequest(http.MethodPost, serverURL+"/routeguide.RouteGuide/ListFeatures", bytes.NewReader(grpcWebFrame(1, []byte(`{}`))))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/connect+json")
+		req.Header.Set("Connect-Content-Encoding", "snappy")
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, resp.Body.Close())
+		}()
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "gzip", resp.Header.Get("Connect-Accept-Encoding"))
+		raw, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		frames := readGRPCWebFrames(t, raw)
+		require.Len(t, frames, 1)
+		require.Equal(t, byte(0x02), frames[0].flag)
+
+		var payload struct {
+			Error struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		}
+		require.NoError(t, json.Unmarshal(frames[0].data, &payload))
+		assert.Equal(t, "unimplemented", payload.Error.Code)
+	})
+}
+
+func TestConnectDoesNotShadowHTTPStubs(t *testing.T) {
+	t.Parallel()
+
+	resp := doConnect(t, http.MethodPost, "/wildcard", "application/json", []byte(`{}`))
+	require.Equal(t, http.StatusOK, resp.status)
+	assert.JSONEq(t, `{"message": "Matches any method"}`, string(resp.body))
+}
+
+type connectResponse struct {
+	status      int
+	contentType string
+	body        []byte
+}
+
+func doConnect(t *testing.T, method, path, contentType string, body []byte) connectResponse {
+	t.Helper()
+
+	req, err := http.NewRequest(method, serverURL+path, bytes.NewReader(body))
+	require.NoError(t, err)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Connect-Protocol-Version", "1")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, resp.Body.Close())
+	}()
+
+	raw, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return connectResponse{
+		status:      resp.StatusCode,
+		contentType: resp.Header.Get("Content-Type"),
+		body:        raw,
+	}
+}
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newGRPCRequest derives a native gRPC request from a request using another
+// protocol (gRPC-Web, Connect, ...) so it can be served by grpc.Server.ServeHTTP.
+// The caller is expected to adjust the content type if a codec suffix applies.
+func newGRPCRequest(r *http.Request, body io.Reader) *http.Request {
+	req := r.Clone(r.Context())
+	req.Method = http.MethodPost
+	req.ProtoMajor, req.ProtoMinor, req.Proto = 2, 0, "HTTP/2.0"
+	req.Header.Del("Content-Length")
+	req.Header.Set("Content-Type", "application/grpc")
+	req.ContentLength = -1
+	req.Body = io.NopCloser(body)
+	return req
+}
+
+// grpcFrame encodes data as a length-prefixed message frame.
+func grpcFrame(flag byte, data []byte) []byte {
+	frame := make([]byte, 5, 5+len(data))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	return append(frame, data...)
+}
+
+// collectTrailers returns all header fields that were not part of the headers
+// already sent, plus trailers announced via http.TrailerPrefix.
+func collectTrailers(header http.Header, sent map[string]bool) http.Header {
+	trailers := http.Header{}
+	for k, v := range header {
+		name, isTrailer := strings.CutPrefix(k, http.TrailerPrefix)
+		if !isTrailer && sent[k] {
+			continue
+		}
+		name = textproto.CanonicalMIMEHeaderKey(name)
+		trailers[name] = append(trailers[name], v...)
+	}
+	return trailers
+}
+
+// isGRPCMetadataHeader reports whether a response header returned by the gRPC
+// server carries user metadata rather than protocol information.
+func isGRPCMetadataHeader(k string) bool {
+	switch textproto.CanonicalMIMEHeaderKey(k) {
+	case "Content-Type", "Content-Length", "Trailer", "Date":
+		return false
+	}
+	return !strings.HasPrefix(strings.ToLower(k), "grpc-")
+}
+
+// grpcResponseReader is an http.ResponseWriter for grpc.Server.ServeHTTP that
+// decodes the length-prefixed messages written by the server and hands them
+// to onMessage as soon as they are complete.
+type grpcResponseReader struct {
+	header      http.Header
+	sent        map[string]bool
+	code        int
+	wroteHeader bool
+	buf         []byte
+	err         error
+
+	onHeader  func(http.Header)
+	onMessage func([]byte) error
+}
+
+var _ http.Flusher = &grpcResponseReader{}
+
+func newGRPCResponseReader(onHeader func(http.Header), onMessage func([]byte) error) *grpcResponseReader {
+	return &grpcResponseReader{
+		header:    http.Header{},
+		sent:      map[string]bool{},
+		onHeader:  onHeader,
+		onMessage: onMessage,
+	}
+}
+
+func (g *grpcResponseReader) Header() http.Header {
+	return g.header
+}
+
+func (g *grpcResponseReader) WriteHeader(code int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+	g.code = code
+
+	sent := http.Header{}
+	for k, v := range g.header {
+		g.sent[k] = true
+		sent[k] = v
+	}
+	if g.onHeader != nil {
+		g.onHeader(sent)
+	}
+}
+
+func (g *grpcResponseReader) Write(b []byte) (int, error) {
+	g.WriteHeader(http.StatusOK)
+	if g.err != nil {
+		return 0, g.err
+	}
+
+	g.buf = append(g.buf, b...)
+	for len(g.buf) >= 5 {
+		n := int(binary.BigEndian.Uint32(g.buf[1:5]))
+		if len(g.buf) < 5+n {
+			break
+		}
+		msg := g.buf[5 : 5+n]
+		g.buf = g.buf[5+n:]
+		if g.onMessage != nil {
+			if err := g.onMessage(msg); err != nil {
+				g.err = err
+				return 0, err
+			}
+		}
+	}
+
+	return len(b), nil
+}
+
+func (g *grpcResponseReader) Flush() {
+	g.WriteHeader(http.StatusOK)
+}
+
+// trailers returns the trailers written by the gRPC server.
+func (g *grpcResponseReader) trailers() http.Header {
+	return collectTrailers(g.header, g.sent)
+}
+
+// status returns the gRPC status of the finished call.
+func (g *grpcResponseReader) status() *status.Status {
+	if g.err != nil {
+		return status.New(codes.Internal, g.err.Error())
+	}
+
+	trailers := g.trailers()
+	raw := trailers.Get("Grpc-Status")
+	if raw == "" {
+		if g.code != http.StatusOK {
+			return status.New(codes.Unknown, http.StatusText(g.code))
+		}
+		return status.New(codes.Unknown, "missing grpc-status")
+	}
+
+	code, err := strconv.Atoi(raw)
+	if err != nil {
+		return status.New(codes.Unknown, "invalid grpc-status "+raw)
+	}
+
+	return status.New(codes.Code(code), decodeGRPCMessage(trailers.Get("Grpc-Message")))
+}
+
+// decodeGRPCMessage reverses the percent-encoding applied to grpc-message.
+func decodeGRPCMessage(msg string) string {
+	decoded, err := url.PathUnescape(msg)
+	if err != nil {
+		return msg
+	}
+	return decoded
+}
+
+// httpStatusFromCode maps a gRPC status code to the HTTP status code used when
+// returning the error to a client of an HTTP based protocol.
+func httpStatusFromCode(c codes.Code) int {
+	if code, ok := httpStatusCodes[c]; ok {
+		return code
+	}
+	return http.StatusInternalServerError
+}
+
+var httpStatusCodes = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           499,
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusBadRequest,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DataLoss:           http.StatusInternalServerError,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+}
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip" // register the gzip compressor
+)
+
+const (
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+
+	// grpcWebTrailerFlag marks a length-prefixed frame as carrying trailers
+	// instead of a message.
+	grpcWebTrailerFlag byte = 0x80
+
+	// grpcWebAcceptEncoding lists the compressions accepted for requests,
+	// advertised when a request uses another one.
+	grpcWebAcceptEncoding = "gzip"
+)
+
+// isGRPCWebRequest reports whether the request uses the gRPC-Web protocol in
+// either binary or text (base64) mode.
+func isGRPCWebRequest(r *http.Request) bool {
+	return r.Method == http.MethodPost &&
+		strings.HasPrefix(r.Header.Get("Content-Type"), grpcWebContentType)
+}
+
+// isGRPCWebPreflight reports whether the request is a CORS preflight issued by
+// a gRPC-Web client. Browsers don't send the content type on preflight, so the
+// "x-grpc-web" header requested by all gRPC-Web clients is used instead.
+func isGRPCWebPreflight(r *http.Request) bool {
+	if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+		return false
+	}
+	for _, h := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		if strings.EqualFold(strings.TrimSpace(h), "x-grpc-web") {
+			return true
+		}
+	}
+	return false
+}
+
+// serveGRPCWebPreflight answers a CORS preflight request for gRPC-Web.
+func serveGRPCWebPreflight(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Set("Access-Control-Allow-Origin", allowedOrigin(r))
+	h.Set("Access-Control-Allow-Methods", http.MethodPost)
+	h.Set("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
+	h.Set("Access-Control-Max-Age", "600")
+	h.Add("Vary", "Origin")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func allowedOrigin(r *http.Request) string {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		return origin
+	}
+	return "*"
+}
+
+// serveGRPCWeb translates a gRPC-Web request into a native gRPC request,
+// passes it to the gRPC server, and translates the response back. Trailers
+// are sent as a final length-prefixed frame in the response body.
+func serveGRPCWeb(grpcServer http.Handler, w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	textMode := strings.HasPrefix(contentType, grpcWebTextContentType)
+
+	var req *http.Request
+	if textMode {
+		req = newGRPCRequest(r, base64.NewDecoder(base64.StdEncoding, r.Body))
+		req.Header.Set("Content-Type", "application/grpc"+strings.TrimPrefix(contentType, grpcWebTextContentType))
+	} else {
+		req = newGRPCRequest(r, r.Body)
+		req.Header.Set("Content-Type", "application/grpc"+strings.TrimPrefix(contentType, grpcWebContentType))
+	}
+
+	if r.Header.Get("Origin") != "" {
+		w.Header().Set("Access-Control-Allow-Origin", allowedOrigin(r))
+		w.Header().Set("Access-Control-Expose-Headers", "grpc-status, grpc-message, grpc-status-details-bin, grpc-accept-encoding")
+		w.Header().Add("Vary", "Origin")
+	}
+
+	gw := newGRPCWebResponseWriter(w, contentType, textMode)
+	if enc := r.Header.Get("Grpc-Encoding"); enc != "" && enc != encoding.Identity && encoding.GetCompressor(enc) == nil {
+		gw.Header().Set("Grpc-Accept-Encoding", grpcWebAcceptEncoding)
+		gw.WriteHeader(http.StatusOK)
+		gw.Header().Set("Grpc-Status", strconv.Itoa(int(codes.Unimplemented)))
+		gw.Header().Set("Grpc-Message", "unsupported compression "+strconv.Quote(enc))
+	} else {
+		grpcServer.ServeHTTP(gw, req)
+	}
+	gw.finish()
+}
+
+// grpcWebResponseWriter adapts the native gRPC response written by
+// grpc.Server.ServeHTTP into the gRPC-Web wire format.
+type grpcWebResponseWriter struct {
+	w           http.ResponseWriter
+	out         io.Writer
+	encoder     io.WriteCloser
+	header      http.Header
+	sent        map[string]bool
+	contentType string
+	wroteHeader bool
+}
+
+var _ http.Flusher = &grpcWebResponseWriter{}
+
+func newGRPCWebResponseWriter(w http.ResponseWriter, contentType string, textMode bool) *grpcWebResponseWriter {
+	gw := &grpcWebResponseWriter{
+		w:           w,
+		out:         w,
+		header:      http.Header{},
+		sent:        map[string]bool{},
+		contentType: contentType,
+	}
+	if textMode {
+		gw.encoder = base64.NewEncoder(base64.StdEncoding, w)
+		gw.out = gw.encoder
+	}
+	return gw
+}
+
+func (gw *grpcWebResponseWriter) Header() http.Header {
+	return gw.header
+}
+
+func (gw *grpcWebResponseWriter) WriteHeader(code int) {
+	if gw.wroteHeader {
+		return
+	}
+	gw.wroteHeader = true
+
+	dst := gw.w.Header()
+	for k, v := range gw.header {
+		gw.sent[k] = true
+		if k == "Trailer" || strings.HasPrefix(k, http.TrailerPrefix) {
+			continue
+		}
+		dst[k] = v
+	}
+	dst.Set("Content-Type", gw.contentType)
+	dst.Del("Content-Length")
+
+	gw.w.WriteHeader(code)
+}
+
+func (gw *grpcWebResponseWriter) Write(b []byte) (int, error) {
+	gw.WriteHeader(http.StatusOK)
+	return gw.out.Write(b)
+}
+
+func (gw *grpcWebResponseWriter) Flush() {
+	gw.WriteHeader(http.StatusOK)
+	if f, ok := gw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// finish writes the trailer frame and flushes any pending base64 output.
+func (gw *grpcWebResponseWriter) finish() {
+	gw.WriteHeader(http.StatusOK)
+
+	_, _ = gw.out.Write(gw.trailerFrame())
+	if gw.encoder != nil {
+		_ = gw.encoder.Close()
+	}
+}
+
+// trailerFrame encodes the trailers written by the gRPC server as a gRPC-Web
+// trailer frame.
+func (gw *grpcWebResponseWriter) trailerFrame() []byte {
+	trailers := collectTrailers(gw.header, gw.sent)
+
+	keys := make([]string, 0, len(trailers))
+	for k := range trailers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var body bytes.Buffer
+	for _, k := range keys {
+		for _, v := range trailers[k] {
+			body.WriteString(strings.ToLower(k) + ": " + v + "\r\n")
+		}
+	}
+
+	return grpcFrame(grpcWebTrailerFlag, body.Bytes())
+}
@@ -0,0 +1,200 @@
+package handler_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	helloworldpb "google.golang.org/grpc/examples/helloworld/helloworld"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestGRPCWebUnary(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		contentType string
+		encode      func([]byte) []byte
+		decode      func(*testing.T, []byte) []byte
+	}{
+		{
+			name:        "binary",
+			contentType: "application/grpc-web+proto",
+			encode:      func(b []byte) []byte { return b },
+			decode:      func(_ *testing.T, b []byte) []byte { return b },
+		},
+		{
+			name:        "text",
+			contentType: "application/grpc-web-text",
+			encode: func(b []byte) []byte {
+				return []byte(base64.StdEncoding.EncodeToString(b))
+			},
+			decode: func(t *testing.T, b []byte) []byte {
+				out, err := base64.StdEncoding.DecodeString(string(b))
+				require.NoError(t, err)
+				return out
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			msg, err := proto.Marshal(&helloworldpb.HelloRequest{Name: "Jane"})
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodPost, serverURL+"/helloworld.Greeter/SayHello",
+				bytes.NewReader(tc.encode(grpcWebFrame(0, msg))))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", tc.contentType)
+			req.Header.Set("X-Grpc-Web", "1")
+			req.Header.Set("Origin", "http://localhost:3000")
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer func() {
+				require.NoError(t, resp.Body.Close())
+			}()
+
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tc.contentType, resp.Header.Get("Content-Type"))
+			assert.Equal(t, "http://localhost:3000", resp.Header.Get("Access-Control-Allow-Origin"))
+
+			raw, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			frames := readGRPCWebFrames(t, tc.decode(t, raw))
+			require.Len(t, frames, 2)
+
+			require.Equal(t, byte(0), frames[0].flag)
+			var reply helloworldpb.HelloReply
+			require.NoError(t, proto.Unmarshal(frames[0].data, &reply))
+			assert.Equal(t, "Hello from proto stub", reply.Message)
+
+			require.Equal(t, byte(0x80), frames[1].flag)
+			assert.Contains(t, string(frames[1].data), "grpc-status: 0\r\n")
+		})
+	}
+}
+
+func TestGRPCWebErrorInTrailers(t *testing.T) {
+	t.Parallel()
+
+	req, err := http.NewRequest(http.MethodPost, serverURL+"/missing.Service/Method",
+		bytes.NewReader(grpcWebFrame(0, nil)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, resp.Body.Close())
+	}()
+
+	raw, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	frames := readGRPCWebFrames(t, raw)
+	require.NotEmpty(t, frames)
+
+	trailer := frames[len(frames)-1]
+	require.Equal(t, byte(0x80), trailer.flag)
+	assert.Contains(t, string(trailer.data), "grpc-status: 12\r\n")
+}
+
+func TestGRPCWebCompression(t *testing.T) {
+	t.Parallel()
+
+	msg, err := proto.Marshal(&helloworldpb.HelloRequest{Name: "Jane"})
+	require.NoError(t, err)
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, err = zw.Write(msg)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	tests := []struct {
+		encoding   string
+		wantStatus string
+		wantAccept string
+	}{
+		{encoding: "gzip", wantStatus: "grpc-status: 0\r\n"},
+		{encoding: "snappy", wantStatus: "grpc-status: 12\r\n", wantAccept: "gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := http.NewRequest(http.MethodPost, serverURL+"/helloworld.Greeter/SayHello",
+				bytes.NewReader(grpcWebFrame(1, compressed.Bytes())))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/grpc-web+proto")
+			req.Header.Set("Grpc-Encoding", tt.encoding)
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer func() {
+				require.NoError(t, resp.Body.Close())
+			}()
+
+			raw, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			frames := readGRPCWebFrames(t, raw)
+			require.NotEmpty(t, frames)
+			assert.Contains(t, string(frames[len(frames)-1].data), tt.wantStatus)
+			assert.Equal(t, tt.wantAccept, resp.Header.Get("Grpc-Accept-Encoding"))
+		})
+	}
+}
+
+func TestGRPCWebPreflight(t *testing.T) {
+	t.Parallel()
+
+	req, err := http.NewRequest(http.MethodOptions, serverURL+"/helloworld.Greeter/SayHello", nil)
+	require.NoError(t, err)
+	req.Header.Set("Origin", "http://localhost:3000")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web,x-user-agent")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "http://localhost:3000", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, http.MethodPost, resp.Header.Get("Access-Control-Allow-Methods"))
+	assert.True(t, strings.Contains(resp.Header.Get("Access-Control-Allow-Headers"), "x-grpc-web"))
+}
+
+type grpcWebFrameData struct {
+	flag byte
+	data []byte
+}
+
+func grpcWebFrame(flag byte, data []byte) []byte {
+	frame := make([]byte, 5, 5+len(data))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	return append(frame, data...)
+}
+
+func readGRPCWebFrames(t *testing.T, b []byte) []grpcWebFrameData {
+	t.Helper()
+
+	var frames []grpcWebFrameData
+	for len(b) > 0 {
+		require.GreaterOrEqual(t, len(b), 5)
+		n := int(binary.BigEndian.Uint32(b[1:5]))
+		require.GreaterOrEqual(t, len(b), 5+n)
+		frames = append(frames, grpcWebFrameData{flag: b[0], data: b[5 : 5+n]})
+		b = b[5+n:]
+	}
+	return frames
+}
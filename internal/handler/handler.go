@@ -3,6 +3,7 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/randomenterprisesolutions/stub-server/internal/grpcstub"
 	"github.com/randomenterprisesolutions/stub-server/internal/httpstub"
+	"github.com/randomenterprisesolutions/stub-server/internal/openapi"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 	"google.golang.org/grpc"
@@ -19,7 +21,10 @@ import (
 // Server represents a server that can handle both HTTP and gRPC requests.
 type Server struct {
 	grpcServer  *grpc.Server
+	grpcService *grpcstub.GRPCService
+	transcoder  *transcoder
 	httpHandler http.Handler
+	latency     time.Duration
 }
 
 var _ http.Handler = &Server{}
@@ -27,31 +32,133 @@ var _ http.Handler = &Server{}
 // Options configures optional handler behavior.
 type Options struct {
 	EnableGRPCReflection bool
+	// ProtoDescriptorSets lists FileDescriptorSet files to load in addition
+	// to the proto directory.
+	ProtoDescriptorSets []string
+	// ProtoImportPaths lists additional proto import roots searched after
+	// the proto directory.
+	ProtoImportPaths []string
+	// ProtoFiles restricts proto loading to these entry files.
+	ProtoFiles []string
+	// FakeGRPCResponses synthesizes responses for gRPC methods without a
+	// stub.
+	FakeGRPCResponses bool
+	// FakeSeed seeds the generated fake responses.
+	FakeSeed int64
+	// ValidateGRPCRequests rejects gRPC requests violating the buf.validate
+	// constraints of the protos with codes.InvalidArgument.
+	ValidateGRPCRequests bool
+	// HTTPStubDirs lists additional HTTP stub directories loaded after the
+	// HTTP stub directory.
+	HTTPStubDirs []string
+	// GRPCStubDirs lists additional gRPC stub directories loaded after the
+	// gRPC stub directory.
+	GRPCStubDirs []string
+	// HTTPVirtualHosts partitions the HTTP stub directory by host: every
+	// directory holds the stubs of the host it is named after, selected by
+	// the Host header or TLS server name, and httpstub.DefaultHost the stubs
+	// of all other hosts.
+	HTTPVirtualHosts bool
+	// OpenAPI is the path of an OpenAPI 3 document. Stubs derived from its
+	// operations are served after the stubs of the HTTP stub directory.
+	OpenAPI string
+	// OpenAPIValidation controls the validation of HTTP requests and stub
+	// responses against the OpenAPI document. It defaults to
+	// openapi.ValidationEnforce.
+	OpenAPIValidation openapi.ValidationMode
+	// Proxy configures the upstream servers requests without a matching
+	// stub are forwarded to.
+	Proxy ProxyConfig
+	// RecordGRPCUpstream is the address of a gRPC server calls without a
+	// stub are forwarded to. The calls are recorded as gRPC stubs.
+	RecordGRPCUpstream string
+	// RecordHTTPUpstream is the base URL HTTP requests without a matching
+	// stub are forwarded to. The responses are recorded as HTTP stubs.
+	RecordHTTPUpstream string
+	// Latency delays every HTTP and gRPC response.
+	Latency time.Duration
 }
 
 // WithProto configures the server to handle gRPC requests using the provided
 // proto and stub directories.
 func (s *Server) WithProto(protoDir string, stubDir string, opts Options) error {
-	server, err := grpcstub.NewServerWithOptions(protoDir, stubDir, grpcstub.ServerOptions{
+	service, err := grpcstub.NewService(protoDir, stubDir, grpcstub.ServerOptions{
 		EnableReflection: opts.EnableGRPCReflection,
+		DescriptorSets:   opts.ProtoDescriptorSets,
+		ImportPaths:      opts.ProtoImportPaths,
+		ProtoFiles:       opts.ProtoFiles,
+		FakeResponses:    opts.FakeGRPCResponses,
+		FakeSeed:         opts.FakeSeed,
+		ValidateRequests: opts.ValidateGRPCRequests,
+		Proxy:            opts.Proxy.GRPC,
+		RecordUpstream:   opts.RecordGRPCUpstream,
+		StubDirs:         opts.GRPCStubDirs,
 	})
 	if err != nil {
 		return fmt.Errorf("initialize gRPC server: %w", err)
 	}
 
-	s.grpcServer = server
+	transcoder, err := newTranscoder(service.Services())
+	if err != nil {
+		return fmt.Errorf("initialize HTTP transcoding: %w", err)
+	}
+
+	s.grpcService = service
+	s.grpcServer = service.Server()
+	s.transcoder = transcoder
 
 	return nil
 }
 
 // WithHTTP configures the server to handle HTTP requests using the provided
 // HTTP stubs directory.
-func (s *Server) WithHTTP(httpStubs string) error {
-	handler, err := httpstub.NewHandler(httpStubs)
+func (s *Server) WithHTTP(httpStubs string, opts Options) error {
+	var doc *openapi.Document
+	var stubs []httpstub.Stub
+	if opts.OpenAPI != "" {
+		var err error
+		if doc, err = openapi.Load(opts.OpenAPI); err != nil {
+			return fmt.Errorf("load OpenAPI document: %w", err)
+		}
+		generated, err := doc.Stubs()
+		if err != nil {
+			return fmt.Errorf("generate stubs from %v: %w", opts.OpenAPI, err)
+		}
+		for _, g := range generated {
+			stubs = append(stubs, g.Stub)
+		}
+	}
+
+	httpOpts := httpstub.Options{
+		Stubs:          stubs,
+		Proxy:          opts.Proxy.HTTP,
+		RecordUpstream: opts.RecordHTTPUpstream,
+		StubDirs:       opts.HTTPStubDirs,
+	}
+	var handler http.Handler
+	var err error
+	if opts.HTTPVirtualHosts {
+		if httpStubs == "" {
+			return errors.New("virtual hosts require an HTTP stub directory")
+		}
+		handler, err = httpstub.NewVirtualHosts(httpStubs, httpOpts)
+	} else {
+		handler, err = httpstub.NewHandlerWithOptions(httpStubs, httpOpts)
+	}
 	if err != nil {
 		return fmt.Errorf("initialize HTTP handler: %w", err)
 	}
 
+	if doc != nil {
+		mode := opts.OpenAPIValidation
+		if mode == "" {
+			mode = openapi.ValidationEnforce
+		}
+		if handler, err = doc.Validator(handler, mode); err != nil {
+			return fmt.Errorf("initialize OpenAPI validation: %w", err)
+		}
+	}
+
 	s.httpHandler = handler
 
 	return nil
@@ -60,8 +167,40 @@ func (s *Server) WithHTTP(httpStubs string) error {
 // ServeHTTP routes incoming HTTP requests to either the gRPC server or the HTTP
 // handler based on the request properties. If the request is a gRPC
 // request (HTTP/2 with "application/grpc" content type), it is forwarded to the
-// gRPC server. Otherwise, it is handled by the HTTP handler.
+// gRPC server. gRPC-Web requests ("application/grpc-web" and
+// "application/grpc-web-text") and their CORS preflights, as well as Connect
+// requests targeting a registered method, are translated and forwarded to the
+// gRPC server as well, as are REST requests matching a google.api.http rule of
+// a registered method. Otherwise, it is handled by the HTTP handler. Requests
+// are delayed by Options.Latency first.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.latency > 0 {
+		select {
+		case <-time.After(s.latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if isGRPCWebRequest(r) || isGRPCWebPreflight(r) {
+		if s.grpcServer == nil {
+			slog.ErrorContext(r.Context(), "No gRPC stub server configured")
+			http.Error(w, "No gRPC stub server configured", http.StatusNotImplemented)
+			return
+		}
+		if r.Method == http.MethodOptions {
+			serveGRPCWebPreflight(w, r)
+			return
+		}
+		serveGRPCWeb(s.grpcServer, w, r)
+		return
+	}
+
+	if call, ok := s.connectCall(r); ok {
+		serveConnect(s.grpcServer, call, w, r)
+		return
+	}
+
 	if r.ProtoMajor == 2 && strings.HasPrefix(
 		r.Header.Get("Content-Type"), "application/grpc") {
 		if s.grpcServer == nil {
@@ -73,6 +212,13 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if s.transcoder != nil {
+		if route, values, ok := s.transcoder.match(r); ok {
+			serveTranscoded(s.grpcServer, route, values, w, r)
+			return
+		}
+	}
+
 	if s.httpHandler == nil {
 		slog.ErrorContext(r.Context(), "No HTTP stub server configured")
 		http.Error(w, "No HTTP stub server configured", http.StatusNotImplemented)
@@ -82,37 +228,59 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.httpHandler.ServeHTTP(w, r)
 }
 
-func allowH2c(next http.Handler) http.Handler {
+// AllowH2c wraps a handler to accept HTTP/2 cleartext (h2c) requests next to
+// HTTP/1.1 on listeners without TLS.
+func AllowH2c(next http.Handler) http.Handler {
 	h2server := &http2.Server{IdleTimeout: time.Second * 60}
 	return h2c.NewHandler(next, h2server)
 }
 
 // New creates a new Server instance and configures it based on the provided
-// directories for HTTP stubs, proto files, and gRPC stubs. If the respective
-// directory is an empty string, that type of handling is not configured.
+// directories for HTTP stubs, proto files, and gRPC stubs. If the HTTP stub or
+// proto directory is an empty string, that type of handling is not configured.
+// gRPC calls are served without stubs if the gRPC stub directory is empty.
 func New(httpStubDir string, protoDir string, protoStubDir string) (http.Handler, error) {
 	return NewWithOptions(httpStubDir, protoDir, protoStubDir, Options{EnableGRPCReflection: true})
 }
 
 // NewWithOptions creates a new Server instance with configurable options.
+// The returned handler serves HTTP/1.1 and HTTP/2 cleartext (h2c) requests of
+// all protocols.
 func NewWithOptions(httpStubDir string, protoDir string, protoStubDir string, opts Options) (http.Handler, error) {
-	mux := http.NewServeMux()
-
-	s := &Server{}
+	s, err := NewServer(httpStubDir, protoDir, protoStubDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	return AllowH2c(s), nil
+}
 
-	mux.Handle("/", s)
+// NewServer creates a new Server. Unlike NewWithOptions it returns the Server
+// itself, so listeners can serve a subset of the protocols via Handler.
+func NewServer(httpStubDir string, protoDir string, protoStubDir string, opts Options) (*Server, error) {
+	s := &Server{latency: opts.Latency}
 
-	if httpStubDir != "" {
-		if err := s.WithHTTP(httpStubDir); err != nil {
+	if opts.RecordHTTPUpstream != "" && httpStubDir == "" {
+		return nil, errors.New("recording HTTP stubs requires an HTTP stub directory")
+	}
+	if len(opts.Proxy.HTTP) > 0 && httpStubDir == "" && opts.OpenAPI == "" {
+		return nil, errors.New("proxying HTTP requests requires an HTTP stub directory or OpenAPI document")
+	}
+	if httpStubDir != "" || opts.OpenAPI != "" {
+		if err := s.WithHTTP(httpStubDir, opts); err != nil {
 			return nil, fmt.Errorf("create HTTP handler: %w", err)
 		}
 	}
 
-	if protoDir != "" && protoStubDir != "" {
+	if opts.RecordGRPCUpstream != "" && protoStubDir == "" {
+		return nil, errors.New("recording gRPC stubs requires a gRPC stub directory")
+	}
+	if protoDir != "" || len(opts.ProtoImportPaths) > 0 || len(opts.ProtoDescriptorSets) > 0 {
 		if err := s.WithProto(protoDir, protoStubDir, opts); err != nil {
 			return nil, fmt.Errorf("create gRPC handler: %w", err)
 		}
+	} else if len(opts.Proxy.GRPC) > 0 || opts.RecordGRPCUpstream != "" {
+		return nil, errors.New("proxying or recording gRPC calls requires protos")
 	}
 
-	return allowH2c(s), nil
+	return s, nil
 }
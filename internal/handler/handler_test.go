@@ -10,6 +10,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -352,3 +353,88 @@ func TestHTTPServer_NoHTTPHandlerConfigured(t *testing.T) {
 
 	assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
 }
+
+func TestGrpcServer_FakeResponsesWithoutStubs(t *testing.T) {
+	t.Parallel()
+
+	h, err := handler.NewWithOptions("", "../../examples/protos", "", handler.Options{FakeGRPCResponses: true})
+	require.NoError(t, err)
+
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+
+	url, _ := strings.CutPrefix(server.URL, "http://")
+	c, err := grpc.NewClient(url, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+
+	reply, err := helloworldpb.NewGreeterClient(c).SayHello(context.TODO(), &helloworldpb.HelloRequest{Name: "Jane"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, reply.Message)
+
+	_, err = handler.NewWithOptions("", "../../examples/protos", "", handler.Options{RecordGRPCUpstream: "localhost:1"})
+	require.ErrorContains(t, err, "recording gRPC stubs requires a gRPC stub directory")
+}
+
+func TestHTTPServer_OpenAPIStubs(t *testing.T) {
+	t.Parallel()
+
+	handler, err := handler.NewWithOptions("", "", "", handler.Options{OpenAPI: "../../examples/openapi/users.yaml"})
+	require.NoError(t, err)
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/v1/users/1", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Stub-Status", "404")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.JSONEq(t, `{"message": "user not found"}`, string(body))
+}
+
+func TestHTTPServer_OpenAPICompressedResponses(t *testing.T) {
+	t.Parallel()
+
+	stubDir := t.TempDir()
+	stubs := map[string]string{
+		"users.json":  `{"path": "/v1/users", "method": "GET", "response": {"status": 200, "compress": ["gzip"], "body": {"users": [{"id": "3fa85f64-5717-4562-b3fc-2c963f66afa6", "email": "alice@example.com"}], "total": 1}}}`,
+		"create.json": `{"path": "/v1/users", "method": "POST", "response": {"status": 201, "compress": ["br"], "forceCompress": true, "body": {"id": 1, "email": "alice@example.com"}}}`,
+	}
+	for name, content := range stubs {
+		require.NoError(t, os.WriteFile(filepath.Join(stubDir, name), []byte(content), 0o644))
+	}
+
+	h, err := handler.NewWithOptions(stubDir, "", "", handler.Options{OpenAPI: "../../examples/openapi/users.yaml"})
+	require.NoError(t, err)
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+
+	// The client asks for gzip and decompresses the response transparently.
+	resp, err := http.Get(server.URL + "/v1/users")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	assert.True(t, resp.Uncompressed)
+	assert.JSONEq(t, `{"users": [{"id": "3fa85f64-5717-4562-b3fc-2c963f66afa6", "email": "alice@example.com"}], "total": 1}`, string(body))
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/v1/users", strings.NewReader(`{"email": "alice@example.com"}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", "3fa85f64-5717-4562-b3fc-2c963f66afa6")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Contains(t, string(body), `"pointer":"/id"`)
+	assert.NotContains(t, string(body), "invalid JSON")
+}
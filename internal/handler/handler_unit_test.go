@@ -3,7 +3,10 @@ package handler
 import (
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -46,3 +49,102 @@ func TestServerServeHTTP_UsesHTTPHandler(t *testing.T) {
 	require.True(t, called)
 	require.Equal(t, http.StatusAccepted, rec.Code)
 }
+
+func TestServerServeHTTP_Latency(t *testing.T) {
+	server := &Server{
+		latency: 20 * time.Millisecond,
+		httpHandler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	server.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+}
+
+func TestCompilePathTemplate(t *testing.T) {
+	cases := []struct {
+		template   string
+		path       string
+		wantMatch  bool
+		wantFields []string
+		wantValues []string
+	}{
+		{
+			template:   "/v1/{name=shelves/*/books/*}",
+			path:       "/v1/shelves/1/books/2",
+			wantMatch:  true,
+			wantFields: []string{"name"},
+			wantValues: []string{"shelves/1/books/2"},
+		},
+		{
+			template:   "/v1/shelves/{shelf}/books/{book.id}",
+			path:       "/v1/shelves/1/books/2",
+			wantMatch:  true,
+			wantFields: []string{"shelf", "book.id"},
+			wantValues: []string{"1", "2"},
+		},
+		{
+			template:   "/v1/{name=files/**}:download",
+			path:       "/v1/files/a/b/c:download",
+			wantMatch:  true,
+			wantFields: []string{"name"},
+			wantValues: []string{"files/a/b/c"},
+		},
+		{
+			template:   "/v1/{name}",
+			path:       "/v1/a/b",
+			wantMatch:  false,
+			wantFields: []string{"name"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.template, func(t *testing.T) {
+			pattern, fields, err := compilePathTemplate(tc.template)
+			require.NoError(t, err)
+			require.Equal(t, tc.wantFields, fields)
+
+			m := pattern.FindStringSubmatch(tc.path)
+			require.Equal(t, tc.wantMatch, m != nil)
+			if tc.wantMatch {
+				require.Equal(t, tc.wantValues, m[1:])
+			}
+		})
+	}
+}
+
+func TestCompilePathTemplate_Invalid(t *testing.T) {
+	for _, tmpl := range []string{"v1/books", "/v1/{name", "/v1/{}"} {
+		_, _, err := compilePathTemplate(tmpl)
+		require.Error(t, err, tmpl)
+	}
+}
+
+func TestLoadProxyConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "proxy.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+  "http": [{"prefix": "/api/", "upstream": "http://localhost:8080", "setHeaders": {"Authorization": "Bearer x"}}],
+  "grpc": [{"service": "routeguide.RouteGuide", "upstream": "localhost:50051"}]
+}`), 0o600))
+
+	cfg, err := LoadProxyConfig(path)
+	require.NoError(t, err)
+	require.Len(t, cfg.HTTP, 1)
+	require.Equal(t, "Bearer x", cfg.HTTP[0].SetHeaders["Authorization"])
+	require.Len(t, cfg.GRPC, 1)
+	require.Equal(t, "localhost:50051", cfg.GRPC[0].Upstream)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{
+  "http": [{"prefx": "/api/"}]
+}`), 0o600))
+	_, err = LoadProxyConfig(path)
+	require.ErrorContains(t, err, path+":")
+	require.ErrorContains(t, err, `unknown field "prefx"`)
+}
@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/certs"
+)
+
+// Protocols is the set of protocols served by a listener.
+type Protocols uint8
+
+const (
+	// ProtocolHTTP serves HTTP stubs, gRPC-Web, Connect and transcoded REST
+	// requests.
+	ProtocolHTTP Protocols = 1 << iota
+	// ProtocolGRPC serves native gRPC calls over HTTP/2.
+	ProtocolGRPC
+	// ProtocolAdmin serves the health and metrics endpoints.
+	ProtocolAdmin
+)
+
+var protocolNames = map[string]Protocols{
+	"http":  ProtocolHTTP,
+	"grpc":  ProtocolGRPC,
+	"admin": ProtocolAdmin,
+}
+
+// Has reports whether all protocols of q are in p.
+func (p Protocols) Has(q Protocols) bool {
+	return p&q == q
+}
+
+func (p Protocols) String() string {
+	var names []string
+	for _, name := range []string{"http", "grpc", "admin"} {
+		if p.Has(protocolNames[name]) {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// Listener describes an address the server accepts connections on and the
+// protocols served there.
+type Listener struct {
+	Protocols Protocols
+	// Network is "tcp" or "unix".
+	Network string
+	Address string
+	// TLS enables TLS with the settings of TLSOptions.
+	TLS        bool
+	TLSOptions certs.Options
+}
+
+// ParseListener parses a listener definition of the form
+// <protocols>=<address>[;<option>...], e.g. "http,grpc=:8080" or
+// "grpc=unix:/tmp/stub.sock". Protocols are http, grpc and admin. The listener
+// uses TLS if defaults configure it; the option no-tls opts out. The options
+// tls, cert=<file>, key=<file>, client-ca=<file> and auto-tls=<file> enable TLS
+// for the listener, starting from the TLS settings in defaults.
+func ParseListener(spec string, defaults certs.Options) (Listener, error) {
+	definition, options, _ := strings.Cut(spec, ";")
+	protocols, address, ok := strings.Cut(definition, "=")
+	if !ok || address == "" {
+		return Listener{}, fmt.Errorf("listener %q: expected <protocols>=<address>", spec)
+	}
+
+	l := Listener{Network: "tcp", Address: address}
+	for _, name := range strings.Split(protocols, ",") {
+		p, ok := protocolNames[strings.TrimSpace(name)]
+		if !ok {
+			return Listener{}, fmt.Errorf("listener %q: unknown protocol %q, expected http, grpc or admin", spec, name)
+		}
+		l.Protocols |= p
+	}
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		l.Network = "unix"
+		l.Address = strings.TrimPrefix(path, "//")
+	}
+
+	l.TLSOptions = defaults
+	configured := defaults.CertFile != "" || defaults.KeyFile != "" || defaults.ClientCAFile != "" || defaults.AutoCAFile != ""
+	explicit, plain := false, false
+	for _, option := range strings.Split(options, ";") {
+		if option == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(option, "=")
+		if key == "no-tls" {
+			plain = true
+			continue
+		}
+		if key != "tls" && value == "" {
+			return Listener{}, fmt.Errorf("listener %q: option %q requires a value", spec, key)
+		}
+		explicit = true
+		switch key {
+		case "tls":
+		case "cert":
+			l.TLSOptions.CertFile, l.TLSOptions.AutoCAFile = value, ""
+		case "key":
+			l.TLSOptions.KeyFile, l.TLSOptions.AutoCAFile = value, ""
+		case "client-ca":
+			l.TLSOptions.ClientCAFile = value
+		case "auto-tls":
+			l.TLSOptions.AutoCAFile, l.TLSOptions.CertFile, l.TLSOptions.KeyFile = value, "", ""
+		default:
+			return Listener{}, fmt.Errorf("listener %q: unknown option %q", spec, key)
+		}
+	}
+	if plain && explicit {
+		return Listener{}, fmt.Errorf("listener %q: option no-tls can't be combined with TLS options", spec)
+	}
+	l.TLS = explicit || (configured && !plain)
+	if l.TLS && l.TLSOptions.CertFile == "" && l.TLSOptions.AutoCAFile == "" {
+		return Listener{}, fmt.Errorf("listener %q: TLS requires a certificate or auto-tls", spec)
+	}
+	if l.Network == "tcp" {
+		if host, _, err := net.SplitHostPort(l.Address); err == nil && host != "" && host != "0.0.0.0" && host != "::" {
+			l.TLSOptions.Hosts = append(l.TLSOptions.Hosts, host)
+		}
+	}
+
+	return l, nil
+}
+
+// Listen opens the listener. A stale Unix socket left behind by a previous
+// process is removed first.
+func (l Listener) Listen() (net.Listener, error) {
+	if l.Network == "unix" {
+		if info, err := os.Stat(l.Address); err == nil && info.Mode()&os.ModeSocket != 0 {
+			if err := os.Remove(l.Address); err != nil {
+				return nil, fmt.Errorf("remove stale socket: %w", err)
+			}
+		}
+	}
+	ln, err := net.Listen(l.Network, l.Address)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %v: %w", l, err)
+	}
+	return ln, nil
+}
+
+func (l Listener) String() string {
+	if l.Network == "unix" {
+		return "unix:" + l.Address
+	}
+	return l.Address
+}
+
+// Handler returns a handler serving only the given protocols. Native gRPC
+// calls on a listener without ProtocolGRPC and other requests on a listener
+// without ProtocolHTTP are rejected. Admin endpoints take precedence over
+// HTTP stubs on listeners serving both.
+func (s *Server) Handler(p Protocols, metrics *Metrics) http.Handler {
+	var admin http.Handler
+	if p.Has(ProtocolAdmin) {
+		admin = metrics.adminHandler()
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if admin != nil && isAdminPath(r.URL.Path) {
+			admin.ServeHTTP(w, r)
+			return
+		}
+
+		if isGRPCRequest(r) {
+			if !p.Has(ProtocolGRPC) {
+				slog.ErrorContext(r.Context(), "gRPC is not served on this listener")
+				http.Error(w, "gRPC is not served on this listener", http.StatusNotImplemented)
+				return
+			}
+		} else if !p.Has(ProtocolHTTP) {
+			http.NotFound(w, r)
+			return
+		}
+		s.ServeHTTP(w, r)
+	})
+}
+
+// isGRPCRequest reports whether r is a native gRPC call, as opposed to
+// gRPC-Web.
+func isGRPCRequest(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") && !isGRPCWebRequest(r)
+}
@@ -0,0 +1,157 @@
+package handler_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/certs"
+	"github.com/randomenterprisesolutions/stub-server/internal/handler"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	helloworldpb "google.golang.org/grpc/examples/helloworld/helloworld"
+)
+
+func TestParseListener(t *testing.T) {
+	t.Parallel()
+
+	defaults := certs.Options{CertFile: "server.pem", KeyFile: "server.key"}
+	cases := []struct {
+		spec    string
+		want    handler.Listener
+		wantErr string
+	}{
+		{
+			spec: "http,grpc=:8080",
+			want: handler.Listener{Protocols: handler.ProtocolHTTP | handler.ProtocolGRPC, Network: "tcp", Address: ":8080", TLS: true, TLSOptions: defaults},
+		},
+		{
+			spec: "admin=unix:///tmp/admin.sock;no-tls",
+			want: handler.Listener{Protocols: handler.ProtocolAdmin, Network: "unix", Address: "/tmp/admin.sock", TLSOptions: defaults},
+		},
+		{
+			spec: "grpc=localhost:50443;tls",
+			want: handler.Listener{
+				Protocols: handler.ProtocolGRPC, Network: "tcp", Address: "localhost:50443", TLS: true,
+				TLSOptions: certs.Options{CertFile: "server.pem", KeyFile: "server.key", Hosts: []string{"localhost"}},
+			},
+		},
+		{
+			spec: "http=:8443;auto-tls=ca.pem;client-ca=clients.pem",
+			want: handler.Listener{
+				Protocols: handler.ProtocolHTTP, Network: "tcp", Address: ":8443", TLS: true,
+				TLSOptions: certs.Options{AutoCAFile: "ca.pem", ClientCAFile: "clients.pem"},
+			},
+		},
+		{spec: ":8080", wantErr: "expected <protocols>=<address>"},
+		{spec: "ftp=:21", wantErr: `unknown protocol "ftp"`},
+		{spec: "http=:8080;cert", wantErr: `option "cert" requires a value`},
+		{spec: "http=:8080;gzip=1", wantErr: `unknown option "gzip"`},
+		{spec: "http=:8080;no-tls;client-ca=clients.pem", wantErr: "option no-tls can't be combined with TLS options"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.spec, func(t *testing.T) {
+			got, err := handler.ParseListener(tc.spec, defaults)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+
+	_, err := handler.ParseListener("http=:8443;tls", certs.Options{})
+	require.ErrorContains(t, err, "TLS requires a certificate or auto-tls")
+
+	// Without TLS settings listeners use plain connections.
+	plain, err := handler.ParseListener("http=:8080", certs.Options{})
+	require.NoError(t, err)
+	require.False(t, plain.TLS)
+
+	// A client CA alone doesn't provide a certificate.
+	_, err = handler.ParseListener("http=:8443", certs.Options{ClientCAFile: "clients.pem"})
+	require.ErrorContains(t, err, "TLS requires a certificate or auto-tls")
+}
+
+func TestListenerProtocols(t *testing.T) {
+	t.Parallel()
+
+	srv, err := handler.NewServer("../../examples/httpstubs", "../../examples/protos", "../../examples/protostubs", handler.Options{})
+	require.NoError(t, err)
+	metrics := handler.NewMetrics()
+
+	// Native gRPC over a Unix socket with HTTP/2 prior knowledge only.
+	grpcListener, err := handler.ParseListener("grpc=unix:"+filepath.Join(t.TempDir(), "grpc.sock"), certs.Options{})
+	require.NoError(t, err)
+	grpcURL := serveListener(t, grpcListener, srv.Handler(grpcListener.Protocols, metrics), metrics, true)
+
+	adminListener, err := handler.ParseListener("http,admin=127.0.0.1:0", certs.Options{})
+	require.NoError(t, err)
+	adminURL := serveListener(t, adminListener, srv.Handler(adminListener.Protocols, metrics), metrics, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	conn, err := grpc.NewClient(grpcURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	reply, err := helloworldpb.NewGreeterClient(conn).SayHello(ctx, &helloworldpb.HelloRequest{Name: "Jane"})
+	require.NoError(t, err)
+	require.Equal(t, "Hello from proto stub", reply.GetMessage())
+
+	// HTTP stubs are served next to the admin endpoints.
+	require.Equal(t, http.StatusOK, get(ctx, t, adminURL+"/helloworld"))
+	require.Equal(t, http.StatusOK, get(ctx, t, adminURL+"/healthz"))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, adminURL+"/metrics", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close() //nolint:errcheck
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `stub_server_grpc_calls_total{listener="`+grpcListener.String()+`",method="/helloworld.Greeter/SayHello",code="0"} 1`)
+	require.Contains(t, string(body), `stub_server_requests_total{listener="`+adminListener.String()+`",code="200"} 2`)
+}
+
+// serveListener serves h on l and returns the address to dial. Listeners
+// with h2 only accept HTTP/2 with prior knowledge.
+func serveListener(t *testing.T, l handler.Listener, h http.Handler, metrics *handler.Metrics, h2 bool) string {
+	t.Helper()
+
+	ln, err := l.Listen()
+	require.NoError(t, err)
+	protocols := new(http.Protocols)
+	if h2 {
+		protocols.SetUnencryptedHTTP2(true)
+	} else {
+		protocols.SetHTTP1(true)
+	}
+	server := &http.Server{Handler: metrics.Instrument(l.String(), h), Protocols: protocols}
+	go func() {
+		_ = server.Serve(ln)
+	}()
+	t.Cleanup(func() { _ = server.Close() })
+
+	if l.Network == "unix" {
+		return "unix:" + l.Address
+	}
+	return "http://" + ln.Addr().String()
+}
+
+func get(ctx context.Context, t *testing.T, url string) int {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	return resp.StatusCode
+}
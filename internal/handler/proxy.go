@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/diag"
+	"github.com/randomenterprisesolutions/stub-server/internal/grpcstub"
+	"github.com/randomenterprisesolutions/stub-server/internal/httpstub"
+)
+
+// ProxyConfig lists the upstream servers requests without a matching stub are
+// forwarded to, so only some endpoints of a real dependency are stubbed.
+type ProxyConfig struct {
+	HTTP []httpstub.ProxyRoute `json:"http"`
+	GRPC []grpcstub.ProxyRoute `json:"grpc"`
+}
+
+// LoadProxyConfig reads a ProxyConfig from a JSON file.
+func LoadProxyConfig(path string) (ProxyConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ProxyConfig{}, fmt.Errorf("read proxy config: %w", err)
+	}
+
+	var cfg ProxyConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return ProxyConfig{}, diag.Locate(path, data, err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,169 @@
+package handler_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/certs"
+	"github.com/randomenterprisesolutions/stub-server/internal/handler"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	routeguide "google.golang.org/grpc/examples/route_guide/routeguide"
+)
+
+func TestTLSClientCertificates(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	httpDir := filepath.Join(dir, "http")
+	stubDir := filepath.Join(dir, "grpc")
+	require.NoError(t, os.MkdirAll(httpDir, 0o755))
+	require.NoError(t, os.MkdirAll(stubDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(httpDir, "whoami.json"), []byte(`{
+		"path": "/whoami", "method": "GET", "clientCert": {"subject": "alice"},
+		"response": {"status": 200, "body": {"user": "alice"}}
+	}`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(stubDir, "alice.json"), []byte(`{
+		"service": "routeguide.RouteGuide", "method": "GetFeature",
+		"clientCert": {"san": "alice@example.com"},
+		"output": {"data": {"name": "alice"}}
+	}`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(stubDir, "default.json"), []byte(`{
+		"service": "routeguide.RouteGuide", "method": "GetFeature",
+		"output": {"data": {"name": "anyone"}}
+	}`), 0o644))
+
+	clientCAFile := filepath.Join(dir, "client-ca.pem")
+	alice := newClientCert(t, clientCAFile, "alice", "alice@example.com")
+
+	caFile := filepath.Join(dir, "ca.pem")
+	cfg, err := certs.ServerConfig(certs.Options{AutoCAFile: caFile, ClientCAFile: clientCAFile})
+	require.NoError(t, err)
+
+	h, err := handler.New(httpDir, "../../examples/protos", stubDir)
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &http.Server{Handler: h, TLSConfig: cfg}
+	go func() {
+		_ = srv.ServeTLS(listener, "", "")
+	}()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	caPEM, err := os.ReadFile(caFile)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(caPEM))
+	clientTLS := &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{alice}, MinVersion: tls.VersionTLS12}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	t.Run("grpc over TLS", func(t *testing.T) {
+		conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+
+		feature, err := routeguide.NewRouteGuideClient(conn).GetFeature(ctx, &routeguide.Point{})
+		require.NoError(t, err)
+		require.Equal(t, "alice", feature.GetName())
+	})
+
+	t.Run("http/2 over TLS", func(t *testing.T) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS, ForceAttemptHTTP2: true}}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+listener.Addr().String()+"/whoami", nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close() //nolint:errcheck
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, 2, resp.ProtoMajor)
+		require.JSONEq(t, `{"user": "alice"}`, string(body))
+	})
+
+	t.Run("missing client certificate", func(t *testing.T) {
+		noCert := clientTLS.Clone()
+		noCert.Certificates = nil
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: noCert}}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+listener.Addr().String()+"/whoami", nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		require.Error(t, err)
+	})
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	_, err := certs.ServerConfig(certs.Options{CertFile: filepath.Join(dir, "missing.pem"), KeyFile: filepath.Join(dir, "missing.key")})
+	require.ErrorContains(t, err, "load cert")
+
+	_, err = certs.ServerConfig(certs.Options{CertFile: "cert.pem"})
+	require.ErrorContains(t, err, "both a certificate and a key are required")
+
+	_, err = certs.ServerConfig(certs.Options{ClientCAFile: "ca.pem"})
+	require.ErrorContains(t, err, "requires a server certificate")
+
+	cfg, err := certs.ServerConfig(certs.Options{})
+	require.NoError(t, err)
+	require.Nil(t, cfg)
+}
+
+// newClientCert writes a new CA to caFile and returns a client certificate
+// signed by it.
+func newClientCert(t *testing.T, caFile string, commonName string, email string) tls.Certificate {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "client CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0o644))
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(2),
+		Subject:        pkix.Name{CommonName: commonName},
+		EmailAddresses: []string{email},
+		NotBefore:      time.Now().Add(-time.Minute),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caTemplate, &key.PublicKey, caKey)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -0,0 +1,547 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// transcodingRoute is a REST endpoint derived from a google.api.http rule.
+type transcodingRoute struct {
+	method       protoreflect.MethodDescriptor
+	httpMethod   string
+	template     string
+	pattern      *regexp.Regexp
+	fields       []string
+	body         string
+	responseBody string
+}
+
+// transcoder exposes unary gRPC methods annotated with google.api.http rules
+// as REST endpoints.
+type transcoder struct {
+	routes []transcodingRoute
+}
+
+// newTranscoder collects the HTTP rules, including additional bindings, of all
+// unary methods of the given services.
+func newTranscoder(services []protoreflect.ServiceDescriptor) (*transcoder, error) {
+	t := &transcoder{}
+	for _, sd := range services {
+		for i := 0; i < sd.Methods().Len(); i++ {
+			md := sd.Methods().Get(i)
+			rule, err := httpRule(md)
+			if err != nil {
+				return nil, fmt.Errorf("read google.api.http option of %v: %w", md.FullName(), err)
+			}
+			if rule == nil {
+				continue
+			}
+			if md.IsStreamingClient() || md.IsStreamingServer() {
+				slog.Warn("Skipping HTTP transcoding for streaming method", slog.String("method", string(md.FullName())))
+				continue
+			}
+
+			bindings := append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...)
+			for _, b := range bindings {
+				route, err := newTranscodingRoute(md, b)
+				if err != nil {
+					return nil, fmt.Errorf("google.api.http option of %v: %w", md.FullName(), err)
+				}
+				slog.Info("registering HTTP transcoding route",
+					slog.String("method", string(md.FullName())),
+					slog.String("http_method", route.httpMethod),
+					slog.String("path", route.template),
+				)
+				t.routes = append(t.routes, route)
+			}
+		}
+	}
+
+	// Literal paths take precedence over templates, e.g. /v1/users/me over
+	// /v1/users/{id}.
+	sort.SliceStable(t.routes, func(i, j int) bool {
+		a, b := t.routes[i], t.routes[j]
+		if len(a.fields) != len(b.fields) {
+			return len(a.fields) < len(b.fields)
+		}
+		return a.template < b.template
+	})
+	return t, nil
+}
+
+// httpRule returns the google.api.http rule of the method, or nil if the
+// method isn't annotated. Options that were not interpreted by the compiler
+// are parsed from their text format representation.
+func httpRule(md protoreflect.MethodDescriptor) (*annotations.HttpRule, error) {
+	opts, ok := md.Options().(*descriptorpb.MethodOptions)
+	if !ok || opts == nil {
+		return nil, nil
+	}
+
+	// Re-parse the options so extensions stored as unknown fields are resolved.
+	b, err := proto.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	resolved := &descriptorpb.MethodOptions{}
+	if err := (proto.UnmarshalOptions{Resolver: protoregistry.GlobalTypes}).Unmarshal(b, resolved); err != nil {
+		return nil, err
+	}
+	if proto.HasExtension(resolved, annotations.E_Http) {
+		return proto.GetExtension(resolved, annotations.E_Http).(*annotations.HttpRule), nil
+	}
+
+	for _, opt := range resolved.GetUninterpretedOption() {
+		name := opt.GetName()
+		if len(name) != 1 || !name[0].GetIsExtension() ||
+			strings.TrimPrefix(name[0].GetNamePart(), ".") != string(annotations.E_Http.TypeDescriptor().FullName()) {
+			continue
+		}
+		rule := &annotations.HttpRule{}
+		if err := prototext.Unmarshal([]byte(opt.GetAggregateValue()), rule); err != nil {
+			return nil, err
+		}
+		return rule, nil
+	}
+
+	return nil, nil
+}
+
+func newTranscodingRoute(md protoreflect.MethodDescriptor, rule *annotations.HttpRule) (transcodingRoute, error) {
+	route := transcodingRoute{
+		method:       md,
+		body:         rule.GetBody(),
+		responseBody: rule.GetResponseBody(),
+	}
+
+	switch p := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		route.httpMethod, route.template = http.MethodGet, p.Get
+	case *annotations.HttpRule_Put:
+		route.httpMethod, route.template = http.MethodPut, p.Put
+	case *annotations.HttpRule_Post:
+		route.httpMethod, route.template = http.MethodPost, p.Post
+	case *annotations.HttpRule_Delete:
+		route.httpMethod, route.template = http.MethodDelete, p.Delete
+	case *annotations.HttpRule_Patch:
+		route.httpMethod, route.template = http.MethodPatch, p.Patch
+	case *annotations.HttpRule_Custom:
+		route.httpMethod, route.template = p.Custom.GetKind(), p.Custom.GetPath()
+	default:
+		return transcodingRoute{}, fmt.Errorf("missing HTTP pattern")
+	}
+
+	if route.body != "" && route.body != "*" && md.Input().Fields().ByName(protoreflect.Name(route.body)) == nil {
+		return transcodingRoute{}, fmt.Errorf("body field %q not found in %v", route.body, md.Input().FullName())
+	}
+	if route.responseBody != "" && md.Output().Fields().ByName(protoreflect.Name(route.responseBody)) == nil {
+		return transcodingRoute{}, fmt.Errorf("response body field %q not found in %v", route.responseBody, md.Output().FullName())
+	}
+
+	pattern, fields, err := compilePathTemplate(route.template)
+	if err != nil {
+		return transcodingRoute{}, fmt.Errorf("path template %q: %w", route.template, err)
+	}
+	route.pattern = pattern
+	route.fields = fields
+
+	return route, nil
+}
+
+// compilePathTemplate converts a google.api.http path template into a regular
+// expression with one capture group per variable, in order of appearance.
+//
+//	Template = "/" Segments [ Verb ] ;
+//	Segments = Segment { "/" Segment } ;
+//	Segment  = "*" | "**" | LITERAL | Variable ;
+//	Variable = "{" FieldPath [ "=" Segments ] "}" ;
+//	Verb     = ":" LITERAL ;
+func compilePathTemplate(tmpl string) (*regexp.Regexp, []string, error) {
+	if !strings.HasPrefix(tmpl, "/") {
+		return nil, nil, fmt.Errorf("must start with /")
+	}
+
+	path, verb := tmpl[1:], ""
+	if i := strings.LastIndex(path, ":"); i >= 0 && !strings.ContainsAny(path[i:], "/}") {
+		path, verb = path[:i], path[i+1:]
+	}
+
+	var fields []string
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(path); {
+		expr.WriteString("/")
+
+		if path[i] == '{' {
+			end := strings.IndexByte(path[i:], '}')
+			if end < 0 {
+				return nil, nil, fmt.Errorf("unterminated variable")
+			}
+			field, segments, hasSegments := strings.Cut(path[i+1:i+end], "=")
+			if field == "" {
+				return nil, nil, fmt.Errorf("empty variable")
+			}
+			if !hasSegments {
+				segments = "*"
+			}
+			fields = append(fields, field)
+			expr.WriteString("(" + segmentsExpr(segments) + ")")
+			i += end + 1
+		} else {
+			end := strings.IndexByte(path[i:], '/')
+			if end < 0 {
+				end = len(path) - i
+			}
+			expr.WriteString(segmentsExpr(path[i : i+end]))
+			i += end
+		}
+
+		if i < len(path) {
+			if path[i] != '/' {
+				return nil, nil, fmt.Errorf("unexpected %q at offset %d", path[i], i+1)
+			}
+			i++
+		}
+	}
+	if verb != "" {
+		expr.WriteString(regexp.QuoteMeta(":" + verb))
+	}
+	expr.WriteString("$")
+
+	pattern, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	return pattern, fields, nil
+}
+
+func segmentsExpr(segments string) string {
+	parts := strings.Split(segments, "/")
+	for i, p := range parts {
+		switch p {
+		case "*":
+			parts[i] = "[^/]+"
+		case "**":
+			parts[i] = ".*"
+		default:
+			parts[i] = regexp.QuoteMeta(p)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// match returns the most specific route matching the request method and path, and the
+// unescaped values of its path variables.
+func (t *transcoder) match(r *http.Request) (transcodingRoute, []string, bool) {
+	path := r.URL.EscapedPath()
+	for _, route := range t.routes {
+		if route.httpMethod != r.Method {
+			continue
+		}
+		m := route.pattern.FindStringSubmatch(path)
+		if m == nil {
+			continue
+		}
+		values := make([]string, 0, len(m)-1)
+		for _, v := range m[1:] {
+			if unescaped, err := url.PathUnescape(v); err == nil {
+				v = unescaped
+			}
+			values = append(values, v)
+		}
+		return route, values, true
+	}
+	return transcodingRoute{}, nil, false
+}
+
+// serveTranscoded builds the input message from the request path, query and
+// body, calls the gRPC server and writes the output message as JSON.
+func serveTranscoded(grpcServer http.Handler, route transcodingRoute, values []string, w http.ResponseWriter, r *http.Request) {
+	input, err := route.input(r, values)
+	if err != nil {
+		writeTranscodingError(w, status.New(codes.InvalidArgument, err.Error()), nil)
+		return
+	}
+
+	msg, err := proto.Marshal(input)
+	if err != nil {
+		writeTranscodingError(w, status.New(codes.Internal, err.Error()), nil)
+		return
+	}
+
+	var header http.Header
+	var messages [][]byte
+	reader := newGRPCResponseReader(
+		func(h http.Header) { header = h },
+		func(b []byte) error {
+			messages = append(messages, bytes.Clone(b))
+			return nil
+		},
+	)
+	req := newGRPCRequest(r, bytes.NewReader(grpcFrame(0, msg)))
+	req.URL.Path = "/" + string(route.method.Parent().FullName()) + "/" + string(route.method.Name())
+	req.URL.RawPath = ""
+	req.URL.RawQuery = ""
+	grpcServer.ServeHTTP(reader, req)
+
+	metadata := http.Header{}
+	copyGRPCMetadata(metadata, header)
+	for k, v := range reader.trailers() {
+		if isGRPCMetadataHeader(k) {
+			metadata["Grpc-Trailer-"+k] = v
+		}
+	}
+
+	st := reader.status()
+	if st.Code() != codes.OK {
+		writeTranscodingError(w, st, metadata)
+		return
+	}
+	if len(messages) != 1 {
+		writeTranscodingError(w, status.New(codes.Internal, fmt.Sprintf("expected 1 response message, got %d", len(messages))), metadata)
+		return
+	}
+
+	out, err := route.output(messages[0])
+	if err != nil {
+		writeTranscodingError(w, status.New(codes.Internal, err.Error()), metadata)
+		return
+	}
+
+	for k, v := range metadata {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(out); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to write transcoded response", slog.String("error", err.Error()))
+	}
+}
+
+// input builds the method's input message. Path variables take precedence
+// over the body, and query parameters populate the remaining fields unless
+// the whole message is read from the body.
+func (route transcodingRoute) input(r *http.Request, values []string) (*dynamicpb.Message, error) {
+	input := dynamicpb.NewMessage(route.method.Input())
+
+	if route.body != "" {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("read body: %w", err)
+		}
+		if len(bytes.TrimSpace(body)) > 0 {
+			if route.body == "*" {
+				if err := protojson.Unmarshal(body, input); err != nil {
+					return nil, fmt.Errorf("unmarshal body: %w", err)
+				}
+			} else {
+				// Wrap the body so protojson handles any field kind.
+				name, err := json.Marshal(route.body)
+				if err != nil {
+					return nil, err
+				}
+				wrapped := append(append(append([]byte("{"), name...), ':'), body...)
+				wrapped = append(wrapped, '}')
+				if err := protojson.Unmarshal(wrapped, input); err != nil {
+					return nil, fmt.Errorf("unmarshal body: %w", err)
+				}
+			}
+		}
+	}
+
+	bound := map[string]bool{}
+	for i, field := range route.fields {
+		bound[field] = true
+		if err := setFieldPath(input, field, values[i]); err != nil {
+			return nil, fmt.Errorf("path parameter %q: %w", field, err)
+		}
+	}
+
+	if route.body == "*" {
+		return input, nil
+	}
+	for key, vals := range r.URL.Query() {
+		if bound[key] || (route.body != "" && strings.HasPrefix(key+".", route.body+".")) {
+			continue
+		}
+		for _, v := range vals {
+			err := setFieldPath(input, key, v)
+			if errors.Is(err, errUnknownField) {
+				// Unknown query parameters are ignored.
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("query parameter %q: %w", key, err)
+			}
+		}
+	}
+
+	return input, nil
+}
+
+// output converts the binary output message into the JSON response body.
+func (route transcodingRoute) output(b []byte) ([]byte, error) {
+	output := dynamicpb.NewMessage(route.method.Output())
+	if err := proto.Unmarshal(b, output); err != nil {
+		return nil, fmt.Errorf("unmarshal %v: %w", route.method.Output().FullName(), err)
+	}
+
+	if route.responseBody == "" {
+		return protojson.Marshal(output)
+	}
+
+	fd := output.Descriptor().Fields().ByName(protoreflect.Name(route.responseBody))
+	out, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(output)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(out, &fields); err != nil {
+		return nil, err
+	}
+	return fields[fd.JSONName()], nil
+}
+
+var errUnknownField = errors.New("unknown field")
+
+// setFieldPath sets the field addressed by a dot-separated path of field names
+// to the parsed value. Values of repeated fields are appended.
+func setFieldPath(msg protoreflect.Message, path string, value string) error {
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		fd := msg.Descriptor().Fields().ByName(protoreflect.Name(part))
+		if fd == nil {
+			fd = msg.Descriptor().Fields().ByJSONName(part)
+		}
+		if fd == nil {
+			return errUnknownField
+		}
+
+		if i < len(parts)-1 {
+			if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+				return fmt.Errorf("%q is not a singular message field", part)
+			}
+			msg = msg.Mutable(fd).Message()
+			continue
+		}
+
+		if fd.IsMap() {
+			return fmt.Errorf("map fields are not supported")
+		}
+		v, err := parseFieldValue(msg, fd, value)
+		if err != nil {
+			return err
+		}
+		if fd.IsList() {
+			msg.Mutable(fd).List().Append(v)
+		} else {
+			msg.Set(fd, v)
+		}
+	}
+	return nil
+}
+
+func parseFieldValue(msg protoreflect.Message, fd protoreflect.FieldDescriptor, value string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		v, err := strconv.ParseBool(value)
+		return protoreflect.ValueOfBool(v), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		v, err := strconv.ParseInt(value, 10, 32)
+		return protoreflect.ValueOfInt32(int32(v)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		v, err := strconv.ParseInt(value, 10, 64)
+		return protoreflect.ValueOfInt64(v), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		v, err := strconv.ParseUint(value, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(v)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		v, err := strconv.ParseUint(value, 10, 64)
+		return protoreflect.ValueOfUint64(v), err
+	case protoreflect.FloatKind:
+		v, err := strconv.ParseFloat(value, 32)
+		return protoreflect.ValueOfFloat32(float32(v)), err
+	case protoreflect.DoubleKind:
+		v, err := strconv.ParseFloat(value, 64)
+		return protoreflect.ValueOfFloat64(v), err
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(value), nil
+	case protoreflect.BytesKind:
+		v, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			v, err = base64.URLEncoding.DecodeString(value)
+		}
+		return protoreflect.ValueOfBytes(v), err
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(value)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		v, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid value %q for enum %v", value, fd.Enum().FullName())
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(v)), nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		// Well-known types such as Timestamp or wrappers have a JSON string or
+		// scalar representation.
+		var v protoreflect.Value
+		if fd.IsList() {
+			v = msg.Mutable(fd).List().NewElement()
+		} else {
+			v = msg.NewField(fd)
+		}
+		quoted, err := json.Marshal(value)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		if err := protojson.Unmarshal(quoted, v.Message().Interface()); err != nil {
+			if err := protojson.Unmarshal([]byte(value), v.Message().Interface()); err != nil {
+				return protoreflect.Value{}, fmt.Errorf("invalid value %q for %v", value, fd.Message().FullName())
+			}
+		}
+		return v, nil
+	}
+	return protoreflect.Value{}, fmt.Errorf("unsupported field kind %v", fd.Kind())
+}
+
+// transcodingError is the JSON representation of a google.rpc.Status.
+type transcodingError struct {
+	Code    int32  `json:"code"`
+	Message string `json:"message"`
+	Details []any  `json:"details"`
+}
+
+func writeTranscodingError(w http.ResponseWriter, st *status.Status, metadata http.Header) {
+	for k, v := range metadata {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatusFromCode(st.Code()))
+	_ = json.NewEncoder(w).Encode(transcodingError{
+		Code:    int32(st.Code()),
+		Message: st.Message(),
+		Details: []any{},
+	})
+}
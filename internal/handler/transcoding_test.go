@@ -0,0 +1,214 @@
+package handler_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/handler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const transcodingProto = `syntax = "proto3";
+package library;
+
+import "google/api/annotations.proto";
+
+service Library {
+  rpc GetBook(GetBookRequest) returns (Book) {
+    option (google.api.http) = {
+      get: "/v1/{name=shelves/*/books/*}"
+      additional_bindings { get: "/v1/books/{name}" }
+    };
+  }
+  rpc CreateBook(CreateBookRequest) returns (Book) {
+    option (google.api.http) = {
+      post: "/v1/{parent=shelves/*}/books"
+      body: "book"
+    };
+  }
+  rpc UpdateBook(Book) returns (Book) {
+    option (google.api.http) = {
+      patch: "/v1/{name=shelves/*/books/*}:update"
+      body: "*"
+    };
+  }
+  rpc DeleteBook(GetBookRequest) returns (Book) {
+    option (google.api.http) = {
+      delete: "/v1/{name=shelves/*/books/*}"
+    };
+  }
+  rpc GetCurrentBook(GetBookRequest) returns (Book) {
+    option (google.api.http) = {
+      get: "/v1/books/current"
+    };
+  }
+}
+
+message GetBookRequest {
+  string name = 1;
+  int32 version = 2;
+}
+
+message CreateBookRequest {
+  string parent = 1;
+  Book book = 2;
+}
+
+message Book {
+  string name = 1;
+  string title = 2;
+}
+`
+
+func TestHTTPTranscoding(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	protoDir := filepath.Join(root, "protos")
+	stubDir := filepath.Join(root, "stubs")
+	require.NoError(t, os.MkdirAll(protoDir, 0o755))
+	require.NoError(t, os.MkdirAll(stubDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(protoDir, "library.proto"), []byte(transcodingProto), 0o644))
+
+	// Every stub matches on its input, so each mapping of path variables,
+	// query parameters and bodies into the request message is checked.
+	stubs := map[string]string{
+		"get.json":     `{"service": "library.Library", "method": "GetBook", "input": {"name": "shelves/1/books/2", "version": 3}, "output": {"data": {"name": "shelves/1/books/2", "title": "Dune"}}}`,
+		"get_id.json":  `{"service": "library.Library", "method": "GetBook", "input": {"name": "2"}, "output": {"data": {"name": "books/2", "title": "Dune"}}}`,
+		"create.json":  `{"service": "library.Library", "method": "CreateBook", "input": {"parent": "shelves/1", "book": {"title": "Emma"}}, "output": {"data": {"name": "shelves/1/books/3", "title": "Emma"}}}`,
+		"update.json":  `{"service": "library.Library", "method": "UpdateBook", "input": {"name": "shelves/1/books/2", "title": "Updated"}, "output": {"data": {"name": "shelves/1/books/2", "title": "Updated"}}}`,
+		"current.json": `{"service": "library.Library", "method": "GetCurrentBook", "output": {"data": {"name": "books/7", "title": "Emma"}}}`,
+		"delete.json":  `{"service": "library.Library", "method": "DeleteBook", "input": {"name": "shelves/1/books/2"}, "output": {"code": 5, "error": "book not found"}}`,
+	}
+	for name, content := range stubs {
+		require.NoError(t, os.WriteFile(filepath.Join(stubDir, name), []byte(content), 0o644))
+	}
+
+	h, err := handler.New("", protoDir, stubDir)
+	require.NoError(t, err)
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+
+	cases := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "path template",
+			method:     http.MethodGet,
+			path:       "/v1/shelves/1/books/2?version=3",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"name": "shelves/1/books/2", "title": "Dune"}`,
+		},
+		{
+			name:       "additional binding",
+			method:     http.MethodGet,
+			path:       "/v1/books/2",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"name": "books/2", "title": "Dune"}`,
+		},
+		{
+			name:       "literal path before template",
+			method:     http.MethodGet,
+			path:       "/v1/books/current",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"name": "books/7", "title": "Emma"}`,
+		},
+		{
+			name:       "query parameter mismatch",
+			method:     http.MethodGet,
+			path:       "/v1/shelves/1/books/2?version=4",
+			wantStatus: http.StatusNotFound,
+			wantBody:   `{"code": 5, "message": "No stub configured", "details": []}`,
+		},
+		{
+			name:       "path variable mismatch",
+			method:     http.MethodGet,
+			path:       "/v1/shelves/2/books/2?version=3",
+			wantStatus: http.StatusNotFound,
+			wantBody:   `{"code": 5, "message": "No stub configured", "details": []}`,
+		},
+		{
+			name:       "body field mismatch",
+			method:     http.MethodPost,
+			path:       "/v1/shelves/1/books",
+			body:       `{"title": "Persuasion"}`,
+			wantStatus: http.StatusNotFound,
+			wantBody:   `{"code": 5, "message": "No stub configured", "details": []}`,
+		},
+		{
+			name:       "body wildcard mismatch",
+			method:     http.MethodPatch,
+			path:       "/v1/shelves/1/books/2:update",
+			body:       `{"title": "Other"}`,
+			wantStatus: http.StatusNotFound,
+			wantBody:   `{"code": 5, "message": "No stub configured", "details": []}`,
+		},
+		{
+			name:       "body field",
+			method:     http.MethodPost,
+			path:       "/v1/shelves/1/books",
+			body:       `{"title": "Emma"}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"name": "shelves/1/books/3", "title": "Emma"}`,
+		},
+		{
+			name:       "body wildcard with verb",
+			method:     http.MethodPatch,
+			path:       "/v1/shelves/1/books/2:update",
+			body:       `{"title": "Updated"}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"name": "shelves/1/books/2", "title": "Updated"}`,
+		},
+		{
+			name:       "invalid query parameter",
+			method:     http.MethodGet,
+			path:       "/v1/shelves/1/books/2?version=abc",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "stub error",
+			method:     http.MethodDelete,
+			path:       "/v1/shelves/1/books/2",
+			wantStatus: http.StatusNotFound,
+			wantBody:   `{"code": 5, "message": "book not found", "details": []}`,
+		},
+		{
+			name:       "no route",
+			method:     http.MethodGet,
+			path:       "/v1/shelves/1",
+			wantStatus: http.StatusNotImplemented,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, server.URL+tc.path, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer func() {
+				require.NoError(t, resp.Body.Close())
+			}()
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.Equal(t, tc.wantStatus, resp.StatusCode, string(body))
+			if tc.wantBody != "" {
+				assert.JSONEq(t, tc.wantBody, string(body))
+			}
+		})
+	}
+}
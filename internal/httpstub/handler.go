@@ -2,51 +2,118 @@
 package httpstub
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/certs"
 )
 
 // Handler is an HTTP handler that serves predefined HTTP stubs.
 type Handler struct {
-	stubs *Storage
+	stubs    *Storage
+	recorder *recorder
+	proxy    *proxy
 }
 
 var _ http.Handler = &Handler{}
 
+// Options controls optional HTTP handler features.
+type Options struct {
+	// Stubs are served in addition to the stubs loaded from the stub
+	// directory, which take precedence among stubs of the same match type.
+	Stubs []Stub
+	// Proxy forwards requests without a matching stub to an upstream server
+	// per path prefix, before recording is considered.
+	Proxy []ProxyRoute
+	// RecordUpstream is the base URL requests without a matching stub are
+	// forwarded to. The responses are saved as stubs in the stub directory.
+	RecordUpstream string
+	// StubDirs lists additional stub directories loaded after the stub
+	// directory.
+	StubDirs []string
+}
+
 // NewHandler creates a new Handler by loading HTTP stubs from the specified directory.
 func NewHandler(stubDir string) (*Handler, error) {
+	return NewHandlerWithOptions(stubDir, Options{})
+}
+
+// NewHandlerWithOptions creates a new Handler with configurable options.
+func NewHandlerWithOptions(stubDir string, opts Options) (*Handler, error) {
 	storage := NewStorage()
-	if err := loadStubs(stubDir, storage); err != nil {
-		return nil, fmt.Errorf("load HTTP stubs from %v: %w ", stubDir, err)
+	for _, dir := range append([]string{stubDir}, opts.StubDirs...) {
+		if dir == "" {
+			continue
+		}
+		if err := loadStubs(dir, storage); err != nil {
+			return nil, fmt.Errorf("load HTTP stubs from %v: %w ", dir, err)
+		}
+	}
+	for _, stub := range opts.Stubs {
+		storage.Add(stub)
 	}
 
-	return &Handler{
+	h := &Handler{
 		stubs: storage,
-	}, nil
+	}
+	if len(opts.Proxy) > 0 {
+		p, err := newProxy(opts.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("configure proxy: %w", err)
+		}
+		h.proxy = p
+	}
+	if opts.RecordUpstream != "" {
+		rec, err := newRecorder(opts.RecordUpstream, stubDir, storage)
+		if err != nil {
+			return nil, fmt.Errorf("configure recording: %w", err)
+		}
+		h.recorder = rec
+	}
+
+	return h, nil
 }
 
 // ServeHTTP serves HTTP requests based on the loaded stubs.
 func (s *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	inv := HTTPInvocation{
-		Method:  r.Method,
-		Path:    r.URL.Path,
-		Query:   r.URL.Query(),
-		Headers: r.Header,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Query:      r.URL.Query(),
+		Headers:    r.Header,
+		ClientCert: certs.Peer(r.TLS),
 	}
 
+	var body []byte
 	if r.Body != nil {
-		if _, err := io.Copy(io.Discard, r.Body); err != nil {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
 			slog.ErrorContext(r.Context(), "Error reading body", slog.String("error", err.Error()))
 			http.Error(w, "Error reading request body", http.StatusInternalServerError)
 			return
 		}
 	}
 
+	inv.Body = body
+
 	stub, ok := s.stubs.Find(inv)
 	if ok {
-		stub.Invoke(w)
+		stub.Invoke(w, r)
+		return
+	}
+
+	if p, ok := s.proxy.route(r.URL.Path); ok {
+		slog.InfoContext(r.Context(), "Stub not found, proxying request", slog.String("path", r.URL.Path), slog.String("method", r.Method))
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		p.ServeHTTP(w, r)
+		return
+	}
+
+	if s.recorder != nil {
+		s.recorder.serve(w, r, body)
 		return
 	}
 
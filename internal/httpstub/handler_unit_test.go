@@ -18,7 +18,7 @@ type recordingStub struct {
 
 func (s *recordingStub) Matches(HTTPInvocation) bool { return s.match }
 func (s *recordingStub) Type() MatchType             { return MatchExact }
-func (s *recordingStub) Invoke(w http.ResponseWriter) {
+func (s *recordingStub) Invoke(w http.ResponseWriter, _ *http.Request) {
 	s.called = true
 	w.WriteHeader(s.status)
 }
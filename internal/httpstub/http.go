@@ -2,26 +2,57 @@ package httpstub
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/textproto"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/diag"
 )
 
-// HTTPStub represents a predefined HTTP stub.
+// HTTPStub represents a predefined HTTP stub read from a raw HTTP response
+// file. Path and HTTPMethod are taken from the location of the file. An
+// optional request section above the response restricts the stub to requests
+// with the given query parameters, headers and body; others are ignored.
 type HTTPStub struct {
 	Path         string
 	HTTPMethod   string
 	ResponsePath string
+	Query        map[string]string
+	Headers      map[string]string
+	// Body is the request body, nil to match any body.
+	Body []byte
 }
 
 var _ Stub = &HTTPStub{}
 
 // Matches checks if the HTTPStub matches the given HTTP request.
 func (s *HTTPStub) Matches(inv HTTPInvocation) bool {
-	return inv.Path == s.Path && (s.HTTPMethod == "*" || inv.Method == s.HTTPMethod)
+	if inv.Path != s.Path || (s.HTTPMethod != "*" && inv.Method != s.HTTPMethod) {
+		return false
+	}
+	for k, v := range s.Query {
+		if inv.Query.Get(k) != v {
+			return false
+		}
+	}
+	for k, v := range s.Headers {
+		if inv.Headers.Get(k) != v {
+			return false
+		}
+	}
+	return s.Body == nil || bodyEqual(s.Body, inv.Body)
 }
 
 // Type returns the MatchType
@@ -29,39 +60,100 @@ func (s HTTPStub) Type() MatchType {
 	return MatchExact
 }
 
+// specificity is the number of request criteria of the stub.
+func (s *HTTPStub) specificity() int {
+	n := len(s.Query) + len(s.Headers)
+	if s.Body != nil {
+		n++
+	}
+	return n
+}
+
 // Invoke writes the HTTPStub response to the provided http.ResponseWriter.
-func (s *HTTPStub) Invoke(w http.ResponseWriter) {
-	f, err := os.Open(s.ResponsePath)
+// The file is read on every call, so it can be edited while the server runs.
+func (s *HTTPStub) Invoke(w http.ResponseWriter, _ *http.Request) {
+	data, err := os.ReadFile(s.ResponsePath)
+	if err != nil {
+		http.Error(w, "Failed to read response", http.StatusInternalServerError)
+		return
+	}
+	_, response, err := splitHTTPFile(data)
 	if err != nil {
 		http.Error(w, "Failed to read response", http.StatusInternalServerError)
 		return
 	}
-	defer func() {
-		_ = f.Close()
-	}()
 
 	req := &http.Request{
 		Method: s.HTTPMethod,
 	}
-	resp, err := http.ReadResponse(bufio.NewReader(f), req)
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(response)), req)
 	if err != nil {
 		http.Error(w, "Failed to write response", http.StatusInternalServerError)
 		return
 	}
 	defer resp.Body.Close() //nolint:errcheck
 
-	for k, val := range resp.Header {
-		for _, v := range val {
-			w.Header().Set(k, v)
-		}
+	addHeader(w.Header(), resp.Header)
+	if resp.Header.Get("Content-Encoding") != "" && resp.Header.Get("Content-Type") == "" {
+		// Keep net/http from sniffing the type of the encoded body.
+		w.Header()["Content-Type"] = nil
 	}
+	declareTrailer(w.Header(), resp.Trailer)
 
 	w.WriteHeader(resp.StatusCode)
 
-	if _, err := io.Copy(w, resp.Body); err != nil {
-		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+	if slices.Contains(resp.TransferEncoding, "chunked") {
+		err = copyChunks(w, resp.Body)
+	} else {
+		_, err = io.Copy(w, resp.Body)
+	}
+	if err != nil {
+		slog.Error("Failed to write response", slog.String("file", s.ResponsePath), slog.String("error", err.Error()))
 		return
 	}
+
+	// The trailer values are known once the body has been read.
+	addHeader(w.Header(), resp.Trailer)
+}
+
+// copyChunks copies a chunked body, flushing every chunk as it is read so
+// the response is sent chunked as well.
+func copyChunks(w http.ResponseWriter, body io.Reader) error {
+	rc := http.NewResponseController(w)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+			_ = rc.Flush()
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// addHeader adds all values of src to dst, keeping multiple values like
+// those of Set-Cookie.
+func addHeader(dst http.Header, src http.Header) {
+	for k, values := range src {
+		for _, v := range values {
+			dst.Add(k, v)
+		}
+	}
+}
+
+// declareTrailer announces the trailer keys in the Trailer header, which has
+// to be done before the header is written.
+func declareTrailer(header http.Header, trailer http.Header) {
+	for k := range trailer {
+		header.Add("Trailer", k)
+	}
 }
 
 // Validate validates the HTTPStub fields.
@@ -82,7 +174,8 @@ func (s *HTTPStub) Validate() error {
 }
 
 func loadHTTPFile(root string, path string) (s Stub, err error) {
-	if _, err := os.Stat(path); err != nil {
+	data, err := os.ReadFile(path)
+	if err != nil {
 		return nil, fmt.Errorf("open file: %v: %w", path, err)
 	}
 
@@ -106,9 +199,112 @@ func loadHTTPFile(root string, path string) (s Stub, err error) {
 		ResponsePath: path,
 	}
 
+	request, response, err := splitHTTPFile(data)
+	if err != nil {
+		return nil, &diag.Error{File: path, Err: err}
+	}
+	if request != nil {
+		if err := stub.parseRequest(request); err != nil {
+			return nil, &diag.Error{File: path, Line: 1, Err: fmt.Errorf("request section: %w", err)}
+		}
+	}
+	if err := checkResponse(response, method); err != nil {
+		line := bytes.Count(data[:len(data)-len(response)], []byte("\n")) + 1
+		return nil, &diag.Error{File: path, Line: line, Err: fmt.Errorf("response section: %w", err)}
+	}
+
 	if err := stub.Validate(); err != nil {
 		return nil, fmt.Errorf("stub validation %v: %w", path, err)
 	}
 
 	return &stub, nil
 }
+
+// statusLine matches the status line starting the response of a raw HTTP
+// stub file.
+var statusLine = regexp.MustCompile(`(?m)^HTTP/\d(\.\d)? \d{3}\b`)
+
+// splitHTTPFile splits a raw HTTP stub file into the optional request section
+// and the response, which starts at the first status line.
+func splitHTTPFile(data []byte) ([]byte, []byte, error) {
+	loc := statusLine.FindIndex(data)
+	if loc == nil {
+		return nil, nil, errors.New("no HTTP response status line")
+	}
+	request := data[:loc[0]]
+	if len(bytes.TrimSpace(request)) == 0 {
+		return nil, data[loc[0]:], nil
+	}
+	return request, data[loc[0]:], nil
+}
+
+// checkResponse reads the response section like Invoke does, so responses
+// that can't be served are reported when the stub is loaded.
+func checkResponse(response []byte, method string) error {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(response)), &http.Request{Method: method})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
+
+// parseRequest sets the request criteria from a request section: a request
+// line like "GET /users?active=true HTTP/1.1", headers and an optional body.
+// Method and path must match the location of the file.
+func (s *HTTPStub) parseRequest(data []byte) error {
+	r := textproto.NewReader(bufio.NewReader(bytes.NewReader(data)))
+	line, err := r.ReadLine()
+	if err != nil {
+		return fmt.Errorf("read request line: %w", err)
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return fmt.Errorf("malformed request line %q", line)
+	}
+	target, err := url.ParseRequestURI(fields[1])
+	if err != nil {
+		return fmt.Errorf("request target: %w", err)
+	}
+	if fields[0] != s.HTTPMethod || target.Path != s.Path {
+		return fmt.Errorf("request line %v %v does not match the stub location %v %v", fields[0], target.Path, s.HTTPMethod, s.Path)
+	}
+	for k := range target.Query() {
+		if s.Query == nil {
+			s.Query = map[string]string{}
+		}
+		s.Query[k] = target.Query().Get(k)
+	}
+
+	header, err := r.ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("read headers: %w", err)
+	}
+	for k, v := range header {
+		if s.Headers == nil {
+			s.Headers = map[string]string{}
+		}
+		s.Headers[k] = v[0]
+	}
+
+	body, err := io.ReadAll(r.R)
+	if err != nil {
+		return fmt.Errorf("read body: %w", err)
+	}
+	if body = bytes.TrimRight(body, "\r\n"); len(body) > 0 {
+		s.Body = body
+	}
+	return nil
+}
+
+// bodyEqual reports whether the request body matches the body of a stub.
+// JSON bodies are compared by value, others byte by byte ignoring trailing
+// line breaks.
+func bodyEqual(want []byte, got []byte) bool {
+	var wantJSON, gotJSON any
+	if json.Unmarshal(want, &wantJSON) == nil && json.Unmarshal(got, &gotJSON) == nil {
+		return reflect.DeepEqual(wantJSON, gotJSON)
+	}
+	return bytes.Equal(want, bytes.TrimRight(got, "\r\n"))
+}
@@ -93,7 +93,7 @@ func TestHTTPStubInvoke_InvalidFile(t *testing.T) {
 	}
 
 	rec := httptest.NewRecorder()
-	stub.Invoke(rec)
+	stub.Invoke(rec, httptest.NewRequest(http.MethodGet, "/echo", nil))
 
 	require.Equal(t, http.StatusInternalServerError, rec.Code)
 }
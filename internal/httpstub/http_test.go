@@ -1,12 +1,15 @@
 package httpstub
 
 import (
+	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -59,3 +62,144 @@ func serveGet(t *testing.T, handler http.Handler, path string) httpResponse {
 func rawHTTPResponse(body string) string {
 	return fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Length: %d\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s", len(body), body)
 }
+
+func TestRawHTTPStubRequestSection(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	stubDir := filepath.Join(root, "users", "POST")
+	require.NoError(t, os.MkdirAll(stubDir, 0o755))
+	files := map[string]string{
+		"a-fallback.http": rawHTTPResponse("fallback"),
+		"b-admin.http":    "POST /users?role=admin HTTP/1.1\r\n\r\n" + rawHTTPResponse("admin"),
+		"c-json.http":     "POST /users HTTP/1.1\nContent-Type: application/json\n\n{\"name\": \"jane\"}\n\n" + rawHTTPResponse("jane"),
+		"d-text.http":     "POST /users\n\nplain body\n" + rawHTTPResponse("text"),
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(stubDir, name), []byte(content), 0o644))
+	}
+
+	handler, err := NewHandler(root)
+	require.NoError(t, err)
+	// A request with both the admin query and the text body is served by the
+	// admin stub.
+	err = Validate(root)
+	require.ErrorContains(t, err, "d-text.http: stub overlaps")
+	require.ErrorContains(t, err, "b-admin.http, which serves their common requests")
+
+	cases := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		want        string
+	}{
+		{name: "query", target: "/users?role=admin&page=1", want: "admin"},
+		{name: "json body and header", target: "/users", contentType: "application/json", body: `{"name":"jane"}`, want: "jane"},
+		{name: "json body without header", target: "/users", body: `{"name":"jane"}`, want: "fallback"},
+		{name: "text body", target: "/users", body: "plain body\n", want: "text"},
+		{name: "fallback", target: "/users?role=user", body: "other", want: "fallback"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.target, strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusOK, rec.Code)
+			require.Equal(t, tc.want, rec.Body.String())
+		})
+	}
+}
+
+func TestRawHTTPStubRequestSectionErrors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "other path", content: "POST /orders HTTP/1.1\n\n" + rawHTTPResponse("x"), wantErr: "request line POST /orders does not match the stub location POST /users"},
+		{name: "malformed request line", content: "POST\n\n" + rawHTTPResponse("x"), wantErr: `malformed request line "POST"`},
+		{name: "no response", content: "POST /users HTTP/1.1\n", wantErr: "no HTTP response status line"},
+		{name: "HTTP/2 status line", content: "POST /users HTTP/1.1\n\nHTTP/2 200\n\nok", wantErr: `stub.http:3: response section: malformed HTTP version "HTTP/2"`},
+		{name: "malformed chunks", content: "HTTP/1.1 200 OK\nTransfer-Encoding: chunked\n\nzz\n", wantErr: "stub.http:1: response section:"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			stubDir := filepath.Join(root, "users", "POST")
+			require.NoError(t, os.MkdirAll(stubDir, 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(stubDir, "stub.http"), []byte(tc.content), 0o644))
+
+			_, err := NewHandler(root)
+			require.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestRawHTTPStubHeadersAndTrailers(t *testing.T) {
+	t.Parallel()
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write([]byte("compressed"))
+	require.NoError(t, zw.Close())
+
+	root := t.TempDir()
+	files := map[string]string{
+		"chunked/GET/stub.http": "HTTP/1.1 200 OK\r\n" +
+			"Set-Cookie: a=1\r\n" +
+			"Set-Cookie: b=2\r\n" +
+			"Link: </a>; rel=next\r\n" +
+			"Link: </b>; rel=prev\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: Grpc-Status, Grpc-Message\r\n\r\n" +
+			"5\r\nhello\r\n6\r\n world\r\n0\r\n" +
+			"Grpc-Status: 0\r\nGrpc-Message: ok\r\n\r\n",
+		"gzip/GET/stub.http": fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Encoding: gzip\r\nContent-Length: %d\r\n\r\n%s", gz.Len(), gz.String()),
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	handler, err := NewHandler(root)
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	resp, err := server.Client().Get(server.URL + "/chunked")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, "hello world", string(body))
+	require.Equal(t, []string{"a=1", "b=2"}, resp.Header.Values("Set-Cookie"))
+	require.Equal(t, []string{"</a>; rel=next", "</b>; rel=prev"}, resp.Header.Values("Link"))
+	require.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	require.Equal(t, "0", resp.Trailer.Get("Grpc-Status"))
+	require.Equal(t, "ok", resp.Trailer.Get("Grpc-Message"))
+
+	// The encoded body is sent as written, without decoding or sniffing.
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/gzip", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err = server.Client().Do(req)
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	require.Empty(t, resp.Header.Get("Content-Type"))
+	require.Equal(t, gz.Bytes(), body)
+}
@@ -1,6 +1,7 @@
 package httpstub
 
 import (
+	"crypto/x509"
 	"net/http"
 	"net/url"
 )
@@ -11,4 +12,9 @@ type HTTPInvocation struct {
 	Path    string
 	Query   url.Values
 	Headers http.Header
+	// ClientCert is the certificate presented by the client over mutual
+	// TLS, or nil.
+	ClientCert *x509.Certificate
+	// Body is the request body.
+	Body []byte
 }
@@ -1,19 +1,36 @@
 package httpstub
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/certs"
+	"github.com/randomenterprisesolutions/stub-server/internal/diag"
 )
 
-// JSONStub represents a predefined HTTP stub.
+// JSONStub represents a predefined HTTP stub. Query and Headers list query
+// parameters and request headers the request must contain with the given
+// value; others are ignored. ClientCert restricts the stub to clients
+// authenticated with a matching certificate.
 type JSONStub struct {
-	ExactPath  string       `json:"path"`
-	RegexPath  string       `json:"regex"`
-	HTTPMethod string       `json:"method"`
-	Response   JSONResponse `json:"response"`
+	ExactPath  string            `json:"path,omitempty"`
+	RegexPath  string            `json:"regex,omitempty"`
+	HTTPMethod string            `json:"method"`
+	Query      map[string]string `json:"query,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	ClientCert *certs.Matcher    `json:"clientCert,omitempty"`
+	Response   JSONResponse      `json:"response"`
 	regex      *regexp.Regexp
 }
 
@@ -21,6 +38,20 @@ var _ Stub = &JSONStub{}
 
 // Matches checks if the JSONStub matches the given HTTP request.
 func (s JSONStub) Matches(inv HTTPInvocation) bool {
+	for k, v := range s.Query {
+		if inv.Query.Get(k) != v {
+			return false
+		}
+	}
+	for k, v := range s.Headers {
+		if inv.Headers.Get(k) != v {
+			return false
+		}
+	}
+	if !s.ClientCert.Matches(inv.ClientCert) {
+		return false
+	}
+
 	if s.ExactPath != "" {
 		if s.HTTPMethod != "*" && inv.Method != s.HTTPMethod {
 			return false
@@ -41,8 +72,8 @@ func (s JSONStub) Matches(inv HTTPInvocation) bool {
 }
 
 // Invoke writes the JSONStub response to the provided http.ResponseWriter.
-func (s JSONStub) Invoke(w http.ResponseWriter) {
-	if err := s.Response.Write(w); err != nil {
+func (s JSONStub) Invoke(w http.ResponseWriter, r *http.Request) {
+	if err := s.Response.Write(w, r); err != nil {
 		http.Error(w, "Failed to write response", http.StatusInternalServerError)
 	}
 }
@@ -59,7 +90,7 @@ func (s JSONStub) Type() MatchType {
 func (s *JSONStub) Validate() error {
 	if (s.ExactPath == "" && s.RegexPath == "") ||
 		(s.ExactPath != "" && s.RegexPath != "") {
-		return errors.New(`either "path" or "regex" field is required`)
+		return diag.Field("path", errors.New(`either "path" or "regex" field is required`))
 	}
 
 	if s.HTTPMethod == "" {
@@ -69,11 +100,17 @@ func (s *JSONStub) Validate() error {
 	if s.RegexPath != "" {
 		compiled, err := regexp.Compile(s.RegexPath)
 		if err != nil {
-			return fmt.Errorf("invalid regex: %w", err)
+			return diag.Field("regex", fmt.Errorf("invalid regex: %w", err))
 		}
 		s.regex = compiled
 	}
 
+	if s.ClientCert != nil {
+		if err := s.ClientCert.Validate(); err != nil {
+			return diag.Field("clientCert", fmt.Errorf("client certificate matcher: %w", err))
+		}
+	}
+
 	if err := s.Response.Validate(); err != nil {
 		return fmt.Errorf("response validation: %w", err)
 	}
@@ -81,38 +118,234 @@ func (s *JSONStub) Validate() error {
 	return nil
 }
 
-// JSONResponse represents an HTTP response defined in a stub.
+// JSONResponse represents an HTTP response defined in a stub. The body is
+// given by its Content or, if Representations are given, by the
+// representation chosen by the Accept header of the request. Trailer values
+// are sent after the body. Compress lists the encodings the body may be
+// compressed with, chosen by the Accept-Encoding header of the request, or
+// the first one regardless of the request with ForceCompress.
 type JSONResponse struct {
-	Header http.Header    `json:"header"`
-	Body   map[string]any `json:"body"`
-	Status int            `json:"status"`
+	Header  http.Header `json:"header,omitempty"`
+	Trailer http.Header `json:"trailer,omitempty"`
+	Content
+	Representations []Representation `json:"representations,omitempty"`
+	Compress        []string         `json:"compress,omitempty"`
+	ForceCompress   bool             `json:"forceCompress,omitempty"`
+	Status          int              `json:"status"`
+}
+
+// Representation is a body of a response served to requests accepting its
+// ContentType.
+type Representation struct {
+	ContentType string `json:"contentType"`
+	Content
 }
 
-// Write writes the JSONResponse to the provided http.ResponseWriter.
-func (r JSONResponse) Write(w http.ResponseWriter) error {
-	for k, val := range r.Header {
-		for _, v := range val {
-			w.Header().Set(k, v)
+// Content is the body of a response. It is given by at most one of Body, any
+// JSON value written as is, BodyText, text written verbatim, BodyBase64, a
+// base64 encoded binary payload, and BodyFile, a file relative to the stub
+// file read on every response. The Content-Type defaults to
+// application/json, text/plain, application/octet-stream or the type of the
+// file extension respectively.
+type Content struct {
+	Body       json.RawMessage `json:"body,omitempty"`
+	BodyText   string          `json:"bodyText,omitempty"`
+	BodyBase64 string          `json:"bodyBase64,omitempty"`
+	BodyFile   string          `json:"bodyFile,omitempty"`
+	binary     []byte
+	bodyPath   string
+}
+
+// Write writes the JSONResponse to the provided http.ResponseWriter. The
+// request, which may be nil, selects the representation and encoding.
+func (r JSONResponse) Write(w http.ResponseWriter, req *http.Request) error {
+	content := r.Content
+	contentType := ""
+	if len(r.Representations) > 0 {
+		w.Header().Add("Vary", "Accept")
+		i, ok := negotiateType(r.Representations, acceptHeader(req, "Accept"))
+		if !ok {
+			http.Error(w, "Not Acceptable", http.StatusNotAcceptable)
+			return nil
 		}
+		content, contentType = r.Representations[i].Content, r.Representations[i].ContentType
 	}
 
-	w.WriteHeader(r.Status)
+	body, defaultType, err := content.open()
+	if err != nil {
+		return err
+	}
+	if c, ok := body.(io.Closer); ok {
+		defer c.Close() //nolint:errcheck
+	}
+	if contentType == "" {
+		contentType = defaultType
+	}
 
-	if r.Body == nil {
-		return nil
+	encoding := ""
+	if len(r.Compress) > 0 {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.ForceCompress {
+			encoding = r.Compress[0]
+		} else {
+			var ok bool
+			encoding, ok = negotiateEncoding(r.Compress, acceptHeader(req, "Accept-Encoding"))
+			if !ok && body != nil {
+				http.Error(w, "Not Acceptable", http.StatusNotAcceptable)
+				return nil
+			}
+		}
+	}
+	if body == nil {
+		encoding = ""
+	}
+
+	addHeader(w.Header(), r.Header)
+	if contentType != "" && (len(r.Representations) > 0 || w.Header().Get("Content-Type") == "") {
+		w.Header().Set("Content-Type", contentType)
+	}
+	declareTrailer(w.Header(), r.Trailer)
+
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+		w.Header().Del("Content-Length")
 	}
 
-	if err := json.NewEncoder(w).Encode(r.Body); err != nil {
-		return fmt.Errorf("encode body: %w", err)
+	w.WriteHeader(r.Status)
+
+	if body != nil {
+		if err := writeEncoded(w, encoding, body); err != nil {
+			return fmt.Errorf("write body: %w", err)
+		}
 	}
 
+	addHeader(w.Header(), r.Trailer)
 	return nil
 }
 
 // Validate validates the JSONResponse fields.
-func (r JSONResponse) Validate() error {
+func (r *JSONResponse) Validate() error {
 	if r.Status < 100 || r.Status > 599 {
-		return fmt.Errorf("status code %v is not valid", r.Status)
+		return diag.Field("status", fmt.Errorf("status code %v is not valid", r.Status))
+	}
+
+	if err := r.Content.validate(); err != nil {
+		return err
+	}
+	if len(r.Representations) > 0 && r.Content.set() {
+		return diag.Field("representations", errors.New(`"representations" replace the body fields of the response`))
+	}
+	for i := range r.Representations {
+		rep := &r.Representations[i]
+		if _, _, err := mime.ParseMediaType(rep.ContentType); err != nil {
+			return diag.Field("contentType", fmt.Errorf("representation %d: invalid content type %q: %w", i, rep.ContentType, err))
+		}
+		if err := rep.validate(); err != nil {
+			return fmt.Errorf("representation %d: %w", i, err)
+		}
+	}
+
+	for _, encoding := range r.Compress {
+		if !slices.Contains(encodings, encoding) {
+			return diag.Field("compress", fmt.Errorf("unsupported encoding %q, expected one of %v", encoding, strings.Join(encodings, ", ")))
+		}
+	}
+	if r.ForceCompress && len(r.Compress) == 0 {
+		return diag.Field("forceCompress", errors.New(`"forceCompress" requires an encoding in "compress"`))
+	}
+	return nil
+}
+
+// resolveBodyFile resolves the body files of the response relative to dir,
+// the directory of the stub file, and checks that they exist.
+func (r *JSONResponse) resolveBodyFile(dir string) error {
+	if err := r.Content.resolveBodyFile(dir); err != nil {
+		return err
+	}
+	for i := range r.Representations {
+		if err := r.Representations[i].resolveBodyFile(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// set reports whether any body field is set.
+func (c Content) set() bool {
+	return c.Body != nil || c.BodyText != "" || c.BodyBase64 != "" || c.BodyFile != ""
+}
+
+// open returns a reader for the body, or nil if there is none, and its
+// default Content-Type. A body file is closed by closing the reader.
+func (c Content) open() (io.Reader, string, error) {
+	switch {
+	case c.Body != nil:
+		var b bytes.Buffer
+		if err := json.Compact(&b, c.Body); err != nil {
+			return nil, "", fmt.Errorf("encode body: %w", err)
+		}
+		b.WriteByte('\n')
+		return &b, "application/json", nil
+	case c.BodyText != "":
+		return strings.NewReader(c.BodyText), "text/plain; charset=utf-8", nil
+	case c.BodyBase64 != "":
+		return bytes.NewReader(c.binary), "application/octet-stream", nil
+	case c.BodyFile != "":
+		path := c.bodyPath
+		if path == "" {
+			path = c.BodyFile
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("open body file: %w", err)
+		}
+		return f, mime.TypeByExtension(filepath.Ext(path)), nil
+	}
+	return nil, "", nil
+}
+
+func (c *Content) validate() error {
+	var bodies []string
+	for _, b := range []struct {
+		name string
+		set  bool
+	}{
+		{name: "body", set: c.Body != nil},
+		{name: "bodyText", set: c.BodyText != ""},
+		{name: "bodyBase64", set: c.BodyBase64 != ""},
+		{name: "bodyFile", set: c.BodyFile != ""},
+	} {
+		if b.set {
+			bodies = append(bodies, b.name)
+		}
+	}
+	if len(bodies) > 1 {
+		return diag.Field(bodies[1], fmt.Errorf("only one of %v may be set", strings.Join(bodies, ", ")))
+	}
+
+	if c.Body != nil && !json.Valid(c.Body) {
+		return diag.Field("body", errors.New("body is not valid JSON"))
+	}
+	if c.BodyBase64 != "" {
+		b, err := base64.StdEncoding.DecodeString(c.BodyBase64)
+		if err != nil {
+			return diag.Field("bodyBase64", fmt.Errorf("invalid base64 body: %w", err))
+		}
+		c.binary = b
+	}
+	return nil
+}
+
+func (c *Content) resolveBodyFile(dir string) error {
+	if c.BodyFile == "" {
+		return nil
+	}
+	c.bodyPath = c.BodyFile
+	if !filepath.IsAbs(c.bodyPath) {
+		c.bodyPath = filepath.Join(dir, c.bodyPath)
+	}
+	if _, err := os.Stat(c.bodyPath); err != nil {
+		return diag.Field("bodyFile", fmt.Errorf("body file: %w", err))
 	}
 	return nil
 }
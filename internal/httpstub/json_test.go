@@ -1,8 +1,11 @@
 package httpstub
 
 import (
+	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"testing"
@@ -68,6 +71,58 @@ func TestJSONStubValidateAndMatches(t *testing.T) {
 			wantMatch:     false,
 			wantRegexInit: true,
 		},
+		{
+			name: "query matches",
+			stub: JSONStub{
+				ExactPath:  "/users",
+				HTTPMethod: "GET",
+				Query:      map[string]string{"active": "true"},
+				Response: JSONResponse{
+					Status: http.StatusOK,
+				},
+			},
+			inv:       HTTPInvocation{Method: "GET", Path: "/users", Query: url.Values{"active": {"true"}, "page": {"2"}}},
+			wantMatch: true,
+		},
+		{
+			name: "query rejects",
+			stub: JSONStub{
+				ExactPath:  "/users",
+				HTTPMethod: "GET",
+				Query:      map[string]string{"active": "true"},
+				Response: JSONResponse{
+					Status: http.StatusOK,
+				},
+			},
+			inv:       HTTPInvocation{Method: "GET", Path: "/users"},
+			wantMatch: false,
+		},
+		{
+			name: "header matches",
+			stub: JSONStub{
+				ExactPath:  "/users",
+				HTTPMethod: "GET",
+				Headers:    map[string]string{"x-stub-status": "404"},
+				Response: JSONResponse{
+					Status: http.StatusNotFound,
+				},
+			},
+			inv:       HTTPInvocation{Method: "GET", Path: "/users", Headers: http.Header{"X-Stub-Status": {"404"}}},
+			wantMatch: true,
+		},
+		{
+			name: "header rejects",
+			stub: JSONStub{
+				ExactPath:  "/users",
+				HTTPMethod: "GET",
+				Headers:    map[string]string{"X-Stub-Status": "404"},
+				Response: JSONResponse{
+					Status: http.StatusNotFound,
+				},
+			},
+			inv:       HTTPInvocation{Method: "GET", Path: "/users", Headers: http.Header{}},
+			wantMatch: false,
+		},
 	}
 
 	for _, tc := range cases {
@@ -103,6 +158,28 @@ func TestJSONStubValidate_Errors(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "several bodies",
+			stub: JSONStub{
+				ExactPath:  "/hello",
+				HTTPMethod: "GET",
+				Response: JSONResponse{
+					Status:  http.StatusOK,
+					Content: Content{Body: json.RawMessage(`"hello"`), BodyText: "hello"},
+				},
+			},
+		},
+		{
+			name: "invalid base64",
+			stub: JSONStub{
+				ExactPath:  "/hello",
+				HTTPMethod: "GET",
+				Response: JSONResponse{
+					Status:  http.StatusOK,
+					Content: Content{BodyBase64: "not base64!"},
+				},
+			},
+		},
 	}
 
 	for _, tc := range cases {
@@ -117,20 +194,99 @@ func TestJSONResponseWrite(t *testing.T) {
 		Header: http.Header{
 			"Content-Type": []string{"application/json"},
 		},
-		Status: http.StatusCreated,
-		Body: map[string]any{
-			"ok": true,
-		},
+		Status:  http.StatusCreated,
+		Content: Content{Body: json.RawMessage(`{"ok": true}`)},
 	}
 
 	rec := httptest.NewRecorder()
-	require.NoError(t, resp.Write(rec))
+	require.NoError(t, resp.Write(rec, nil))
 
 	require.Equal(t, http.StatusCreated, rec.Code)
 	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
 	require.JSONEq(t, `{"ok": true}`, rec.Body.String())
 }
 
+func TestJSONResponseBodies(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "bodies"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bodies", "page.html"), []byte("<h1>hi</h1>"), 0o644))
+	stubs := `[
+  {"path": "/array", "method": "GET", "response": {"status": 200, "body": [1, "two", null]}},
+  {"path": "/null", "method": "GET", "response": {"status": 200, "body": null}},
+  {"path": "/number", "method": "GET", "response": {"status": 200, "body": 1.50}},
+  {"path": "/text", "method": "GET", "response": {"status": 200, "bodyText": "plain text"}},
+  {"path": "/binary", "method": "GET", "response": {"status": 200, "bodyBase64": "AAEC/w=="}},
+  {"path": "/file", "method": "GET", "response": {"status": 200, "bodyFile": "bodies/page.html"}},
+  {"path": "/typed", "method": "GET", "response": {"status": 200, "header": {"Content-Type": ["text/csv"]}, "bodyText": "a,b"}}
+]`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "stubs.json"), []byte(stubs), 0o644))
+
+	handler, err := NewHandler(dir)
+	require.NoError(t, err)
+
+	cases := []struct {
+		path            string
+		wantBody        string
+		wantContentType string
+	}{
+		{path: "/array", wantBody: "[1,\"two\",null]\n", wantContentType: "application/json"},
+		{path: "/null", wantBody: "null\n", wantContentType: "application/json"},
+		{path: "/number", wantBody: "1.50\n", wantContentType: "application/json"},
+		{path: "/text", wantBody: "plain text", wantContentType: "text/plain; charset=utf-8"},
+		{path: "/binary", wantBody: "\x00\x01\x02\xff", wantContentType: "application/octet-stream"},
+		{path: "/file", wantBody: "<h1>hi</h1>", wantContentType: "text/html; charset=utf-8"},
+		{path: "/typed", wantBody: "a,b", wantContentType: "text/csv"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			require.Equal(t, http.StatusOK, rec.Code)
+			require.Equal(t, tc.wantBody, rec.Body.String())
+			require.Equal(t, tc.wantContentType, rec.Header().Get("Content-Type"))
+		})
+	}
+
+	// The body file is read on every response.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bodies", "page.html"), []byte("<h1>changed</h1>"), 0o644))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/file", nil))
+	require.Equal(t, "<h1>changed</h1>", rec.Body.String())
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "missing.json"), []byte(`{"path": "/missing", "method": "GET", "response": {"status": 200, "bodyFile": "missing.txt"}}`), 0o644))
+	_, err = NewHandler(dir)
+	require.ErrorContains(t, err, "missing.json:1: body file")
+}
+
+func TestJSONResponseWriteHeadersAndTrailers(t *testing.T) {
+	resp := JSONResponse{
+		Header: http.Header{
+			"Set-Cookie": {"a=1", "b=2"},
+		},
+		Trailer: http.Header{
+			"X-Checksum": {"abc"},
+		},
+		Status:  http.StatusOK,
+		Content: Content{BodyText: "hello"},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		require.NoError(t, resp.Write(w, nil))
+	}))
+	t.Cleanup(server.Close)
+
+	res, err := server.Client().Get(server.URL)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+
+	require.Equal(t, "hello", string(body))
+	require.Equal(t, []string{"a=1", "b=2"}, res.Header.Values("Set-Cookie"))
+	require.Equal(t, "abc", res.Trailer.Get("X-Checksum"))
+}
+
 func TestJSONResponseValidate(t *testing.T) {
 	resp := JSONResponse{
 		Status: 42,
@@ -151,12 +307,13 @@ func TestLoadJSONFile(t *testing.T) {
 }`
 	require.NoError(t, os.WriteFile(stubPath, []byte(payload), 0o644))
 
-	stub, err := loadJSONFile(root, stubPath)
+	files, err := loadJSONFile(root, stubPath)
 	require.NoError(t, err)
+	require.Len(t, files, 1)
 
-	jsonStub := stub.(JSONStub)
+	jsonStub := files[0].stub.(JSONStub)
 	require.Equal(t, "/hello", jsonStub.ExactPath)
 	require.Equal(t, "GET", jsonStub.HTTPMethod)
 	require.Equal(t, http.StatusOK, jsonStub.Response.Status)
-	require.Equal(t, "ok", jsonStub.Response.Body["message"])
+	require.JSONEq(t, `{"message": "ok"}`, string(jsonStub.Response.Body))
 }
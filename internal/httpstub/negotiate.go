@@ -0,0 +1,161 @@
+package httpstub
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// encodings lists the supported values of JSONResponse.Compress.
+var encodings = []string{"gzip", "deflate", "br", "zstd"}
+
+// acceptHeader returns the values of an Accept header of the request, or nil
+// without a request.
+func acceptHeader(r *http.Request, name string) []string {
+	if r == nil {
+		return nil
+	}
+	return r.Header.Values(name)
+}
+
+// acceptEntry is an element of an Accept or Accept-Encoding header.
+type acceptEntry struct {
+	value string
+	q     float64
+}
+
+// parseAccept parses the comma-separated elements of the header values and
+// their quality.
+func parseAccept(values []string) []acceptEntry {
+	var entries []acceptEntry
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			value, params, _ := strings.Cut(part, ";")
+			value = strings.ToLower(strings.TrimSpace(value))
+			if value == "" {
+				continue
+			}
+			e := acceptEntry{value: value, q: 1}
+			for _, p := range strings.Split(params, ";") {
+				k, qv, ok := strings.Cut(strings.TrimSpace(p), "=")
+				if ok && strings.EqualFold(k, "q") {
+					if q, err := strconv.ParseFloat(qv, 64); err == nil {
+						e.q = q
+					}
+				}
+			}
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// negotiateType returns the index of the representation best matching the
+// Accept header values: the highest quality of the most specific media range
+// matching its type wins, ties go to the earlier representation. Without an
+// Accept header the first representation is chosen. It returns false if the
+// request accepts none of them.
+func negotiateType(reps []Representation, accept []string) (int, bool) {
+	entries := parseAccept(accept)
+	if len(entries) == 0 {
+		return 0, true
+	}
+
+	best, bestQ := -1, 0.0
+	for i, rep := range reps {
+		mediaType, _, _ := mime.ParseMediaType(rep.ContentType)
+		q, specificity := 0.0, -1
+		for _, e := range entries {
+			s := mediaRangeMatch(e.value, mediaType)
+			if s > specificity {
+				q, specificity = e.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = i, q
+		}
+	}
+	return best, best >= 0
+}
+
+// mediaRangeMatch returns how specific the media range matching mediaType is:
+// 2 for the type itself, 1 for type/*, 0 for */* and -1 if it doesn't match.
+func mediaRangeMatch(mediaRange string, mediaType string) int {
+	switch {
+	case mediaRange == mediaType:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")):
+		return 1
+	}
+	return -1
+}
+
+// negotiateEncoding returns the first of the offered encodings accepted by
+// the Accept-Encoding header values, or "" to send the body unencoded. It
+// returns false if the request accepts none of them and refuses the
+// unencoded body with "identity;q=0", or "*;q=0" without listing identity.
+func negotiateEncoding(offered []string, acceptEncoding []string) (string, bool) {
+	entries := parseAccept(acceptEncoding)
+	for _, encoding := range offered {
+		if q, found := encodingQuality(entries, encoding); found && q > 0 {
+			return encoding, true
+		}
+	}
+	q, found := encodingQuality(entries, "identity")
+	return "", !found || q > 0
+}
+
+// encodingQuality returns the quality of encoding in the Accept-Encoding
+// entries, falling back to the quality of "*", and whether either is listed.
+func encodingQuality(entries []acceptEntry, encoding string) (float64, bool) {
+	q, found := 0.0, false
+	for _, e := range entries {
+		if e.value == encoding {
+			return e.q, true
+		}
+		if e.value == "*" {
+			q, found = e.q, true
+		}
+	}
+	return q, found
+}
+
+// writeEncoded copies body to w, compressed with encoding unless it is "".
+func writeEncoded(w io.Writer, encoding string, body io.Reader) error {
+	var enc io.WriteCloser
+	switch encoding {
+	case "":
+		_, err := io.Copy(w, body)
+		return err
+	case "gzip":
+		enc = gzip.NewWriter(w)
+	case "deflate":
+		enc = zlib.NewWriter(w)
+	case "br":
+		enc = brotli.NewWriter(w)
+	case "zstd":
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return fmt.Errorf("create zstd encoder: %w", err)
+		}
+		enc = zw
+	default:
+		return fmt.Errorf("unsupported encoding %q", encoding)
+	}
+
+	if _, err := io.Copy(enc, body); err != nil {
+		_ = enc.Close()
+		return err
+	}
+	return enc.Close()
+}
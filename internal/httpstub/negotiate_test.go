@@ -0,0 +1,208 @@
+package httpstub
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONResponseCompress(t *testing.T) {
+	resp := JSONResponse{
+		Status:   http.StatusOK,
+		Content:  Content{BodyText: "hello hello hello"},
+		Compress: []string{"zstd", "br", "gzip", "deflate"},
+	}
+	require.NoError(t, resp.Validate())
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip":    func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"deflate": func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+		"br":      func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		"zstd": func(r io.Reader) (io.Reader, error) {
+			d, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+	}
+
+	cases := []struct {
+		name           string
+		acceptEncoding string
+		wantEncoding   string
+	}{
+		{name: "no accept-encoding", wantEncoding: ""},
+		{name: "gzip", acceptEncoding: "gzip", wantEncoding: "gzip"},
+		{name: "deflate", acceptEncoding: "deflate, identity", wantEncoding: "deflate"},
+		{name: "server order", acceptEncoding: "gzip, br", wantEncoding: "br"},
+		{name: "zstd", acceptEncoding: "zstd;q=0.5", wantEncoding: "zstd"},
+		{name: "refused", acceptEncoding: "zstd;q=0, br;q=0, gzip", wantEncoding: "gzip"},
+		{name: "wildcard", acceptEncoding: "*", wantEncoding: "zstd"},
+		{name: "unsupported", acceptEncoding: "compress", wantEncoding: ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			require.NoError(t, resp.Write(rec, req))
+
+			require.Equal(t, http.StatusOK, rec.Code)
+			require.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+			require.Equal(t, tc.wantEncoding, rec.Header().Get("Content-Encoding"))
+
+			var body io.Reader = rec.Body
+			if tc.wantEncoding != "" {
+				var err error
+				body, err = decoders[tc.wantEncoding](rec.Body)
+				require.NoError(t, err)
+			}
+			b, err := io.ReadAll(body)
+			require.NoError(t, err)
+			require.Equal(t, "hello hello hello", string(b))
+		})
+	}
+
+	refused := []struct {
+		acceptEncoding string
+		wantStatus     int
+	}{
+		{acceptEncoding: "compress, identity;q=0", wantStatus: http.StatusNotAcceptable},
+		{acceptEncoding: "*;q=0", wantStatus: http.StatusNotAcceptable},
+		{acceptEncoding: "*;q=0, identity", wantStatus: http.StatusOK},
+		{acceptEncoding: "gzip;q=0, identity;q=0.5", wantStatus: http.StatusOK},
+	}
+	for _, tc := range refused {
+		t.Run(tc.acceptEncoding, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			rec := httptest.NewRecorder()
+			require.NoError(t, resp.Write(rec, req))
+			require.Equal(t, tc.wantStatus, rec.Code)
+			require.Empty(t, rec.Header().Get("Content-Encoding"))
+		})
+	}
+
+	forced := JSONResponse{
+		Status:        http.StatusOK,
+		Content:       Content{Body: json.RawMessage(`{"ok": true}`)},
+		Compress:      []string{"gzip"},
+		ForceCompress: true,
+	}
+	require.NoError(t, forced.Validate())
+	rec := httptest.NewRecorder()
+	require.NoError(t, forced.Write(rec, httptest.NewRequest(http.MethodGet, "/", nil)))
+	require.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	zr, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err)
+	b, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"ok": true}`, string(b))
+}
+
+func TestJSONResponseRepresentations(t *testing.T) {
+	resp := JSONResponse{
+		Status: http.StatusOK,
+		Representations: []Representation{
+			{ContentType: "application/json", Content: Content{Body: json.RawMessage(`{"name": "Ada"}`)}},
+			{ContentType: "application/xml", Content: Content{BodyText: "<user><name>Ada</name></user>"}},
+			{ContentType: "application/x-protobuf", Content: Content{BodyBase64: "CgNBZGE="}},
+		},
+	}
+	require.NoError(t, resp.Validate())
+
+	cases := []struct {
+		name            string
+		accept          string
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{name: "no accept", wantStatus: http.StatusOK, wantContentType: "application/json", wantBody: "{\"name\":\"Ada\"}\n"},
+		{name: "xml", accept: "application/xml", wantStatus: http.StatusOK, wantContentType: "application/xml", wantBody: "<user><name>Ada</name></user>"},
+		{name: "protobuf", accept: "application/x-protobuf", wantStatus: http.StatusOK, wantContentType: "application/x-protobuf", wantBody: "\n\x03Ada"},
+		{name: "quality", accept: "application/json;q=0.5, application/xml", wantStatus: http.StatusOK, wantContentType: "application/xml", wantBody: "<user><name>Ada</name></user>"},
+		{name: "specific range wins", accept: "application/*;q=0.9, application/json;q=0", wantStatus: http.StatusOK, wantContentType: "application/xml", wantBody: "<user><name>Ada</name></user>"},
+		{name: "wildcard", accept: "text/html, */*;q=0.1", wantStatus: http.StatusOK, wantContentType: "application/json", wantBody: "{\"name\":\"Ada\"}\n"},
+		{name: "not acceptable", accept: "text/html", wantStatus: http.StatusNotAcceptable, wantContentType: "text/plain; charset=utf-8", wantBody: "Not Acceptable\n"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			rec := httptest.NewRecorder()
+			require.NoError(t, resp.Write(rec, req))
+
+			require.Equal(t, tc.wantStatus, rec.Code)
+			require.Equal(t, "Accept", rec.Header().Get("Vary"))
+			require.Equal(t, tc.wantContentType, rec.Header().Get("Content-Type"))
+			require.Equal(t, tc.wantBody, rec.Body.String())
+		})
+	}
+}
+
+func TestJSONResponseNegotiationValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		resp    JSONResponse
+		wantErr string
+	}{
+		{
+			name:    "unsupported encoding",
+			resp:    JSONResponse{Status: http.StatusOK, Compress: []string{"compress"}},
+			wantErr: `unsupported encoding "compress"`,
+		},
+		{
+			name:    "force without encoding",
+			resp:    JSONResponse{Status: http.StatusOK, ForceCompress: true},
+			wantErr: `"forceCompress" requires an encoding`,
+		},
+		{
+			name: "body and representations",
+			resp: JSONResponse{
+				Status:          http.StatusOK,
+				Content:         Content{BodyText: "hello"},
+				Representations: []Representation{{ContentType: "text/plain", Content: Content{BodyText: "hello"}}},
+			},
+			wantErr: `"representations" replace the body fields`,
+		},
+		{
+			name: "invalid content type",
+			resp: JSONResponse{
+				Status:          http.StatusOK,
+				Representations: []Representation{{ContentType: "", Content: Content{BodyText: "hello"}}},
+			},
+			wantErr: "representation 0: invalid content type",
+		},
+		{
+			name: "invalid representation body",
+			resp: JSONResponse{
+				Status:          http.StatusOK,
+				Representations: []Representation{{ContentType: "application/octet-stream", Content: Content{BodyBase64: "not base64!"}}},
+			},
+			wantErr: "representation 0: invalid base64 body",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.ErrorContains(t, tc.resp.Validate(), tc.wantErr)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package httpstub
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ProxyRoute forwards requests without a matching stub below a path prefix to
+// an upstream server.
+type ProxyRoute struct {
+	// Prefix is the path prefix of the proxied requests. The longest
+	// matching prefix wins; an empty prefix matches all requests.
+	Prefix string `json:"prefix"`
+	// Upstream is the base URL of the upstream server.
+	Upstream string `json:"upstream"`
+	// StripPrefix removes Prefix from the request path before it is appended
+	// to the upstream URL.
+	StripPrefix bool `json:"stripPrefix,omitempty"`
+	// SetHeaders adds or replaces request headers sent to the upstream.
+	SetHeaders map[string]string `json:"setHeaders,omitempty"`
+	// RemoveHeaders lists request headers not sent to the upstream.
+	RemoveHeaders []string `json:"removeHeaders,omitempty"`
+}
+
+type proxyRoute struct {
+	ProxyRoute
+	proxy *httputil.ReverseProxy
+}
+
+// proxy forwards requests without a matching stub to the upstream of the
+// longest matching route prefix, without recording them.
+type proxy struct {
+	routes []proxyRoute
+}
+
+func newProxy(routes []ProxyRoute) (*proxy, error) {
+	p := &proxy{}
+	var errs []error
+	for _, route := range routes {
+		target, err := url.Parse(route.Upstream)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("proxy route %q: parse upstream URL: %w", route.Prefix, err))
+			continue
+		}
+		if target.Scheme == "" || target.Host == "" {
+			errs = append(errs, fmt.Errorf("proxy route %q: upstream URL %q must be absolute", route.Prefix, route.Upstream))
+			continue
+		}
+		p.routes = append(p.routes, proxyRoute{ProxyRoute: route, proxy: route.reverseProxy(target)})
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(p.routes, func(i, j int) bool {
+		return len(p.routes[i].Prefix) > len(p.routes[j].Prefix)
+	})
+	return p, nil
+}
+
+func (route ProxyRoute) reverseProxy(target *url.URL) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			if route.StripPrefix {
+				pr.Out.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(pr.In.URL.Path, route.Prefix), "/")
+				pr.Out.URL.RawPath = ""
+			}
+			pr.SetURL(target)
+			for _, k := range route.RemoveHeaders {
+				pr.Out.Header.Del(k)
+			}
+			for k, v := range route.SetHeaders {
+				pr.Out.Header.Set(k, v)
+			}
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			slog.ErrorContext(r.Context(), "Upstream request failed", slog.String("upstream", target.String()), slog.String("error", err.Error()))
+			http.Error(w, "Upstream request failed", http.StatusBadGateway)
+		},
+	}
+}
+
+// route returns the reverse proxy for the request path, if any.
+func (p *proxy) route(path string) (*httputil.ReverseProxy, bool) {
+	if p == nil {
+		return nil, false
+	}
+	for _, route := range p.routes {
+		if strings.HasPrefix(path, route.Prefix) {
+			return route.proxy, true
+		}
+	}
+	return nil, false
+}
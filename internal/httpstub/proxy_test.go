@@ -0,0 +1,82 @@
+package httpstub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyRoutes(t *testing.T) {
+	t.Parallel()
+
+	newUpstream := func(name string) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(name + " " + r.URL.Path + " auth=" + r.Header.Get("Authorization") + " cookie=" + r.Header.Get("Cookie")))
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	users := newUpstream("users")
+	fallback := newUpstream("fallback")
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "stub.json"), []byte(`{
+		"path": "/api/users/1",
+		"method": "GET",
+		"response": {"status": 200, "body": {"stubbed": true}}
+	}`), 0o600))
+
+	handler, err := NewHandlerWithOptions(dir, Options{Proxy: []ProxyRoute{
+		{Upstream: fallback.URL},
+		{
+			Prefix:        "/api/users",
+			Upstream:      users.URL + "/v2",
+			StripPrefix:   true,
+			SetHeaders:    map[string]string{"Authorization": "Bearer upstream"},
+			RemoveHeaders: []string{"Cookie"},
+		},
+	}})
+	require.NoError(t, err)
+
+	cases := []struct {
+		path     string
+		wantBody string
+	}{
+		{path: "/api/users/1", wantBody: "{\"stubbed\":true}\n"},
+		{path: "/api/users/2", wantBody: "users /v2/2 auth=Bearer upstream cookie="},
+		{path: "/api/orders", wantBody: "fallback /api/orders auth=Bearer client cookie=session=1"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Header.Set("Authorization", "Bearer client")
+		req.Header.Set("Cookie", "session=1")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code, tc.path)
+		require.Equal(t, tc.wantBody, rec.Body.String(), tc.path)
+	}
+}
+
+func TestProxyWithoutMatchingRoute(t *testing.T) {
+	t.Parallel()
+
+	handler, err := NewHandlerWithOptions(t.TempDir(), Options{Proxy: []ProxyRoute{
+		{Prefix: "/api/", Upstream: "http://127.0.0.1:1"},
+	}})
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusNotFound, serveGet(t, handler, "/other").status)
+	require.Equal(t, http.StatusBadGateway, serveGet(t, handler, "/api/users").status)
+}
+
+func TestProxyInvalidUpstream(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewHandlerWithOptions(t.TempDir(), Options{Proxy: []ProxyRoute{{Prefix: "/api/", Upstream: "localhost:8080"}}})
+	require.ErrorContains(t, err, `upstream URL "localhost:8080" must be absolute`)
+}
@@ -0,0 +1,203 @@
+package httpstub
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/stubfile"
+)
+
+// hopHeaders are connection specific headers that are neither forwarded nor
+// recorded.
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// recorder forwards requests without a matching stub to an upstream server and
+// saves the responses as stubs.
+type recorder struct {
+	upstream *url.URL
+	dir      string
+	client   *http.Client
+	storage  *Storage
+}
+
+func newRecorder(upstream string, dir string, storage *Storage) (*recorder, error) {
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return nil, fmt.Errorf("parse upstream URL: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("upstream URL %q must be absolute", upstream)
+	}
+
+	return &recorder{
+		upstream: u,
+		dir:      dir,
+		client:   &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }},
+		storage:  storage,
+	}, nil
+}
+
+// serve forwards the request, writes the upstream response to w and records it.
+func (rec *recorder) serve(w http.ResponseWriter, r *http.Request, body []byte) {
+	target := *rec.upstream
+	target.Path = strings.TrimSuffix(target.Path, "/") + r.URL.Path
+	target.RawQuery = r.URL.RawQuery
+
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, "Failed to create upstream request", http.StatusInternalServerError)
+		return
+	}
+	req.Header = r.Header.Clone()
+	removeHopHeaders(req.Header)
+
+	resp, err := rec.client.Do(req)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Upstream request failed", slog.String("url", target.String()), slog.String("error", err.Error()))
+		http.Error(w, "Upstream request failed", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		http.Error(w, "Failed to read upstream response", http.StatusBadGateway)
+		return
+	}
+
+	header := resp.Header.Clone()
+	removeHopHeaders(header)
+	for k, v := range header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = w.Write(respBody)
+
+	header.Del("Content-Length")
+	header.Del("Date")
+	stub, path, err := rec.save(r, resp.StatusCode, header, respBody)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to record stub", slog.String("path", r.URL.Path), slog.String("error", err.Error()))
+		return
+	}
+	rec.storage.Add(stub)
+	slog.InfoContext(r.Context(), "Recorded stub", slog.String("file", path))
+}
+
+// save writes a JSONStub if the response has a JSON body and a raw .http stub
+// otherwise.
+func (rec *recorder) save(r *http.Request, status int, header http.Header, body []byte) (Stub, string, error) {
+	if isJSON(header.Get("Content-Type")) && json.Valid(body) {
+		return rec.saveJSON(r, status, header, body)
+	}
+	return rec.saveRaw(r, status, header, body)
+}
+
+func (rec *recorder) saveJSON(r *http.Request, status int, header http.Header, body json.RawMessage) (Stub, string, error) {
+	stub := JSONStub{
+		ExactPath:  r.URL.Path,
+		HTTPMethod: r.Method,
+		Response:   JSONResponse{Header: header, Content: Content{Body: body}, Status: status},
+	}
+	if q := r.URL.Query(); len(q) > 0 {
+		stub.Query = make(map[string]string, len(q))
+		for k := range q {
+			stub.Query[k] = q.Get(k)
+		}
+	}
+	if len(header) == 0 {
+		stub.Response.Header = nil
+	}
+	if err := stub.Validate(); err != nil {
+		return nil, "", fmt.Errorf("validate recorded stub: %w", err)
+	}
+
+	b, err := json.MarshalIndent(stub, "", "  ")
+	if err != nil {
+		return nil, "", fmt.Errorf("marshal stub: %w", err)
+	}
+
+	name := strings.ReplaceAll(strings.Trim(r.URL.Path, "/"), "/", "_")
+	if name == "" {
+		name = "root"
+	}
+	name += "." + r.Method
+	if r.URL.RawQuery != "" {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(r.URL.Query().Encode()))
+		name += fmt.Sprintf(".%08x", h.Sum32())
+	}
+
+	path, err := stubfile.CreateUnique(rec.dir, name, ".json", append(b, '\n'))
+	if err != nil {
+		return nil, "", err
+	}
+	return stub, path, nil
+}
+
+// saveRaw writes the response to <path>/<METHOD>/recorded.http, the layout
+// read by loadHTTPFile. Requests with a query get a request section matching
+// the query parameters, so each query is recorded separately.
+func (rec *recorder) saveRaw(r *http.Request, status int, header http.Header, body []byte) (Stub, string, error) {
+	if strings.Trim(r.URL.Path, "/") == "" {
+		return nil, "", errors.New("the root path can't be recorded as raw HTTP stub")
+	}
+	if strings.Contains(r.URL.Path, "..") {
+		return nil, "", fmt.Errorf("path %q can't be recorded as raw HTTP stub", r.URL.Path)
+	}
+
+	dir := filepath.Join(rec.dir, filepath.FromSlash(strings.Trim(r.URL.Path, "/")), r.Method)
+
+	var buf bytes.Buffer
+	if r.URL.RawQuery != "" {
+		fmt.Fprintf(&buf, "%v %v HTTP/1.1\r\n\r\n", r.Method, r.URL.RequestURI())
+	}
+	resp := &http.Response{
+		StatusCode:    status,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+	if err := resp.Write(&buf); err != nil {
+		return nil, "", fmt.Errorf("write response: %w", err)
+	}
+
+	path, err := stubfile.CreateUnique(dir, "recorded", ".http", buf.Bytes())
+	if err != nil {
+		return nil, "", err
+	}
+	stub, err := loadHTTPFile(rec.dir, path)
+	if err != nil {
+		return nil, "", err
+	}
+	return stub, path, nil
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func removeHopHeaders(h http.Header) {
+	for _, k := range hopHeaders {
+		h.Del(k)
+	}
+}
@@ -0,0 +1,103 @@
+package httpstub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordUpstream(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		switch r.URL.Path {
+		case "/users/1":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id": 1, "active": "` + r.URL.Query().Get("active") + `"}`))
+		case "/users":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`[{"id": 1}]`))
+		default:
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	dir := t.TempDir()
+	handler, err := NewHandlerWithOptions(dir, Options{RecordUpstream: upstream.URL})
+	require.NoError(t, err)
+
+	cases := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+		wantFile   string
+	}{
+		{path: "/users/1?active=true", wantStatus: http.StatusOK, wantBody: `{"id": 1, "active": "true"}`, wantFile: "users_1.GET.*.json"},
+		{path: "/users", wantStatus: http.StatusOK, wantBody: `[{"id": 1}]`, wantFile: "users.GET.json"},
+		{path: "/health?verbose=1", wantStatus: http.StatusAccepted, wantBody: "ok", wantFile: "health/GET/recorded.http"},
+		{path: "/health", wantStatus: http.StatusAccepted, wantBody: "ok", wantFile: "health/GET/recorded-2.http"},
+	}
+
+	for _, tc := range cases {
+		resp := serveGet(t, handler, tc.path)
+		require.Equal(t, tc.wantStatus, resp.status)
+		require.Equal(t, tc.wantBody, resp.body)
+
+		files, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(tc.wantFile)))
+		require.NoError(t, err)
+		require.Len(t, files, 1, tc.wantFile)
+	}
+	require.EqualValues(t, 4, calls.Load())
+
+	// Recorded stubs are served without calling the upstream again.
+	resp := serveGet(t, handler, "/users/1?active=true")
+	require.Equal(t, http.StatusOK, resp.status)
+	require.JSONEq(t, `{"id": 1, "active": "true"}`, resp.body)
+	require.EqualValues(t, 4, calls.Load())
+
+	// A different query is recorded separately.
+	resp = serveGet(t, handler, "/users/1?active=false")
+	require.JSONEq(t, `{"id": 1, "active": "false"}`, resp.body)
+	require.EqualValues(t, 5, calls.Load())
+
+	// The recorded stubs load without the upstream.
+	replay, err := NewHandler(dir)
+	require.NoError(t, err)
+	for _, tc := range cases {
+		resp := serveGet(t, replay, tc.path)
+		require.Equal(t, tc.wantStatus, resp.status, tc.path)
+	}
+	require.NoError(t, Validate(dir))
+}
+
+func TestRecordUpstreamInvalidURL(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewHandlerWithOptions(t.TempDir(), Options{RecordUpstream: "localhost:8080"})
+	require.Error(t, err)
+}
+
+func TestRecordUpstreamUnavailable(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	handler, err := NewHandlerWithOptions(dir, Options{RecordUpstream: "http://127.0.0.1:1"})
+	require.NoError(t, err)
+
+	resp := serveGet(t, handler, "/users")
+	require.Equal(t, http.StatusBadGateway, resp.status)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
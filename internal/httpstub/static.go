@@ -0,0 +1,200 @@
+package httpstub
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/diag"
+)
+
+// StaticStub serves the files of a directory below a URL prefix to GET and
+// HEAD requests, like a CDN or blob store. Responses carry a Content-Type by
+// file extension, an ETag and Last-Modified, and honour Range,
+// If-None-Match and If-Modified-Since requests. A directory is served by its
+// index.html, or listed if Listing is set. The stub only matches requests for
+// existing files, so other requests below the prefix fall through to later
+// stubs. Every response is delayed by Latency.
+type StaticStub struct {
+	Prefix  string `json:"prefix"`
+	Dir     string `json:"dir"`
+	Listing bool   `json:"listing,omitempty"`
+	Latency string `json:"latency,omitempty"`
+	latency time.Duration
+	dirPath string
+}
+
+var _ Stub = &StaticStub{}
+
+// Matches checks if the request asks for a file or served directory below
+// the prefix.
+func (s *StaticStub) Matches(inv HTTPInvocation) bool {
+	if inv.Method != http.MethodGet && inv.Method != http.MethodHead {
+		return false
+	}
+	name, ok := s.file(inv.Path)
+	if !ok {
+		return false
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return false
+	}
+	if !info.IsDir() || s.Listing {
+		return true
+	}
+	_, err = os.Stat(filepath.Join(name, "index.html"))
+	return err == nil
+}
+
+// Type returns the MatchType
+func (s *StaticStub) Type() MatchType {
+	return MatchPrefix
+}
+
+// specificity ranks the stub below stubs of single routes, so overriding a
+// file with another stub is not reported as ambiguous.
+func (s *StaticStub) specificity() int {
+	return -1
+}
+
+// Invoke serves the requested file or directory after the latency.
+func (s *StaticStub) Invoke(w http.ResponseWriter, r *http.Request) {
+	if s.latency > 0 {
+		select {
+		case <-time.After(s.latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	name, ok := s.file(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if info.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			// Relative links of the index or listing resolve below the directory.
+			target := url.URL{Path: r.URL.Path + "/", RawQuery: r.URL.RawQuery}
+			http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+			return
+		}
+		index := filepath.Join(name, "index.html")
+		if _, err := os.Stat(index); err != nil {
+			listDir(w, r, name)
+			return
+		}
+		name = index
+	}
+	serveFile(w, r, name)
+}
+
+// Validate validates the StaticStub fields.
+func (s *StaticStub) Validate() error {
+	if !strings.HasPrefix(s.Prefix, "/") {
+		return diag.Field("prefix", fmt.Errorf("prefix %q must start with /", s.Prefix))
+	}
+	if s.Dir == "" {
+		return diag.Field("dir", errors.New(`"dir" field is required`))
+	}
+	if s.Latency != "" {
+		d, err := time.ParseDuration(s.Latency)
+		if err != nil {
+			return diag.Field("latency", fmt.Errorf("invalid latency: %w", err))
+		}
+		s.latency = d
+	}
+	return nil
+}
+
+// resolveDir resolves the directory relative to dir, the directory of the
+// stub file, and checks that it exists.
+func (s *StaticStub) resolveDir(dir string) error {
+	s.dirPath = s.Dir
+	if !filepath.IsAbs(s.dirPath) {
+		s.dirPath = filepath.Join(dir, s.dirPath)
+	}
+	info, err := os.Stat(s.dirPath)
+	if err != nil {
+		return diag.Field("dir", fmt.Errorf("static directory: %w", err))
+	}
+	if !info.IsDir() {
+		return diag.Field("dir", fmt.Errorf("static directory: %v is not a directory", s.dirPath))
+	}
+	return nil
+}
+
+// file returns the file name of the request path, or false if the path is
+// not below the prefix. Paths cannot escape the directory.
+func (s *StaticStub) file(urlPath string) (string, bool) {
+	prefix := strings.TrimSuffix(s.Prefix, "/")
+	rel, ok := strings.CutPrefix(urlPath, prefix)
+	if !ok || (rel != "" && !strings.HasPrefix(rel, "/")) {
+		return "", false
+	}
+	dir := s.dirPath
+	if dir == "" {
+		dir = s.Dir
+	}
+	return filepath.Join(dir, filepath.FromSlash(path.Clean("/"+rel))), true
+}
+
+// serveFile writes the file, handling Range and conditional requests. The
+// ETag is derived from the size and modification time of the file.
+func serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	f, err := os.Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close() //nolint:errcheck
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// listDir writes an HTML listing of the entries of the directory name.
+func listDir(w http.ResponseWriter, r *http.Request, name string) {
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		http.Error(w, "Failed to read directory", http.StatusInternalServerError)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("<!doctype html>\n<pre>\n")
+	for _, e := range entries {
+		entry := e.Name()
+		if e.IsDir() {
+			entry += "/"
+		}
+		href := url.URL{Path: entry}
+		fmt.Fprintf(&b, "<a href=\"%s\">%s</a>\n", html.EscapeString(href.String()), html.EscapeString(entry))
+	}
+	b.WriteString("</pre>\n")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write([]byte(b.String()))
+}
@@ -0,0 +1,154 @@
+package httpstub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticStub(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"assets/app.js":            "console.log('hi')",
+		"assets/data.json":         `{"ok": true}`,
+		"assets/img/logo.txt":      "0123456789",
+		"assets/site/index.html":   "<h1>index</h1>",
+		"assets/overridden.txt":    "from disk",
+		"stubs/static.yaml":        "static:\n  prefix: /cdn\n  dir: ../assets\n  listing: true\n",
+		"stubs/overridden.json":    `{"path": "/cdn/overridden.txt", "method": "GET", "response": {"status": 200, "bodyText": "from stub"}}`,
+		"stubs/fallback.json":      `{"regex": "^/cdn/missing", "method": "GET", "response": {"status": 410}}`,
+		"private/secret.txt":       "secret",
+		"stubs/unlisted/stub.json": `{"static": {"prefix": "/blobs/", "dir": "../../assets", "latency": "30ms"}}`,
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+	}
+
+	handler, err := NewHandler(filepath.Join(dir, "stubs"))
+	require.NoError(t, err)
+
+	serve := func(method, target string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	cases := []struct {
+		name            string
+		method          string
+		target          string
+		header          http.Header
+		wantStatus      int
+		wantBody        string
+		wantContentType string
+		wantHeader      http.Header
+	}{
+		{name: "javascript", target: "/cdn/app.js", wantStatus: http.StatusOK, wantBody: "console.log('hi')", wantContentType: "text/javascript; charset=utf-8"},
+		{name: "json", target: "/cdn/data.json", wantStatus: http.StatusOK, wantBody: `{"ok": true}`, wantContentType: "application/json"},
+		{name: "range", target: "/cdn/img/logo.txt", header: http.Header{"Range": {"bytes=2-5"}}, wantStatus: http.StatusPartialContent, wantBody: "2345", wantHeader: http.Header{"Content-Range": {"bytes 2-5/10"}}},
+		{name: "unsatisfiable range", target: "/cdn/img/logo.txt", header: http.Header{"Range": {"bytes=20-"}}, wantStatus: http.StatusRequestedRangeNotSatisfiable},
+		{name: "head", method: http.MethodHead, target: "/cdn/img/logo.txt", wantStatus: http.StatusOK, wantHeader: http.Header{"Content-Length": {"10"}}},
+		{name: "index", target: "/cdn/site/", wantStatus: http.StatusOK, wantBody: "<h1>index</h1>", wantContentType: "text/html; charset=utf-8"},
+		{name: "directory redirect", target: "/cdn/site?v=1", wantStatus: http.StatusMovedPermanently, wantHeader: http.Header{"Location": {"/cdn/site/?v=1"}}},
+		{name: "listing", target: "/cdn/img/", wantStatus: http.StatusOK, wantBody: "<!doctype html>\n<pre>\n<a href=\"logo.txt\">logo.txt</a>\n</pre>\n", wantContentType: "text/html; charset=utf-8"},
+		{name: "exact stub takes precedence", target: "/cdn/overridden.txt", wantStatus: http.StatusOK, wantBody: "from stub"},
+		{name: "regex stub takes precedence", target: "/cdn/missing.txt", wantStatus: http.StatusGone},
+		{name: "missing file", target: "/cdn/nothing.txt", wantStatus: http.StatusNotFound},
+		{name: "outside prefix", target: "/cdnx/app.js", wantStatus: http.StatusNotFound},
+		{name: "traversal", target: "/cdn/../private/secret.txt", wantStatus: http.StatusNotFound},
+		{name: "method", method: http.MethodPost, target: "/cdn/app.js", wantStatus: http.StatusNotFound},
+		{name: "no listing", target: "/blobs/img/", wantStatus: http.StatusNotFound},
+		{name: "second mount", target: "/blobs/app.js", wantStatus: http.StatusOK, wantBody: "console.log('hi')"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			rec := serve(method, tc.target, tc.header)
+			require.Equal(t, tc.wantStatus, rec.Code)
+			if tc.wantBody != "" {
+				require.Equal(t, tc.wantBody, rec.Body.String())
+			}
+			if tc.wantContentType != "" {
+				require.Equal(t, tc.wantContentType, rec.Header().Get("Content-Type"))
+			}
+			for k, v := range tc.wantHeader {
+				require.Equal(t, v, rec.Header().Values(k))
+			}
+		})
+	}
+
+	t.Run("conditional requests", func(t *testing.T) {
+		rec := serve(http.MethodGet, "/cdn/app.js", nil)
+		etag := rec.Header().Get("ETag")
+		lastModified := rec.Header().Get("Last-Modified")
+		require.NotEmpty(t, etag)
+		require.NotEmpty(t, lastModified)
+
+		rec = serve(http.MethodGet, "/cdn/app.js", http.Header{"If-None-Match": {etag}})
+		require.Equal(t, http.StatusNotModified, rec.Code)
+		require.Empty(t, rec.Body.String())
+
+		rec = serve(http.MethodGet, "/cdn/app.js", http.Header{"If-Modified-Since": {lastModified}})
+		require.Equal(t, http.StatusNotModified, rec.Code)
+
+		rec = serve(http.MethodGet, "/cdn/app.js", http.Header{"If-None-Match": {`"other"`}})
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		rec = serve(http.MethodGet, "/cdn/app.js", http.Header{"Range": {"bytes=0-6"}, "If-Range": {etag}})
+		require.Equal(t, http.StatusPartialContent, rec.Code)
+		require.Equal(t, "console", rec.Body.String())
+
+		// Changing the file changes its ETag.
+		later := time.Now().Add(time.Hour)
+		require.NoError(t, os.Chtimes(filepath.Join(dir, "assets", "app.js"), later, later))
+		rec = serve(http.MethodGet, "/cdn/app.js", http.Header{"If-None-Match": {etag}})
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.NotEqual(t, etag, rec.Header().Get("ETag"))
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		start := time.Now()
+		rec := serve(http.MethodGet, "/blobs/app.js", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond)
+	})
+}
+
+func TestStaticStubErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		stub    string
+		wantErr string
+	}{
+		{name: "relative prefix", stub: `{"static": {"prefix": "cdn", "dir": "."}}`, wantErr: "stub.json:1: stub validation: prefix \"cdn\" must start with /"},
+		{name: "missing dir", stub: `{"static": {"prefix": "/cdn"}}`, wantErr: `stub.json: stub validation: "dir" field is required`},
+		{name: "invalid latency", stub: `{"static": {"prefix": "/cdn", "dir": ".", "latency": "soon"}}`, wantErr: "stub.json:1: stub validation: invalid latency"},
+		{name: "nonexistent dir", stub: `{"static": {"prefix": "/cdn", "dir": "missing"}}`, wantErr: "stub.json:1: static directory"},
+		{name: "dir is a file", stub: `{"static": {"prefix": "/cdn", "dir": "stub.json"}}`, wantErr: "is not a directory"},
+		{name: "unknown type", stub: `{"static": {"prefix": "/cdn", "dir": ".", "listing": "yes"}}`, wantErr: "stub.json:1: unmarshal stub"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "stub.json"), []byte(tc.stub), 0o644))
+			_, err := NewHandler(dir)
+			require.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
@@ -20,12 +20,15 @@ const (
 	// request value must match that pattern. Patterns are interpreted using Go's regexp package;
 	// anchor the pattern (e.g., ^...$) if you require a full-string match. Use MatchExact for literal equality.
 	MatchRegex
+	// MatchPrefix indicates that the stub serves all requests below a path prefix, such as a
+	// directory of static files. Prefix stubs are consulted after exact and regex stubs.
+	MatchPrefix
 )
 
 // Stub represents a predefined HTTP stub.
 type Stub interface {
 	Matches(HTTPInvocation) bool
-	Invoke(http.ResponseWriter)
+	Invoke(http.ResponseWriter, *http.Request)
 	Type() MatchType
 }
 
@@ -51,7 +54,7 @@ func (p *Storage) Add(s Stub) {
 
 	p.stubs = append(p.stubs, s)
 
-	// Sort by Type (Exact < Prefix < Regex < Prefix)
+	// Sort by Type (Exact < Regex < Prefix)
 	sort.SliceStable(p.stubs, func(i, j int) bool {
 		return p.stubs[i].Type() < p.stubs[j].Type()
 	})
@@ -73,7 +76,7 @@ func (p *Storage) Find(inv HTTPInvocation) (Stub, bool) {
 		}
 	}
 
-	if len(matches) > 1 {
+	if len(matches) > 1 && specificity(matches[1]) >= specificity(matches[0]) {
 		slog.Warn("Multiple stub rules matched",
 			slog.String("path", inv.Path),
 			slog.String("method", inv.Method),
@@ -89,6 +92,16 @@ func (p *Storage) Find(inv HTTPInvocation) (Stub, bool) {
 	return match, true
 }
 
+// specificity returns the number of request criteria of stubs that are
+// ordered by them, so a match is only ambiguous if the next match is as
+// specific.
+func specificity(s Stub) int {
+	if s, ok := s.(interface{ specificity() int }); ok {
+		return s.specificity()
+	}
+	return 0
+}
+
 func extractStubInfo(stubs []Stub) []map[string]any {
 	out := make([]map[string]any, 0, len(stubs))
 	for _, s := range stubs {
@@ -13,9 +13,9 @@ type fakeStub struct {
 	called *int
 }
 
-func (s fakeStub) Matches(HTTPInvocation) bool { return s.match }
-func (s fakeStub) Type() MatchType             { return s.t }
-func (s fakeStub) Invoke(http.ResponseWriter)  { (*s.called)++ }
+func (s fakeStub) Matches(HTTPInvocation) bool               { return s.match }
+func (s fakeStub) Type() MatchType                           { return s.t }
+func (s fakeStub) Invoke(http.ResponseWriter, *http.Request) { (*s.called)++ }
 
 func TestStorageFind_PrioritizesExact(t *testing.T) {
 	calls := 0
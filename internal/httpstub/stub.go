@@ -1,70 +1,166 @@
 package httpstub
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/stubfile"
 )
 
+// stubFile is a stub together with the file it was loaded from. doc is the
+// zero Document for raw HTTP stubs.
+type stubFile struct {
+	path string
+	doc  stubfile.Document
+	stub Stub
+}
+
+// name identifies the stub in messages.
+func (f stubFile) name() string {
+	if f.doc.Index > 0 {
+		return fmt.Sprintf("%v (document %d)", f.path, f.doc.Index)
+	}
+	return f.path
+}
+
 func loadStubs(dir string, storage *Storage) error {
-	if err := filepath.WalkDir(dir, walk(dir, storage)); err != nil {
-		return fmt.Errorf("read stubs from dir %v: %w", dir, err)
+	stubs, err := readStubs(dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range stubs {
+		storage.Add(f.stub)
 	}
 	return nil
 }
 
-func walk(root string, storage *Storage) fs.WalkDirFunc {
-	return func(path string, d os.DirEntry, err error) error {
+// readStubs loads all stub files in dir. Stubs that fail to load are skipped
+// and their errors, which name the file, are returned joined after the walk.
+func readStubs(dir string) ([]stubFile, error) {
+	var stubs []stubFile
+	var errs []error
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if !d.IsDir() {
-			var stub Stub
-			var err error
-
-			switch filepath.Ext(path) {
+		if d.IsDir() {
+			return nil
+		}
 
-			case ".json":
-				stub, err = loadJSONFile(root, path)
-			case ".http":
-				stub, err = loadHTTPFile(root, path)
-			// pass
-			default:
-				return nil
+		switch {
+		case stubfile.IsStubFile(path):
+			files, err := loadJSONFile(dir, path)
+			if err != nil {
+				errs = append(errs, err)
 			}
-
+			stubs = append(stubs, files...)
+		case filepath.Ext(path) == ".http":
+			stub, err := loadHTTPFile(dir, path)
 			if err != nil {
-				return fmt.Errorf("load stub from %v: %w", path, err)
+				errs = append(errs, err)
+				return nil
 			}
-			storage.Add(stub)
-
+			stubs = append(stubs, stubFile{path: path, stub: stub})
 		}
 		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read stubs from dir %v: %w", dir, err)
+	}
+
+	sortRawStubs(stubs)
+	return stubs, errors.Join(errs...)
+}
+
+// sortRawStubs orders the raw HTTP stubs of every path and method by the
+// number of their request criteria, most specific first, so a stub without
+// criteria serves as the fallback of the others. Other stubs keep their
+// position.
+func sortRawStubs(stubs []stubFile) {
+	routes := map[string][]int{}
+	for i, f := range stubs {
+		if raw, ok := f.stub.(*HTTPStub); ok {
+			key := raw.HTTPMethod + " " + raw.Path
+			routes[key] = append(routes[key], i)
+		}
+	}
+
+	for _, slots := range routes {
+		group := make([]stubFile, len(slots))
+		for i, slot := range slots {
+			group[i] = stubs[slot]
+		}
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].stub.(*HTTPStub).specificity() > group[j].stub.(*HTTPStub).specificity()
+		})
+		for i, slot := range slots {
+			stubs[slot] = group[i]
+		}
 	}
 }
 
-func loadJSONFile(_ string, path string) (s Stub, err error) {
-	f, err := os.Open(path)
+// loadJSONFile loads the JSON stubs of a JSON or YAML file. Stubs that fail
+// to load are skipped and their errors returned joined.
+func loadJSONFile(_ string, path string) ([]stubFile, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("open file: %v: %w", path, err)
 	}
-	defer func() {
-		closeErr := f.Close()
-		if closeErr != nil {
-			err = errors.Join(err, fmt.Errorf("close file: %w", closeErr))
+
+	docs, err := stubfile.Split(path, data)
+	errs := []error{err}
+	var stubs []stubFile
+	for _, doc := range docs {
+		stub, err := decodeStub(doc.Data, filepath.Dir(path))
+		if err != nil {
+			errs = append(errs, doc.Locate(path, err))
+			continue
 		}
-	}()
+		stubs = append(stubs, stubFile{path: path, doc: doc, stub: stub})
+	}
+	return stubs, errors.Join(errs...)
+}
 
-	var stub JSONStub
-	if err := json.NewDecoder(f).Decode(&stub); err != nil {
-		return nil, fmt.Errorf("unmarshal stub %v: %w", path, err)
+// decodeStub decodes and validates a stub of a stub file in dir: a
+// StaticStub under the "static" key or a JSONStub otherwise.
+func decodeStub(data []byte, dir string) (Stub, error) {
+	var kind struct {
+		Static json.RawMessage `json:"static"`
 	}
+	if err := json.Unmarshal(data, &kind); err != nil || kind.Static == nil {
+		return decodeJSONStub(data, dir)
+	}
+
+	var stub struct {
+		Static StaticStub `json:"static"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&stub); err != nil {
+		return nil, fmt.Errorf("unmarshal stub: %w", err)
+	}
+	if err := stub.Static.Validate(); err != nil {
+		return nil, fmt.Errorf("stub validation: %w", err)
+	}
+	if err := stub.Static.resolveDir(dir); err != nil {
+		return nil, err
+	}
+	return &stub.Static, nil
+}
 
-	if err = stub.Validate(); err != nil {
-		return nil, fmt.Errorf("stub validation %v: %w", path, err)
+func decodeJSONStub(data []byte, dir string) (Stub, error) {
+	var stub JSONStub
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&stub); err != nil {
+		return nil, fmt.Errorf("unmarshal stub: %w", err)
+	}
+	if err := stub.Validate(); err != nil {
+		return nil, fmt.Errorf("stub validation: %w", err)
+	}
+	if err := stub.Response.resolveBodyFile(dir); err != nil {
+		return nil, err
 	}
 	return stub, nil
 }
@@ -0,0 +1,279 @@
+package httpstub
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp/syntax"
+	"sort"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/diag"
+)
+
+// Validate loads the stubs in dir like NewHandler and additionally reports
+// stubs that can never be served because an earlier stub matches all of their
+// requests, and stubs that share some of their requests with an earlier stub,
+// which serves the shared requests. All problems are returned joined.
+func Validate(dir string) error {
+	stubs, err := readStubs(dir)
+	errs := []error{err}
+
+	// Mirror the lookup order of Storage: exact matches first, then in load order.
+	sort.SliceStable(stubs, func(i, j int) bool {
+		return stubs[i].stub.Type() < stubs[j].stub.Type()
+	})
+	for i, later := range stubs {
+		var overlapping []stubFile
+		shadowed := false
+		for _, earlier := range stubs[:i] {
+			if shadows(earlier.stub, later.stub) {
+				errs = append(errs, shadowedError(later, earlier))
+				shadowed = true
+				break
+			}
+			if overlaps(earlier.stub, later.stub) {
+				overlapping = append(overlapping, earlier)
+			}
+		}
+		if !shadowed {
+			for _, earlier := range overlapping {
+				errs = append(errs, overlapError(later, earlier))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// shadows reports whether every request matched by later is already matched
+// by earlier.
+func shadows(earlier, later Stub) bool {
+	if !queryCovers(earlier, later) {
+		return false
+	}
+
+	lp, lm, ok := literalRoute(later)
+	if ok {
+		ep, em, ok := literalRoute(earlier)
+		if ok {
+			return ep == lp && methodCovers(em, lm)
+		}
+		if e, ok := earlier.(JSONStub); ok && e.regex != nil {
+			return e.regex.MatchString(lp) && methodCovers(e.HTTPMethod, lm)
+		}
+		return false
+	}
+
+	e, eok := earlier.(JSONStub)
+	l, lok := later.(JSONStub)
+	return eok && lok && e.RegexPath != "" && e.RegexPath == l.RegexPath && methodCovers(e.HTTPMethod, l.HTTPMethod)
+}
+
+// overlaps reports whether some but not all requests of earlier are matched
+// by later, as far as this can be decided: regexes are only compared with
+// literal paths and with identical regexes. Overlaps the lookup resolves on
+// purpose, like a later stub serving as the fallback for all other requests
+// of an earlier, more specific stub, or a static stub overridden by a single
+// route, are not reported.
+func overlaps(earlier, later Stub) bool {
+	if specificity(later) < specificity(earlier) || shadows(later, earlier) || !criteriaCompatible(earlier, later) {
+		return false
+	}
+	if !methodsOverlap(stubMethod(earlier), stubMethod(later)) {
+		return false
+	}
+
+	ep, _, eok := literalRoute(earlier)
+	lp, _, lok := literalRoute(later)
+	switch {
+	case eok && lok:
+		return ep == lp
+	case eok:
+		l, ok := later.(JSONStub)
+		return ok && l.regex != nil && l.regex.MatchString(ep)
+	case lok:
+		e, ok := earlier.(JSONStub)
+		return ok && e.regex != nil && e.regex.MatchString(lp)
+	}
+	e, eok := earlier.(JSONStub)
+	l, lok := later.(JSONStub)
+	return eok && lok && e.RegexPath != "" && e.RegexPath == l.RegexPath
+}
+
+// stubMethod returns the method matched by a JSON or raw HTTP stub.
+func stubMethod(s Stub) string {
+	switch s := s.(type) {
+	case JSONStub:
+		return s.HTTPMethod
+	case *HTTPStub:
+		return s.HTTPMethod
+	}
+	return ""
+}
+
+// methodsOverlap reports whether stubs with methods a and b match a common
+// method.
+func methodsOverlap(a, b string) bool {
+	return methodCovers(a, b) || methodCovers(b, a)
+}
+
+// criteriaCompatible reports whether a request can satisfy the query
+// parameters, headers, body and client certificate required by both stubs.
+// Stubs other than JSON and raw HTTP stubs are never compatible.
+func criteriaCompatible(a, b Stub) bool {
+	aq, ah, aok := requestCriteria(a)
+	bq, bh, bok := requestCriteria(b)
+	if !aok || !bok {
+		return false
+	}
+	for k, v := range aq {
+		if bv, ok := bq[k]; ok && bv != v {
+			return false
+		}
+	}
+	for k, v := range ah {
+		if bv, ok := headerValue(bh, k); ok && bv != v {
+			return false
+		}
+	}
+
+	if a, ok := a.(*HTTPStub); ok && a.Body != nil {
+		if b, ok := b.(*HTTPStub); ok && b.Body != nil && !bodyEqual(a.Body, b.Body) {
+			return false
+		}
+	}
+	if a, ok := a.(JSONStub); ok && a.ClientCert != nil {
+		if b, ok := b.(JSONStub); ok && b.ClientCert != nil {
+			return a.ClientCert.Covers(b.ClientCert) || b.ClientCert.Covers(a.ClientCert)
+		}
+	}
+	return true
+}
+
+// literalRoute returns the only path and the method matched by a stub. Regex
+// stubs qualify if their pattern is an anchored literal.
+func literalRoute(s Stub) (string, string, bool) {
+	switch s := s.(type) {
+	case *HTTPStub:
+		return s.Path, s.HTTPMethod, true
+	case JSONStub:
+		if s.ExactPath != "" {
+			return s.ExactPath, s.HTTPMethod, true
+		}
+		if path, ok := literalRegex(s.RegexPath); ok {
+			return path, s.HTTPMethod, true
+		}
+	}
+	return "", "", false
+}
+
+func literalRegex(expr string) (string, bool) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+	re = re.Simplify()
+	if re.Op != syntax.OpConcat || len(re.Sub) != 3 {
+		return "", false
+	}
+	if re.Sub[0].Op != syntax.OpBeginText || re.Sub[2].Op != syntax.OpEndText {
+		return "", false
+	}
+	lit := re.Sub[1]
+	if lit.Op != syntax.OpLiteral || lit.Flags&syntax.FoldCase != 0 {
+		return "", false
+	}
+	return string(lit.Rune), true
+}
+
+// queryCovers reports whether the query parameters, headers, body and client
+// certificate required by earlier are also required by later.
+func queryCovers(earlier, later Stub) bool {
+	eq, eh, ok := requestCriteria(earlier)
+	if !ok {
+		return true
+	}
+	lq, lh, _ := requestCriteria(later)
+	for k, v := range eq {
+		if lv, ok := lq[k]; !ok || lv != v {
+			return false
+		}
+	}
+	for k, v := range eh {
+		if lv, ok := headerValue(lh, k); !ok || lv != v {
+			return false
+		}
+	}
+
+	switch e := earlier.(type) {
+	case JSONStub:
+		l, _ := later.(JSONStub)
+		return e.ClientCert.Covers(l.ClientCert)
+	case *HTTPStub:
+		if e.Body == nil {
+			return true
+		}
+		l, ok := later.(*HTTPStub)
+		return ok && l.Body != nil && bodyEqual(e.Body, l.Body)
+	}
+	return true
+}
+
+// requestCriteria returns the query parameters and headers required by a
+// stub.
+func requestCriteria(s Stub) (map[string]string, map[string]string, bool) {
+	switch s := s.(type) {
+	case JSONStub:
+		return s.Query, s.Headers, true
+	case *HTTPStub:
+		return s.Query, s.Headers, true
+	}
+	return nil, nil, false
+}
+
+// headerValue looks up a header matcher case-insensitively.
+func headerValue(headers map[string]string, key string) (string, bool) {
+	for k, v := range headers {
+		if http.CanonicalHeaderKey(k) == http.CanonicalHeaderKey(key) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// methodCovers reports whether a stub with method a matches all requests of a
+// stub with method b.
+func methodCovers(a, b string) bool {
+	return a == "*" || a == "" || a == b
+}
+
+func shadowedError(later, earlier stubFile) error {
+	err := fmt.Errorf("stub is unreachable, all its requests are matched by %v", earlier.name())
+	return &diag.Error{File: later.path, Line: routeLine(later), Document: later.doc.Index, Err: err}
+}
+
+func overlapError(later, earlier stubFile) error {
+	err := fmt.Errorf("stub overlaps %v, which serves their common requests", stubLocation(earlier))
+	return &diag.Error{File: later.path, Line: routeLine(later), Document: later.doc.Index, Err: err}
+}
+
+// stubLocation returns the file, line and document of the route of a stub.
+func stubLocation(f stubFile) string {
+	location := f.path
+	if line := routeLine(f); line > 0 {
+		location = fmt.Sprintf("%v:%d", location, line)
+	}
+	if f.doc.Index > 0 {
+		location = fmt.Sprintf("%v (document %d)", location, f.doc.Index)
+	}
+	return location
+}
+
+// routeLine returns the line of the path or regex of a stub, or 0.
+func routeLine(f stubFile) int {
+	line := f.doc.KeyLine("path")
+	if line == 0 {
+		line = f.doc.KeyLine("regex")
+	}
+	return line
+}
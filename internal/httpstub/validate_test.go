@@ -0,0 +1,179 @@
+package httpstub
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name      string
+		files     map[string]string
+		wantError []string
+	}{
+		{
+			name: "valid",
+			files: map[string]string{
+				"a.json": `{"path": "/a", "method": "GET", "response": {"status": 200}}`,
+				"b.json": `{"path": "/a", "method": "POST", "response": {"status": 200}}`,
+				"c.json": `{"regex": "^/a/.*$", "method": "*", "response": {"status": 200}}`,
+				"d.json": `{"path": "/q", "method": "GET", "query": {"page": "1"}, "response": {"status": 200}}`,
+				"e.json": `{"path": "/q", "method": "GET", "response": {"status": 200}}`,
+			},
+		},
+		{
+			name: "exact duplicate",
+			files: map[string]string{
+				"a.json": `{"path": "/a", "method": "*", "response": {"status": 200}}`,
+				"b.json": `{"path": "/a", "method": "GET", "response": {"status": 200}}`,
+			},
+			wantError: []string{"b.json:1: stub is unreachable, all its requests are matched by"},
+		},
+		{
+			name: "literal regex behind exact",
+			files: map[string]string{
+				"a.json": `{"path": "/a", "method": "GET", "response": {"status": 200}}`,
+				"b.json": "{\n\"regex\": \"^/a$\",\n\"method\": \"GET\", \"response\": {\"status\": 200}}",
+			},
+			wantError: []string{"b.json:2: stub is unreachable"},
+		},
+		{
+			name: "duplicate regex",
+			files: map[string]string{
+				"a.json": `{"regex": "^/users/[0-9]+$", "method": "GET", "response": {"status": 200}}`,
+				"b.json": `{"regex": "^/users/[0-9]+$", "method": "GET", "response": {"status": 404}}`,
+			},
+			wantError: []string{"b.json:1: stub is unreachable"},
+		},
+		{
+			name: "all load errors",
+			files: map[string]string{
+				"a.json": "{\n\"path\": \"/a\",\n\"method\": \"GET\",\n\"response\": {\"status\": 9}}",
+				"b.json": "{\n\"regex\": \"(\",\n\"method\": \"GET\", \"response\": {\"status\": 200}}",
+				"c.json": "{\n\"path\": 1}",
+			},
+			wantError: []string{
+				"a.json:4: stub validation: response validation: status code 9 is not valid",
+				"b.json:2: stub validation: invalid regex",
+				"c.json:2: unmarshal stub",
+			},
+		},
+		{
+			name: "yaml and arrays",
+			files: map[string]string{
+				"a.yaml": "# users\npath: /users\nmethod: GET\nresponse:\n  status: 200\n  body: {users: []}\n---\npath: /users\nmethod: POST\nresponse:\n  status: 201\n",
+				"b.yml":  "- path: /orders\n  method: GET\n  response: {status: 200}\n",
+				"c.json": `[{"path": "/items", "method": "GET", "response": {"status": 200}}, {"path": "/items", "method": "PUT", "response": {"status": 204}}]`,
+			},
+		},
+		{
+			name: "document errors",
+			files: map[string]string{
+				"a.yaml": "path: /a\nmethod: GET\nresponse: {status: 200}\n---\npath: /b\nmethod: GET\nresponse:\n  status: 9\n---\npath: /a\nmethod: GET\nresponse: {status: 200}\n",
+				"b.json": "[\n{\"path\": \"/b\", \"method\": \"GET\", \"response\": {\"status\": 200}},\n{\"regex\": \"(\",\n\"method\": \"GET\", \"response\": {\"status\": 200}}\n]",
+				"c.yml":  "path: /c\nmethod: [GET]\n",
+			},
+			wantError: []string{
+				"a.yaml:8: document 2: stub validation: response validation: status code 9 is not valid",
+				"a.yaml:10: document 3: stub is unreachable",
+				"a.yaml (document 1)",
+				"b.json:3: document 2: stub validation: invalid regex",
+				"c.yml:2: unmarshal stub",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tc.files {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+			}
+
+			err := Validate(dir)
+			if len(tc.wantError) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			for _, want := range tc.wantError {
+				require.ErrorContains(t, err, want)
+			}
+		})
+	}
+}
+
+func TestValidateOverlaps(t *testing.T) {
+	cases := []struct {
+		name      string
+		files     map[string]string
+		wantError []string
+	}{
+		{
+			name: "regex overlapping literal path",
+			files: map[string]string{
+				"a.json": `{"path": "/users/1", "method": "*", "response": {"status": 200}}`,
+				"b.json": "{\n\"regex\": \"^/users/[0-9]+$\",\n\"method\": \"GET\", \"response\": {\"status\": 200}}",
+			},
+			wantError: []string{"b.json:2: stub overlaps ", "a.json:1, which serves their common requests"},
+		},
+		{
+			name: "different query subsets",
+			files: map[string]string{
+				"a.json": `{"path": "/q", "method": "GET", "query": {"page": "1"}, "response": {"status": 200}}`,
+				"b.json": `{"path": "/q", "method": "GET", "query": {"size": "10"}, "response": {"status": 200}}`,
+			},
+			wantError: []string{"b.json:1: stub overlaps ", "a.json:1"},
+		},
+		{
+			name: "regex fallback for literal path",
+			files: map[string]string{
+				"a.json": `{"path": "/users/1", "method": "GET", "response": {"status": 200}}`,
+				"b.json": `{"regex": "^/users/[0-9]+$", "method": "*", "response": {"status": 200}}`,
+			},
+		},
+		{
+			name: "disjoint query values",
+			files: map[string]string{
+				"a.json": `{"path": "/q", "method": "GET", "query": {"page": "1"}, "response": {"status": 200}}`,
+				"b.json": `{"path": "/q", "method": "GET", "query": {"page": "2"}, "response": {"status": 200}}`,
+			},
+		},
+		{
+			name: "disjoint methods",
+			files: map[string]string{
+				"a.json": `{"path": "/users/1", "method": "GET", "response": {"status": 200}}`,
+				"b.json": `{"regex": "^/users/[0-9]+$", "method": "POST", "response": {"status": 200}}`,
+			},
+		},
+		{
+			name: "raw fallback",
+			files: map[string]string{
+				"users/GET/a.http": "GET /users?page=1 HTTP/1.1\n\nHTTP/1.1 200 OK\n\n",
+				"users/GET/b.http": "HTTP/1.1 200 OK\n\n",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tc.files {
+				path := filepath.Join(dir, filepath.FromSlash(name))
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+				require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+			}
+
+			err := Validate(dir)
+			if len(tc.wantError) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			for _, want := range tc.wantError {
+				require.ErrorContains(t, err, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package httpstub
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultHost is the directory holding the stubs served to requests whose
+// host has no directory of its own.
+const DefaultHost = "_default"
+
+// VirtualHosts serves a separate set of stubs per host. Every directory in
+// the stub directory holds the stubs of the host it is named after.
+type VirtualHosts struct {
+	hosts    map[string]*Handler
+	fallback *Handler
+}
+
+var _ http.Handler = &VirtualHosts{}
+
+// NewVirtualHosts creates a Handler for every host directory in stubDir and
+// opts.StubDirs. The stubs of directories named after the same host are
+// merged. The options apply to every host; responses are recorded into the
+// first directory of the host. Files outside of host directories are ignored.
+func NewVirtualHosts(stubDir string, opts Options) (*VirtualHosts, error) {
+	dirs := map[string][]string{}
+	for _, root := range append([]string{stubDir}, opts.StubDirs...) {
+		hosts, err := hostDirs(root)
+		if err != nil {
+			return nil, err
+		}
+		for host, dir := range hosts {
+			dirs[host] = append(dirs[host], dir)
+		}
+	}
+
+	v := &VirtualHosts{hosts: map[string]*Handler{}}
+	var errs []error
+	for host, paths := range dirs {
+		hostOpts := opts
+		hostOpts.StubDirs = paths[1:]
+		h, err := NewHandlerWithOptions(paths[0], hostOpts)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("host %v: %w", host, err))
+			continue
+		}
+		if host == DefaultHost {
+			v.fallback = h
+		} else {
+			v.hosts[host] = h
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	if v.fallback == nil {
+		dir := ""
+		if opts.RecordUpstream != "" {
+			dir = filepath.Join(stubDir, DefaultHost)
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return nil, fmt.Errorf("create default host directory: %w", err)
+			}
+		}
+		fallbackOpts := opts
+		fallbackOpts.StubDirs = nil
+		var err error
+		if v.fallback, err = NewHandlerWithOptions(dir, fallbackOpts); err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+// ServeHTTP serves the request with the stubs of the host named by the Host
+// header, or by the TLS server name if the Host header names no known host.
+func (v *VirtualHosts) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.handler(r).ServeHTTP(w, r)
+}
+
+func (v *VirtualHosts) handler(r *http.Request) *Handler {
+	if h, ok := v.hosts[hostname(r.Host)]; ok {
+		return h
+	}
+	if r.TLS != nil {
+		if h, ok := v.hosts[hostname(r.TLS.ServerName)]; ok {
+			return h
+		}
+	}
+	return v.fallback
+}
+
+// ValidateVirtualHosts validates the stubs of every host directory in dir
+// like Validate.
+func ValidateVirtualHosts(dir string) error {
+	dirs, err := hostDirs(dir)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, d := range dirs {
+		errs = append(errs, Validate(d))
+	}
+	return errors.Join(errs...)
+}
+
+// hostDirs returns the host directories in stubDir by their normalized host
+// name.
+func hostDirs(stubDir string) (map[string]string, error) {
+	entries, err := os.ReadDir(stubDir)
+	if err != nil {
+		return nil, fmt.Errorf("read host directories: %w", err)
+	}
+
+	dirs := map[string]string{}
+	for _, e := range entries {
+		path := filepath.Join(stubDir, e.Name())
+		if !e.IsDir() {
+			slog.Warn("Ignoring file outside of a host directory", slog.String("file", path))
+			continue
+		}
+		host := hostname(e.Name())
+		if other, ok := dirs[host]; ok {
+			return nil, fmt.Errorf("directories %v and %v name the same host", other, path)
+		}
+		dirs[host] = path
+	}
+	return dirs, nil
+}
+
+// hostname normalizes a host for lookups: the port and a trailing dot are
+// removed and the name is lowercased.
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
@@ -0,0 +1,109 @@
+package httpstub
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVirtualHosts(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for host, body := range map[string]string{
+		"api.payments.local": "payments",
+		"API.Users.local":    "users",
+		DefaultHost:          "default",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, host), 0o755))
+		stub := `{"path": "/whoami", "method": "GET", "response": {"status": 200, "body": {"host": "` + body + `"}}}`
+		require.NoError(t, os.WriteFile(filepath.Join(dir, host, "whoami.json"), []byte(stub), 0o644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ignored.json"), []byte(`{`), 0o644))
+
+	v, err := NewVirtualHosts(dir, Options{})
+	require.NoError(t, err)
+
+	cases := []struct {
+		name string
+		host string
+		sni  string
+		want string
+	}{
+		{name: "host", host: "api.payments.local", want: "payments"},
+		{name: "host with port", host: "api.payments.local:8080", want: "payments"},
+		{name: "case insensitive", host: "api.users.LOCAL", want: "users"},
+		{name: "sni", host: "10.0.0.1:8443", sni: "api.users.local", want: "users"},
+		{name: "unknown host", host: "api.orders.local", want: "default"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+			req.Host = tc.host
+			if tc.sni != "" {
+				req.TLS = &tls.ConnectionState{ServerName: tc.sni}
+			}
+			rec := httptest.NewRecorder()
+			v.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusOK, rec.Code)
+			require.JSONEq(t, `{"host": "`+tc.want+`"}`, rec.Body.String())
+		})
+	}
+}
+
+func TestVirtualHostsWithoutDefault(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "api.payments.local"), 0o755))
+
+	v, err := NewVirtualHosts(dir, Options{})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	req.Host = "api.users.local"
+	rec := httptest.NewRecorder()
+	v.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestVirtualHostsErrors(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "api.payments.local"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "api.payments.local", "broken.json"), []byte(`{"method": "GET"}`), 0o644))
+
+	_, err := NewVirtualHosts(dir, Options{})
+	require.ErrorContains(t, err, "host api.payments.local")
+	require.ErrorContains(t, ValidateVirtualHosts(dir), filepath.Join(dir, "api.payments.local", "broken.json"))
+}
+
+func TestVirtualHostsStubDirs(t *testing.T) {
+	t.Parallel()
+
+	primary, shared := t.TempDir(), t.TempDir()
+	for dir, path := range map[string]string{primary: "/orders", shared: "/users"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "api.local"), 0o755))
+		stub := `{"path": "` + path + `", "method": "GET", "response": {"status": 200}}`
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "api.local", "stub.json"), []byte(stub), 0o644))
+	}
+
+	v, err := NewVirtualHosts(primary, Options{StubDirs: []string{shared}})
+	require.NoError(t, err)
+
+	for _, path := range []string{"/orders", "/users"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = "api.local"
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, path)
+	}
+}
@@ -0,0 +1,278 @@
+// Package openapi reads OpenAPI 3 documents and derives HTTP stubs from them.
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document is the subset of an OpenAPI 3.x document used to derive stubs and
+// validate requests and responses. Only local references ("#/components/...")
+// are supported.
+type Document struct {
+	OpenAPI    string               `yaml:"openapi"`
+	Servers    []Server             `yaml:"servers"`
+	Paths      map[string]*PathItem `yaml:"paths"`
+	Components Components           `yaml:"components"`
+}
+
+// Server is an entry of the servers list.
+type Server struct {
+	URL string `yaml:"url"`
+}
+
+// Components holds the reusable objects references point to.
+type Components struct {
+	Schemas       map[string]*Schema      `yaml:"schemas"`
+	Responses     map[string]*Response    `yaml:"responses"`
+	Examples      map[string]*Example     `yaml:"examples"`
+	Parameters    map[string]*Parameter   `yaml:"parameters"`
+	RequestBodies map[string]*RequestBody `yaml:"requestBodies"`
+}
+
+// PathItem lists the operations of a path template and the parameters shared
+// by them.
+type PathItem struct {
+	Parameters []*Parameter `yaml:"parameters"`
+	Get        *Operation   `yaml:"get"`
+	Put        *Operation   `yaml:"put"`
+	Post       *Operation   `yaml:"post"`
+	Delete     *Operation   `yaml:"delete"`
+	Options    *Operation   `yaml:"options"`
+	Head       *Operation   `yaml:"head"`
+	Patch      *Operation   `yaml:"patch"`
+	Trace      *Operation   `yaml:"trace"`
+}
+
+// Operations returns the operations of the path by HTTP method, in a fixed
+// order.
+func (p *PathItem) Operations() []MethodOperation {
+	all := []MethodOperation{
+		{"GET", p.Get}, {"PUT", p.Put}, {"POST", p.Post}, {"DELETE", p.Delete},
+		{"OPTIONS", p.Options}, {"HEAD", p.Head}, {"PATCH", p.Patch}, {"TRACE", p.Trace},
+	}
+	ops := all[:0]
+	for _, op := range all {
+		if op.Operation != nil {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+// MethodOperation is an operation together with its HTTP method.
+type MethodOperation struct {
+	Method    string
+	Operation *Operation
+}
+
+// Operation is a single API operation on a path.
+type Operation struct {
+	OperationID string               `yaml:"operationId"`
+	Parameters  []*Parameter         `yaml:"parameters"`
+	RequestBody *RequestBody         `yaml:"requestBody"`
+	Responses   map[string]*Response `yaml:"responses"`
+}
+
+// Parameter is a path, query or header parameter of an operation.
+type Parameter struct {
+	Ref      string  `yaml:"$ref"`
+	Name     string  `yaml:"name"`
+	In       string  `yaml:"in"`
+	Required bool    `yaml:"required"`
+	Schema   *Schema `yaml:"schema"`
+}
+
+// RequestBody describes the request body of an operation by media type.
+type RequestBody struct {
+	Ref      string                `yaml:"$ref"`
+	Required bool                  `yaml:"required"`
+	Content  map[string]*MediaType `yaml:"content"`
+}
+
+// Response describes a response of an operation by media type.
+type Response struct {
+	Ref     string                `yaml:"$ref"`
+	Content map[string]*MediaType `yaml:"content"`
+}
+
+// MediaType describes a request or response body of one media type.
+type MediaType struct {
+	Schema   *Schema             `yaml:"schema"`
+	Example  any                 `yaml:"example"`
+	Examples map[string]*Example `yaml:"examples"`
+}
+
+// Example is a named example value.
+type Example struct {
+	Ref   string `yaml:"$ref"`
+	Value any    `yaml:"value"`
+}
+
+// Schema is the subset of a JSON schema used to derive sample values and
+// validate values.
+type Schema struct {
+	Ref                  string                `yaml:"$ref"`
+	Type                 SchemaType            `yaml:"type"`
+	Format               string                `yaml:"format"`
+	Nullable             bool                  `yaml:"nullable"`
+	ReadOnly             bool                  `yaml:"readOnly"`
+	WriteOnly            bool                  `yaml:"writeOnly"`
+	Properties           map[string]*Schema    `yaml:"properties"`
+	Required             []string              `yaml:"required"`
+	AdditionalProperties *AdditionalProperties `yaml:"additionalProperties"`
+	Items                *Schema               `yaml:"items"`
+	AllOf                []*Schema             `yaml:"allOf"`
+	OneOf                []*Schema             `yaml:"oneOf"`
+	AnyOf                []*Schema             `yaml:"anyOf"`
+	Enum                 []any                 `yaml:"enum"`
+	Const                any                   `yaml:"const"`
+	Default              any                   `yaml:"default"`
+	Example              any                   `yaml:"example"`
+	Examples             []any                 `yaml:"examples"`
+	Minimum              *float64              `yaml:"minimum"`
+	Maximum              *float64              `yaml:"maximum"`
+	// ExclusiveMinimum and ExclusiveMaximum are booleans modifying Minimum
+	// and Maximum in OpenAPI 3.0 and numbers in 3.1.
+	ExclusiveMinimum any     `yaml:"exclusiveMinimum"`
+	ExclusiveMaximum any     `yaml:"exclusiveMaximum"`
+	MinLength        *int    `yaml:"minLength"`
+	MaxLength        *int    `yaml:"maxLength"`
+	Pattern          string  `yaml:"pattern"`
+	MinItems         *int    `yaml:"minItems"`
+	MaxItems         *int    `yaml:"maxItems"`
+	MultipleOf       float64 `yaml:"multipleOf"`
+}
+
+// AdditionalProperties is either a boolean or a schema for properties not
+// listed in Properties.
+type AdditionalProperties struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+// UnmarshalYAML accepts a boolean or a schema.
+func (a *AdditionalProperties) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&a.Allowed)
+	}
+	a.Allowed = true
+	return node.Decode(&a.Schema)
+}
+
+// SchemaType is the type of a schema. OpenAPI 3.0 allows a single type,
+// 3.1 also a list of types.
+type SchemaType []string
+
+// UnmarshalYAML accepts a single type or a list of types.
+func (t *SchemaType) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*t = SchemaType{node.Value}
+		return nil
+	}
+	var types []string
+	if err := node.Decode(&types); err != nil {
+		return err
+	}
+	*t = types
+	return nil
+}
+
+// Is reports whether typ is one of the schema types.
+func (t SchemaType) Is(typ string) bool {
+	for _, v := range t {
+		if v == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Load reads an OpenAPI 3.x document in YAML or JSON format.
+func Load(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read OpenAPI document: %w", err)
+	}
+	doc, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return doc, nil
+}
+
+// Parse parses an OpenAPI 3.x document in YAML or JSON format.
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse OpenAPI document: %w", err)
+	}
+	if doc.OpenAPI == "" {
+		return nil, errors.New(`"openapi" field is required`)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("OpenAPI version %v is not supported, only 3.x is", doc.OpenAPI)
+	}
+	return &doc, nil
+}
+
+// maxRefDepth limits chains of references to references.
+const maxRefDepth = 32
+
+// schema resolves a schema reference.
+func (d *Document) schema(s *Schema) (*Schema, error) {
+	return resolve(s, func(s *Schema) string { return s.Ref }, d.Components.Schemas, "schemas")
+}
+
+// response resolves a response reference.
+func (d *Document) response(r *Response) (*Response, error) {
+	return resolve(r, func(r *Response) string { return r.Ref }, d.Components.Responses, "responses")
+}
+
+// parameter resolves a parameter reference.
+func (d *Document) parameter(p *Parameter) (*Parameter, error) {
+	return resolve(p, func(p *Parameter) string { return p.Ref }, d.Components.Parameters, "parameters")
+}
+
+// requestBody resolves a request body reference.
+func (d *Document) requestBody(b *RequestBody) (*RequestBody, error) {
+	return resolve(b, func(b *RequestBody) string { return b.Ref }, d.Components.RequestBodies, "requestBodies")
+}
+
+// example resolves an example reference.
+func (d *Document) example(e *Example) (*Example, error) {
+	return resolve(e, func(e *Example) string { return e.Ref }, d.Components.Examples, "examples")
+}
+
+// resolve follows the references of v to the component it points to.
+func resolve[T any](v *T, ref func(*T) string, components map[string]*T, kind string) (*T, error) {
+	for i := 0; v != nil && ref(v) != ""; i++ {
+		if i == maxRefDepth {
+			return nil, fmt.Errorf("reference %q: too many indirections", ref(v))
+		}
+		name, err := componentName(ref(v), kind)
+		if err != nil {
+			return nil, err
+		}
+		next, ok := components[name]
+		if !ok {
+			return nil, fmt.Errorf("reference %q not found", ref(v))
+		}
+		v = next
+	}
+	return v, nil
+}
+
+// componentName returns the component name of a local reference of the given
+// kind, e.g. "#/components/schemas/User".
+func componentName(ref string, kind string) (string, error) {
+	name, ok := strings.CutPrefix(ref, "#/components/"+kind+"/")
+	if !ok || name == "" {
+		return "", fmt.Errorf("reference %q is not supported, only local %v references are", ref, kind)
+	}
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(name), nil
+}
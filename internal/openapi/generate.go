@@ -0,0 +1,310 @@
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/httpstub"
+)
+
+// StatusHeader is the request header selecting the response of a generated
+// stub by status code, e.g. "X-Stub-Status: 404". Without it the first
+// success response is served.
+const StatusHeader = "X-Stub-Status"
+
+// Stub is a generated stub together with a file name for it.
+type Stub struct {
+	Name string
+	Stub httpstub.JSONStub
+}
+
+var pathParam = regexp.MustCompile(`\{[^/{}]+\}`)
+
+// Stubs derives a stub per operation and response status code. The stub of
+// the default response, the lowest 2xx or else the lowest status code, has no
+// header matcher; all responses, including the default one, also get a stub
+// matching StatusHeader. Stubs are returned in the order they must be loaded
+// for the header matchers to take precedence. Operations that fail are
+// skipped and their errors returned joined.
+func (d *Document) Stubs() ([]Stub, error) {
+	basePath := d.basePath()
+
+	paths := make([]string, 0, len(d.Paths))
+	for path := range d.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var stubs []Stub
+	var errs []error
+	for _, path := range paths {
+		item := d.Paths[path]
+		if item == nil {
+			continue
+		}
+		for _, op := range item.Operations() {
+			generated, err := d.operationStubs(basePath+path, op)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%v %v: %w", op.Method, path, err))
+				continue
+			}
+			stubs = append(stubs, generated...)
+		}
+	}
+	return stubs, errors.Join(errs...)
+}
+
+func (d *Document) operationStubs(path string, op MethodOperation) ([]Stub, error) {
+	codes := make([]string, 0, len(op.Operation.Responses))
+	for code := range op.Operation.Responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	if len(codes) == 0 {
+		return nil, errors.New("no responses")
+	}
+
+	route := httpstub.JSONStub{HTTPMethod: op.Method}
+	if pathParam.MatchString(path) {
+		route.RegexPath = pathRegex(path)
+	} else {
+		route.ExactPath = path
+	}
+
+	name := stubName(path, op)
+	var stubs []Stub
+	var preferred *Stub
+	for _, code := range codes {
+		status, ok := statusCode(code, len(codes))
+		if !ok {
+			return nil, fmt.Errorf("invalid response status %q", code)
+		}
+		resp, err := d.stubResponse(status, op.Operation.Responses[code])
+		if err != nil {
+			return nil, fmt.Errorf("response %v: %w", code, err)
+		}
+
+		stub := route
+		stub.Headers = map[string]string{StatusHeader: strconv.Itoa(status)}
+		stub.Response = resp
+		if err := stub.Validate(); err != nil {
+			return nil, fmt.Errorf("response %v: %w", code, err)
+		}
+		stubs = append(stubs, Stub{Name: name + "." + code, Stub: stub})
+
+		if preferred == nil || preferredStatus(status, preferred.Stub.Response.Status) {
+			preferred = &Stub{Name: name, Stub: stub}
+		}
+	}
+	preferred.Stub.Headers = nil
+	return append(stubs, *preferred), nil
+}
+
+// stubResponse builds the response from the first JSON media type of the
+// response, using its example or a sample derived from its schema.
+func (d *Document) stubResponse(status int, r *Response) (httpstub.JSONResponse, error) {
+	resp := httpstub.JSONResponse{Status: status}
+	r, err := d.response(r)
+	if err != nil || r == nil {
+		return resp, err
+	}
+
+	mediaTypes := make([]string, 0, len(r.Content))
+	for mediaType := range r.Content {
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+	sort.Slice(mediaTypes, func(i, j int) bool {
+		// Prefer application/json over other JSON media types.
+		if (mediaTypes[i] == "application/json") != (mediaTypes[j] == "application/json") {
+			return mediaTypes[i] == "application/json"
+		}
+		return mediaTypes[i] < mediaTypes[j]
+	})
+
+	for _, mediaType := range mediaTypes {
+		if !isJSON(mediaType) {
+			continue
+		}
+		body, err := d.mediaExample(r.Content[mediaType])
+		if err != nil {
+			return resp, err
+		}
+		resp.Header = http.Header{"Content-Type": {mediaType}}
+		if body != nil {
+			if resp.Body, err = json.Marshal(body); err != nil {
+				return resp, fmt.Errorf("encode example: %w", err)
+			}
+		}
+		return resp, nil
+	}
+	if len(mediaTypes) > 0 {
+		slog.Warn("Response has no JSON media type, generating stub without body", slog.Int("status", status), slog.Any("media_types", mediaTypes))
+	}
+	return resp, nil
+}
+
+// mediaExample returns the example of the media type, the first of its named
+// examples, or a sample derived from its schema.
+func (d *Document) mediaExample(mt *MediaType) (any, error) {
+	if mt == nil {
+		return nil, nil
+	}
+	if mt.Example != nil {
+		return jsonValue(mt.Example), nil
+	}
+	if len(mt.Examples) > 0 {
+		names := make([]string, 0, len(mt.Examples))
+		for name := range mt.Examples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		ex, err := d.example(mt.Examples[names[0]])
+		if err != nil {
+			return nil, fmt.Errorf("example %q: %w", names[0], err)
+		}
+		if ex != nil && ex.Value != nil {
+			return jsonValue(ex.Value), nil
+		}
+	}
+	v, err := d.sample(mt.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	return v, nil
+}
+
+// basePath returns the path of the first server URL, which prefixes all
+// paths of the document.
+func (d *Document) basePath() string {
+	if len(d.Servers) == 0 {
+		return ""
+	}
+	u, err := url.Parse(d.Servers[0].URL)
+	if err != nil || strings.Contains(u.Path, "{") {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+// pathRegex converts a path template like /users/{id} into an anchored regex
+// matching a single path segment per parameter.
+func pathRegex(template string) string {
+	expr, _ := templateRegex(template, "[^/]+")
+	return expr
+}
+
+// templateRegex replaces the parameters of a path template with segment and
+// quotes the rest. It returns the anchored expression and the parameter
+// names in order.
+func templateRegex(template string, segment string) (string, []string) {
+	var b strings.Builder
+	var names []string
+	b.WriteString("^")
+	last := 0
+	for _, loc := range pathParam.FindAllStringIndex(template, -1) {
+		b.WriteString(regexp.QuoteMeta(template[last:loc[0]]))
+		b.WriteString(segment)
+		names = append(names, template[loc[0]+1:loc[1]-1])
+		last = loc[1]
+	}
+	b.WriteString(regexp.QuoteMeta(template[last:]))
+	b.WriteString("$")
+	return b.String(), names
+}
+
+// statusCode converts a response key to a status code. Ranges like "4XX" use
+// the first code of the range. The "default" response is treated as 200 if it
+// is the only response and as 500 otherwise.
+func statusCode(code string, responses int) (int, bool) {
+	if code == "default" {
+		if responses == 1 {
+			return http.StatusOK, true
+		}
+		return http.StatusInternalServerError, true
+	}
+	if len(code) == 3 && strings.EqualFold(code[1:], "XX") {
+		code = code[:1] + "00"
+	}
+	status, err := strconv.Atoi(code)
+	if err != nil || status < 100 || status > 599 {
+		return 0, false
+	}
+	return status, true
+}
+
+// preferredStatus reports whether status a should be served by default
+// rather than b: success codes first, then the lowest code.
+func preferredStatus(a, b int) bool {
+	aOK, bOK := a >= 200 && a < 300, b >= 200 && b < 300
+	if aOK != bOK {
+		return aOK
+	}
+	return a < b
+}
+
+// stubName returns the operation ID, or the path and method for operations
+// without ID, as file name without extension.
+func stubName(path string, op MethodOperation) string {
+	name := op.Operation.OperationID
+	if name == "" {
+		name = strings.ReplaceAll(strings.Trim(path, "/"), "/", "_")
+		if name == "" {
+			name = "root"
+		}
+		name += "." + op.Method
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == '{' || r == '}' || r == ':' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+func isJSON(mediaType string) bool {
+	mt, _, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		return false
+	}
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// WriteStubs writes the stubs as JSON files named after the stubs to dir.
+// Existing files are left untouched. It returns the paths of the written
+// files.
+func WriteStubs(dir string, stubs []Stub) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create dir: %w", err)
+	}
+
+	var written []string
+	for _, stub := range stubs {
+		path := filepath.Join(dir, stub.Name+".json")
+		if _, err := os.Stat(path); err == nil {
+			continue
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return written, fmt.Errorf("stat %v: %w", path, err)
+		}
+
+		b, err := json.MarshalIndent(stub.Stub, "", "  ")
+		if err != nil {
+			return written, fmt.Errorf("marshal stub %v: %w", stub.Name, err)
+		}
+		if err := os.WriteFile(path, append(b, '\n'), 0o644); err != nil {
+			return written, fmt.Errorf("write stub: %w", err)
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
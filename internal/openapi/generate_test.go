@@ -0,0 +1,136 @@
+package openapi_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/httpstub"
+	"github.com/randomenterprisesolutions/stub-server/internal/openapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStubs(t *testing.T) {
+	t.Parallel()
+
+	doc, err := openapi.Load("../../examples/openapi/users.yaml")
+	require.NoError(t, err)
+	stubs, err := doc.Stubs()
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(stubs))
+	for _, s := range stubs {
+		names = append(names, s.Name)
+	}
+	require.Equal(t, []string{
+		"listUsers.200", "listUsers",
+		"createUser.201", "createUser",
+		"getUser.200", "getUser.404", "getUser",
+		"deleteUser.204", "deleteUser",
+	}, names)
+
+	get := stubs[6].Stub
+	require.Equal(t, `^/v1/users/[^/]+$`, get.RegexPath)
+	require.Equal(t, "GET", get.HTTPMethod)
+	require.Empty(t, get.Headers)
+	require.Equal(t, http.StatusOK, get.Response.Status)
+	require.Contains(t, string(get.Response.Body), `"email":"alice@example.com"`)
+
+	notFound := stubs[5].Stub
+	require.Equal(t, map[string]string{openapi.StatusHeader: "404"}, notFound.Headers)
+	require.Equal(t, "application/problem+json", notFound.Response.Header.Get("Content-Type"))
+	require.JSONEq(t, `{"message": "user not found"}`, string(notFound.Response.Body))
+
+	list := stubs[1].Stub
+	require.Equal(t, "/v1/users", list.ExactPath)
+	require.JSONEq(t, `{
+		"users": [{
+			"id": "00000000-0000-4000-8000-000000000000",
+			"email": "user@example.com",
+			"role": "admin",
+			"createdAt": "2024-01-01T00:00:00Z"
+		}],
+		"total": 1
+	}`, string(list.Response.Body))
+
+	deleted := stubs[8].Stub
+	require.Equal(t, http.StatusNoContent, deleted.Response.Status)
+	require.Nil(t, deleted.Response.Body)
+}
+
+func TestStubsServeStatusVariants(t *testing.T) {
+	t.Parallel()
+
+	doc, err := openapi.Load("../../examples/openapi/users.yaml")
+	require.NoError(t, err)
+	stubs, err := doc.Stubs()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	written, err := openapi.WriteStubs(dir, stubs)
+	require.NoError(t, err)
+	require.Len(t, written, len(stubs))
+	require.NoError(t, httpstub.Validate(dir))
+
+	// Existing files are not overwritten.
+	written, err = openapi.WriteStubs(dir, stubs)
+	require.NoError(t, err)
+	require.Empty(t, written)
+
+	handler, err := httpstub.NewHandler(dir)
+	require.NoError(t, err)
+
+	cases := []struct {
+		status     string
+		wantStatus int
+	}{
+		{wantStatus: http.StatusOK},
+		{status: "200", wantStatus: http.StatusOK},
+		{status: "404", wantStatus: http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/v1/users/42", nil)
+		if tc.status != "" {
+			req.Header.Set(openapi.StatusHeader, tc.status)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		require.Equal(t, tc.wantStatus, rec.Code, tc.status)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"missing version":  "paths: {}",
+		"swagger 2":        "swagger: '2.0'\nopenapi: '2.0'",
+		"invalid document": "openapi: [",
+	}
+	for name, doc := range cases {
+		_, err := openapi.Parse([]byte(doc))
+		require.Error(t, err, name)
+	}
+
+	path := filepath.Join(t.TempDir(), "broken.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`openapi: 3.1.0
+paths:
+  /a:
+    get:
+      responses:
+        "200":
+          $ref: "#/components/responses/Missing"
+  /b:
+    get:
+      responses:
+        "200":
+          description: ok
+`), 0o600))
+	doc, err := openapi.Load(path)
+	require.NoError(t, err)
+	stubs, err := doc.Stubs()
+	require.ErrorContains(t, err, `GET /a: response 200: reference "#/components/responses/Missing" not found`)
+	require.Len(t, stubs, 2)
+}
@@ -0,0 +1,162 @@
+package openapi
+
+import (
+	"errors"
+	"fmt"
+)
+
+// sampleDepth limits how deep recursive schemas are populated.
+const sampleDepth = 5
+
+// sample returns a value for the schema. Explicit examples, defaults, consts
+// and enums are preferred over values derived from the type and format.
+// Only the first alternative of oneOf and anyOf is used.
+func (d *Document) sample(s *Schema) (any, error) {
+	return d.sampleAt(s, 0)
+}
+
+func (d *Document) sampleAt(s *Schema, depth int) (any, error) {
+	s, err := d.schema(s)
+	if err != nil || s == nil {
+		return nil, err
+	}
+
+	switch {
+	case s.Example != nil:
+		return jsonValue(s.Example), nil
+	case len(s.Examples) > 0:
+		return jsonValue(s.Examples[0]), nil
+	case s.Default != nil:
+		return jsonValue(s.Default), nil
+	case s.Const != nil:
+		return jsonValue(s.Const), nil
+	case len(s.Enum) > 0:
+		return jsonValue(s.Enum[0]), nil
+	case len(s.AllOf) > 0:
+		return d.sampleAllOf(s.AllOf, depth)
+	case len(s.OneOf) > 0:
+		return d.sampleAt(s.OneOf[0], depth)
+	case len(s.AnyOf) > 0:
+		return d.sampleAt(s.AnyOf[0], depth)
+	}
+
+	switch {
+	case s.Type.Is("object") || (len(s.Type) == 0 && s.Properties != nil):
+		obj := map[string]any{}
+		if depth >= sampleDepth {
+			return obj, nil
+		}
+		var errs []error
+		for name, prop := range s.Properties {
+			v, err := d.sampleAt(prop, depth+1)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("property %q: %w", name, err))
+				continue
+			}
+			obj[name] = v
+		}
+		return obj, errors.Join(errs...)
+	case s.Type.Is("array"):
+		if s.Items == nil || depth >= sampleDepth {
+			return []any{}, nil
+		}
+		item, err := d.sampleAt(s.Items, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("items: %w", err)
+		}
+		return []any{item}, nil
+	case s.Type.Is("string"):
+		return sampleString(s.Format), nil
+	case s.Type.Is("integer"):
+		if s.Minimum != nil && *s.Minimum > 1 {
+			return int64(*s.Minimum), nil
+		}
+		return 1, nil
+	case s.Type.Is("number"):
+		if s.Minimum != nil && *s.Minimum > 1.5 {
+			return *s.Minimum, nil
+		}
+		return 1.5, nil
+	case s.Type.Is("boolean"):
+		return true, nil
+	}
+	return nil, nil
+}
+
+// sampleAllOf merges the samples of all object schemas.
+func (d *Document) sampleAllOf(schemas []*Schema, depth int) (any, error) {
+	merged := map[string]any{}
+	var last any
+	for _, sub := range schemas {
+		v, err := d.sampleAt(sub, depth)
+		if err != nil {
+			return nil, err
+		}
+		obj, ok := v.(map[string]any)
+		if !ok {
+			last = v
+			continue
+		}
+		for k, v := range obj {
+			merged[k] = v
+		}
+	}
+	if len(merged) == 0 && last != nil {
+		return last, nil
+	}
+	return merged, nil
+}
+
+func sampleString(format string) string {
+	switch format {
+	case "date-time":
+		return "2024-01-01T00:00:00Z"
+	case "date":
+		return "2024-01-01"
+	case "time":
+		return "00:00:00"
+	case "uuid":
+		return "00000000-0000-4000-8000-000000000000"
+	case "email":
+		return "user@example.com"
+	case "uri", "url":
+		return "https://example.com"
+	case "hostname":
+		return "example.com"
+	case "ipv4":
+		return "192.0.2.1"
+	case "ipv6":
+		return "2001:db8::1"
+	case "byte":
+		return "c3R1Yg=="
+	default:
+		return "string"
+	}
+}
+
+// jsonValue converts YAML maps with non-string keys so the value can be
+// encoded as JSON.
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			out[k] = jsonValue(e)
+		}
+		return out
+	case map[any]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			out[fmt.Sprint(k)] = jsonValue(e)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = jsonValue(e)
+		}
+		return out
+	default:
+		return v
+	}
+}
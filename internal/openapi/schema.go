@@ -0,0 +1,344 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// direction selects which of readOnly and writeOnly properties are expected.
+type direction int
+
+const (
+	// request values must not require readOnly properties.
+	request direction = iota
+	// response values must not require writeOnly properties.
+	response
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// patterns caches the compiled schema patterns.
+var patterns sync.Map
+
+// schemaError is a value not matching its schema at a JSON pointer.
+type schemaError struct {
+	Pointer string
+	Message string
+}
+
+// validateValue checks a JSON decoded value against the schema and returns
+// all mismatches. Pointers are JSON pointers relative to value.
+func (d *Document) validateValue(s *Schema, value any, dir direction) []schemaError {
+	return d.validateAt(s, value, "", dir)
+}
+
+func (d *Document) validateAt(s *Schema, value any, pointer string, dir direction) []schemaError {
+	s, err := d.schema(s)
+	if err != nil {
+		return []schemaError{{Pointer: pointer, Message: err.Error()}}
+	}
+	if s == nil {
+		return nil
+	}
+
+	fail := func(format string, args ...any) []schemaError {
+		return []schemaError{{Pointer: pointer, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	var errs []schemaError
+	for _, sub := range s.AllOf {
+		errs = append(errs, d.validateAt(sub, value, pointer, dir)...)
+	}
+	if len(s.OneOf) > 0 {
+		matches := 0
+		for _, sub := range s.OneOf {
+			if len(d.validateAt(sub, value, pointer, dir)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			errs = append(errs, fail("must match exactly one schema of oneOf, matches %d", matches)...)
+		}
+	}
+	if len(s.AnyOf) > 0 {
+		matched := false
+		for _, sub := range s.AnyOf {
+			if len(d.validateAt(sub, value, pointer, dir)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			errs = append(errs, fail("must match at least one schema of anyOf")...)
+		}
+	}
+
+	if value == nil {
+		if s.Nullable || len(s.Type) == 0 || s.Type.Is("null") {
+			return errs
+		}
+		return append(errs, fail("must not be null")...)
+	}
+
+	if len(s.Enum) > 0 && !containsJSON(s.Enum, value) {
+		errs = append(errs, fail("must be one of %v", formatJSON(s.Enum))...)
+	}
+	if s.Const != nil && !equalJSON(s.Const, value) {
+		errs = append(errs, fail("must be %v", formatJSON(s.Const))...)
+	}
+
+	if len(s.Type) > 0 && !matchesType(s.Type, value) {
+		return append(errs, fail("must be of type %v, got %v", strings.Join(s.Type, " or "), jsonType(value))...)
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		errs = append(errs, d.validateObject(s, v, pointer, dir)...)
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			errs = append(errs, fail("must have at least %d items", *s.MinItems)...)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			errs = append(errs, fail("must have at most %d items", *s.MaxItems)...)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				errs = append(errs, d.validateAt(s.Items, item, fmt.Sprintf("%v/%d", pointer, i), dir)...)
+			}
+		}
+	case string:
+		errs = append(errs, validateString(s, v, pointer)...)
+	case float64:
+		errs = append(errs, validateNumber(s, v, pointer)...)
+	}
+	return errs
+}
+
+func (d *Document) validateObject(s *Schema, obj map[string]any, pointer string, dir direction) []schemaError {
+	var errs []schemaError
+	for _, name := range s.Required {
+		if _, ok := obj[name]; ok {
+			continue
+		}
+		if prop, err := d.schema(s.Properties[name]); err == nil && prop != nil {
+			if (dir == request && prop.ReadOnly) || (dir == response && prop.WriteOnly) {
+				continue
+			}
+		}
+		errs = append(errs, schemaError{Pointer: pointer, Message: fmt.Sprintf("missing required property %q", name)})
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child := pointer + "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+		if prop, ok := s.Properties[name]; ok {
+			errs = append(errs, d.validateAt(prop, obj[name], child, dir)...)
+			continue
+		}
+		if s.AdditionalProperties == nil {
+			continue
+		}
+		if !s.AdditionalProperties.Allowed {
+			errs = append(errs, schemaError{Pointer: child, Message: "additional property is not allowed"})
+			continue
+		}
+		if s.AdditionalProperties.Schema != nil {
+			errs = append(errs, d.validateAt(s.AdditionalProperties.Schema, obj[name], child, dir)...)
+		}
+	}
+	return errs
+}
+
+func validateString(s *Schema, v string, pointer string) []schemaError {
+	var errs []schemaError
+	fail := func(format string, args ...any) {
+		errs = append(errs, schemaError{Pointer: pointer, Message: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(v)
+	if s.MinLength != nil && length < *s.MinLength {
+		fail("must be at least %d characters long", *s.MinLength)
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		fail("must be at most %d characters long", *s.MaxLength)
+	}
+	if s.Pattern != "" {
+		re, err := compilePattern(s.Pattern)
+		if err != nil {
+			fail("invalid pattern %q in schema: %v", s.Pattern, err)
+		} else if !re.MatchString(v) {
+			fail("must match pattern %q", s.Pattern)
+		}
+	}
+	if !validFormat(s.Format, v) {
+		fail("must be a valid %v", s.Format)
+	}
+	return errs
+}
+
+func validateNumber(s *Schema, v float64, pointer string) []schemaError {
+	var errs []schemaError
+	fail := func(format string, args ...any) {
+		errs = append(errs, schemaError{Pointer: pointer, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if limit, exclusive, ok := bound(s.Minimum, s.ExclusiveMinimum); ok {
+		if exclusive && v <= limit {
+			fail("must be greater than %v", limit)
+		} else if v < limit {
+			fail("must be at least %v", limit)
+		}
+	}
+	if limit, exclusive, ok := bound(s.Maximum, s.ExclusiveMaximum); ok {
+		if exclusive && v >= limit {
+			fail("must be less than %v", limit)
+		} else if v > limit {
+			fail("must be at most %v", limit)
+		}
+	}
+	if s.MultipleOf > 0 {
+		if q := v / s.MultipleOf; math.Abs(q-math.Round(q)) > 1e-9 {
+			fail("must be a multiple of %v", s.MultipleOf)
+		}
+	}
+	return errs
+}
+
+// bound returns the effective limit of a minimum or maximum and whether it is
+// exclusive. exclusive is a boolean in OpenAPI 3.0 and a number in 3.1.
+func bound(limit *float64, exclusive any) (float64, bool, bool) {
+	switch e := exclusive.(type) {
+	case bool:
+		if limit != nil {
+			return *limit, e, true
+		}
+	case int:
+		return float64(e), true, true
+	case float64:
+		return e, true, true
+	}
+	if limit != nil {
+		return *limit, false, true
+	}
+	return 0, false, false
+}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(pattern, re)
+	return re, nil
+}
+
+// validFormat checks the common string formats. Unknown formats are valid.
+func validFormat(format string, v string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, v)
+		return err == nil
+	case "date":
+		_, err := time.Parse(time.DateOnly, v)
+		return err == nil
+	case "uuid":
+		return uuidPattern.MatchString(v)
+	case "email":
+		_, err := mail.ParseAddress(v)
+		return err == nil
+	case "ipv4":
+		ip := net.ParseIP(v)
+		return ip != nil && ip.To4() != nil
+	case "ipv6":
+		ip := net.ParseIP(v)
+		return ip != nil && ip.To4() == nil
+	default:
+		return true
+	}
+}
+
+func matchesType(types SchemaType, value any) bool {
+	for _, t := range types {
+		switch t {
+		case "integer":
+			if f, ok := value.(float64); ok && f == math.Trunc(f) {
+				return true
+			}
+		case "number":
+			if _, ok := value.(float64); ok {
+				return true
+			}
+		default:
+			if t == jsonType(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// equalJSON compares a value from the document with a JSON decoded value.
+func equalJSON(want any, got any) bool {
+	b, err := json.Marshal(jsonValue(want))
+	if err != nil {
+		return false
+	}
+	var normalized any
+	if err := json.Unmarshal(b, &normalized); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(normalized, got)
+}
+
+func containsJSON(values []any, got any) bool {
+	for _, v := range values {
+		if equalJSON(v, got) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatJSON(v any) string {
+	b, err := json.Marshal(jsonValue(v))
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
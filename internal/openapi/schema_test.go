@@ -0,0 +1,89 @@
+package openapi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateValue(t *testing.T) {
+	doc, err := Parse([]byte(`openapi: 3.1.0
+components:
+  schemas:
+    Pet:
+      oneOf:
+        - $ref: "#/components/schemas/Cat"
+        - $ref: "#/components/schemas/Dog"
+    Cat:
+      type: object
+      required: [meows]
+      properties:
+        meows: {type: boolean}
+      additionalProperties: false
+    Dog:
+      type: object
+      required: [barks]
+      properties:
+        barks: {type: boolean}
+      additionalProperties: false
+    Tags:
+      type: array
+      maxItems: 2
+      items:
+        type: string
+        pattern: "^[a-z]+$"
+    Score:
+      type: [number, "null"]
+      exclusiveMinimum: 0
+      multipleOf: 0.5
+    Account:
+      type: object
+      required: [id, password]
+      properties:
+        id: {type: string, readOnly: true}
+        password: {type: string, writeOnly: true}
+`))
+	require.NoError(t, err)
+
+	cases := []struct {
+		name   string
+		schema string
+		value  string
+		dir    direction
+		want   []schemaError
+	}{
+		{name: "oneOf cat", schema: "Pet", value: `{"meows": true}`},
+		{name: "oneOf neither", schema: "Pet", value: `{"purrs": true}`, want: []schemaError{
+			{Message: "must match exactly one schema of oneOf, matches 0"},
+		}},
+		{name: "additional property", schema: "Cat", value: `{"meows": true, "barks": false}`, want: []schemaError{
+			{Pointer: "/barks", Message: "additional property is not allowed"},
+		}},
+		{name: "array items", schema: "Tags", value: `["a", "B", "c"]`, want: []schemaError{
+			{Message: "must have at most 2 items"},
+			{Pointer: "/1", Message: `must match pattern "^[a-z]+$"`},
+		}},
+		{name: "null type", schema: "Score", value: `null`},
+		{name: "exclusive minimum", schema: "Score", value: `0`, want: []schemaError{
+			{Message: "must be greater than 0"},
+		}},
+		{name: "multiple of", schema: "Score", value: `1.2`, want: []schemaError{
+			{Message: "must be a multiple of 0.5"},
+		}},
+		{name: "readOnly not required in requests", schema: "Account", value: `{"password": "x"}`, dir: request},
+		{name: "writeOnly not required in responses", schema: "Account", value: `{"id": "x"}`, dir: response},
+		{name: "writeOnly required in requests", schema: "Account", value: `{"id": "x"}`, dir: request, want: []schemaError{
+			{Message: `missing required property "password"`},
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var value any
+			require.NoError(t, json.Unmarshal([]byte(tc.value), &value))
+			got := doc.validateValue(&Schema{Ref: "#/components/schemas/" + tc.schema}, value, tc.dir)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
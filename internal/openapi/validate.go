@@ -0,0 +1,530 @@
+package openapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ValidationMode controls what happens to requests and responses that don't
+// match the document.
+type ValidationMode string
+
+const (
+	// ValidationOff disables validation.
+	ValidationOff ValidationMode = "off"
+	// ValidationWarn logs violations but serves requests unchanged.
+	ValidationWarn ValidationMode = "warn"
+	// ValidationEnforce logs violations, rejects invalid requests with 400
+	// and replaces invalid stub responses with 500.
+	ValidationEnforce ValidationMode = "enforce"
+)
+
+// ParseValidationMode parses a validation mode name.
+func ParseValidationMode(mode string) (ValidationMode, error) {
+	switch m := ValidationMode(mode); m {
+	case ValidationOff, ValidationWarn, ValidationEnforce:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown validation mode %q, expected off, warn or enforce", mode)
+	}
+}
+
+// Violation is a part of a request or response that doesn't match the
+// document.
+type Violation struct {
+	// In is "path", "query", "header", "body" or "response".
+	In string `json:"in"`
+	// Name is the name of the violating parameter.
+	Name string `json:"name,omitempty"`
+	// Pointer is the JSON pointer of the violating value in the body.
+	Pointer string `json:"pointer,omitempty"`
+	Message string `json:"message"`
+}
+
+// violationReport is the body of responses rejected by the validator.
+type violationReport struct {
+	Error      string      `json:"error"`
+	Operation  string      `json:"operation"`
+	Violations []Violation `json:"violations"`
+}
+
+// route is a compiled operation of the document.
+type route struct {
+	method     string
+	name       string
+	template   string
+	regex      *regexp.Regexp
+	pathParams []string
+	params     []*Parameter
+	op         *Operation
+}
+
+// validator checks requests to and responses from next against the
+// operations of a document. Requests matching no operation are passed on
+// unchecked.
+type validator struct {
+	doc    *Document
+	routes []route
+	mode   ValidationMode
+	next   http.Handler
+}
+
+// Validator wraps next with request and response validation against the
+// document.
+func (d *Document) Validator(next http.Handler, mode ValidationMode) (http.Handler, error) {
+	if mode == ValidationOff {
+		return next, nil
+	}
+
+	v := &validator{doc: d, mode: mode, next: next}
+	basePath := d.basePath()
+	for path, item := range d.Paths {
+		if item == nil {
+			continue
+		}
+		template := basePath + path
+		regex, names := pathPattern(template)
+		for _, op := range item.Operations() {
+			params, err := d.operationParameters(item.Parameters, op.Operation.Parameters)
+			if err != nil {
+				return nil, fmt.Errorf("%v %v: %w", op.Method, path, err)
+			}
+			name := op.Operation.OperationID
+			if name == "" {
+				name = op.Method + " " + path
+			}
+			v.routes = append(v.routes, route{
+				method:     op.Method,
+				name:       name,
+				template:   template,
+				regex:      regex,
+				pathParams: names,
+				params:     params,
+				op:         op.Operation,
+			})
+		}
+	}
+
+	// Literal paths take precedence over templates, e.g. /users/me over
+	// /users/{id}.
+	sort.SliceStable(v.routes, func(i, j int) bool {
+		a, b := v.routes[i], v.routes[j]
+		if len(a.pathParams) != len(b.pathParams) {
+			return len(a.pathParams) < len(b.pathParams)
+		}
+		return a.template < b.template
+	})
+	return v, nil
+}
+
+// operationParameters merges the path level parameters with the operation
+// parameters, which override them by name and location.
+func (d *Document) operationParameters(pathParams, opParams []*Parameter) ([]*Parameter, error) {
+	var params []*Parameter
+	index := map[string]int{}
+	for _, p := range append(append([]*Parameter{}, pathParams...), opParams...) {
+		p, err := d.parameter(p)
+		if err != nil {
+			return nil, fmt.Errorf("parameter: %w", err)
+		}
+		if p == nil {
+			continue
+		}
+		key := p.In + ":" + strings.ToLower(p.Name)
+		if i, ok := index[key]; ok {
+			params[i] = p
+			continue
+		}
+		index[key] = len(params)
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+func (v *validator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt, pathValues, ok := v.match(r)
+	if !ok {
+		v.next.ServeHTTP(w, r)
+		return
+	}
+
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			http.Error(w, "Error reading request body", http.StatusInternalServerError)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if violations := v.checkRequest(rt, r, pathValues, body); len(violations) > 0 {
+		v.log(r, rt, violations)
+		if v.mode == ValidationEnforce {
+			writeReport(w, http.StatusBadRequest, rt, "request does not match the OpenAPI document", violations)
+			return
+		}
+	}
+
+	rec := &responseBuffer{header: http.Header{}}
+	v.next.ServeHTTP(rec, r)
+
+	if violations := v.checkResponse(rt, rec); len(violations) > 0 {
+		v.log(r, rt, violations)
+		if v.mode == ValidationEnforce {
+			writeReport(w, http.StatusInternalServerError, rt, "response does not match the OpenAPI document", violations)
+			return
+		}
+	}
+
+	header, trailer := rec.split()
+	for k, values := range header {
+		w.Header()[k] = values
+	}
+	w.WriteHeader(rec.statusCode())
+	_, _ = w.Write(rec.body.Bytes())
+	for k, values := range trailer {
+		w.Header()[k] = values
+	}
+}
+
+// match returns the operation of the request and its path parameter values.
+func (v *validator) match(r *http.Request) (route, map[string]string, bool) {
+	for _, rt := range v.routes {
+		if rt.method != r.Method {
+			continue
+		}
+		m := rt.regex.FindStringSubmatch(r.URL.Path)
+		if m == nil {
+			continue
+		}
+		values := make(map[string]string, len(rt.pathParams))
+		for i, name := range rt.pathParams {
+			values[name] = m[i+1]
+		}
+		return rt, values, true
+	}
+	return route{}, nil, false
+}
+
+func (v *validator) checkRequest(rt route, r *http.Request, pathValues map[string]string, body []byte) []Violation {
+	var violations []Violation
+	for _, p := range rt.params {
+		var values []string
+		switch p.In {
+		case "path":
+			if value, ok := pathValues[p.Name]; ok {
+				values = []string{value}
+			}
+		case "query":
+			values = r.URL.Query()[p.Name]
+		case "header":
+			values = r.Header.Values(p.Name)
+		default:
+			continue
+		}
+
+		if len(values) == 0 {
+			if p.Required || p.In == "path" {
+				violations = append(violations, Violation{In: p.In, Name: p.Name, Message: "required parameter is missing"})
+			}
+			continue
+		}
+		value, err := v.doc.parameterValue(p.Schema, values)
+		if err != nil {
+			violations = append(violations, Violation{In: p.In, Name: p.Name, Message: err.Error()})
+			continue
+		}
+		for _, e := range v.doc.validateValue(p.Schema, value, request) {
+			violations = append(violations, Violation{In: p.In, Name: p.Name, Pointer: e.Pointer, Message: e.Message})
+		}
+	}
+
+	return append(violations, v.checkRequestBody(rt, r, body)...)
+}
+
+func (v *validator) checkRequestBody(rt route, r *http.Request, body []byte) []Violation {
+	rb, err := v.doc.requestBody(rt.op.RequestBody)
+	if err != nil {
+		return []Violation{{In: "body", Message: err.Error()}}
+	}
+	if rb == nil {
+		return nil
+	}
+	if len(body) == 0 {
+		if rb.Required {
+			return []Violation{{In: "body", Message: "request body is required"}}
+		}
+		return nil
+	}
+
+	mediaType, mt, ok := findMediaType(rb.Content, r.Header.Get("Content-Type"))
+	if !ok {
+		return []Violation{{In: "body", Message: fmt.Sprintf("content type %q is not allowed, expected one of %v", r.Header.Get("Content-Type"), mediaTypes(rb.Content))}}
+	}
+	return v.checkBody("body", mediaType, mt, body, request)
+}
+
+func (v *validator) checkResponse(rt route, rec *responseBuffer) []Violation {
+	status := rec.statusCode()
+	resp, ok := rt.op.Responses[strconv.Itoa(status)]
+	if !ok {
+		resp, ok = rt.op.Responses[fmt.Sprintf("%dXX", status/100)]
+	}
+	if !ok {
+		resp, ok = rt.op.Responses[fmt.Sprintf("%dxx", status/100)]
+	}
+	if !ok {
+		resp, ok = rt.op.Responses["default"]
+	}
+	if !ok {
+		return []Violation{{In: "response", Message: fmt.Sprintf("status %d is not documented", status)}}
+	}
+
+	resp, err := v.doc.response(resp)
+	if err != nil {
+		return []Violation{{In: "response", Message: err.Error()}}
+	}
+	if resp == nil || rec.body.Len() == 0 || len(resp.Content) == 0 {
+		return nil
+	}
+
+	contentType := rec.header.Get("Content-Type")
+	mediaType, mt, ok := findMediaType(resp.Content, contentType)
+	if !ok {
+		return []Violation{{In: "response", Message: fmt.Sprintf("content type %q is not documented for status %d, expected one of %v", contentType, status, mediaTypes(resp.Content))}}
+	}
+	body, ok, err := decodeBody(rec.header.Values("Content-Encoding"), rec.body.Bytes())
+	if err != nil {
+		return []Violation{{In: "response", Message: err.Error()}}
+	}
+	if !ok {
+		return nil
+	}
+	return v.checkBody("response", mediaType, mt, body, response)
+}
+
+// decodeBody removes the content codings of a response body, applied in the
+// order listed by its Content-Encoding header values. It returns false for
+// codings other than gzip, deflate, br and zstd, whose bodies aren't checked.
+func decodeBody(encodings []string, body []byte) ([]byte, bool, error) {
+	var codings []string
+	for _, v := range encodings {
+		for _, coding := range strings.Split(v, ",") {
+			if coding = strings.ToLower(strings.TrimSpace(coding)); coding != "" && coding != "identity" {
+				codings = append(codings, coding)
+			}
+		}
+	}
+
+	for i := len(codings) - 1; i >= 0; i-- {
+		var r io.Reader
+		var err error
+		switch codings[i] {
+		case "gzip", "x-gzip":
+			r, err = gzip.NewReader(bytes.NewReader(body))
+		case "deflate":
+			r, err = zlib.NewReader(bytes.NewReader(body))
+		case "br":
+			r = brotli.NewReader(bytes.NewReader(body))
+		case "zstd":
+			var d *zstd.Decoder
+			if d, err = zstd.NewReader(bytes.NewReader(body)); err == nil {
+				defer d.Close()
+				r = d
+			}
+		default:
+			return nil, false, nil
+		}
+		if err == nil {
+			body, err = io.ReadAll(r)
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("decode %v body: %w", codings[i], err)
+		}
+	}
+	return body, true, nil
+}
+
+// checkBody validates a JSON body against the schema of its media type.
+// Other media types are not checked.
+func (v *validator) checkBody(in string, mediaType string, mt *MediaType, body []byte, dir direction) []Violation {
+	if mt == nil || mt.Schema == nil || !isJSON(mediaType) {
+		return nil
+	}
+
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return []Violation{{In: in, Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+	var violations []Violation
+	for _, e := range v.doc.validateValue(mt.Schema, value, dir) {
+		violations = append(violations, Violation{In: in, Pointer: e.Pointer, Message: e.Message})
+	}
+	return violations
+}
+
+func (v *validator) log(r *http.Request, rt route, violations []Violation) {
+	for _, violation := range violations {
+		slog.WarnContext(r.Context(), "OpenAPI violation",
+			slog.String("operation", rt.name),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("in", violation.In),
+			slog.String("name", violation.Name),
+			slog.String("pointer", violation.Pointer),
+			slog.String("message", violation.Message),
+		)
+	}
+}
+
+func writeReport(w http.ResponseWriter, status int, rt route, message string, violations []Violation) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(violationReport{Error: message, Operation: rt.name, Violations: violations})
+}
+
+// parameterValue converts the raw values of a parameter to the JSON value
+// its schema describes. Values that can't be converted are kept as strings,
+// so the schema validation reports them.
+func (d *Document) parameterValue(s *Schema, values []string) (any, error) {
+	s, err := d.schema(s)
+	if err != nil || s == nil {
+		return values[0], err
+	}
+	if !s.Type.Is("array") {
+		return scalarValue(s.Type, values[0]), nil
+	}
+
+	if len(values) == 1 {
+		values = strings.Split(values[0], ",")
+	}
+	items, err := d.schema(s.Items)
+	if err != nil {
+		return nil, err
+	}
+	var itemType SchemaType
+	if items != nil {
+		itemType = items.Type
+	}
+	list := make([]any, 0, len(values))
+	for _, value := range values {
+		list = append(list, scalarValue(itemType, value))
+	}
+	return list, nil
+}
+
+func scalarValue(typ SchemaType, value string) any {
+	switch {
+	case typ.Is("integer") || typ.Is("number"):
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case typ.Is("boolean"):
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// findMediaType returns the media type of content matching a Content-Type
+// header, preferring exact matches over ranges like "application/*".
+func findMediaType(content map[string]*MediaType, contentType string) (string, *MediaType, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = ""
+	}
+	candidates := []string{mediaType}
+	if major, _, ok := strings.Cut(mediaType, "/"); ok {
+		candidates = append(candidates, major+"/*")
+	}
+	candidates = append(candidates, "*/*")
+	for _, candidate := range candidates {
+		for key, mt := range content {
+			if strings.EqualFold(strings.TrimSpace(strings.Split(key, ";")[0]), candidate) {
+				return mediaType, mt, true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+func mediaTypes(content map[string]*MediaType) []string {
+	types := make([]string, 0, len(content))
+	for mediaType := range content {
+		types = append(types, mediaType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// pathPattern converts a path template into an anchored regex capturing the
+// path parameters, and returns the parameter names in order.
+func pathPattern(template string) (*regexp.Regexp, []string) {
+	expr, names := templateRegex(template, "([^/]+)")
+	return regexp.MustCompile(expr), names
+}
+
+// responseBuffer captures a response so it can be validated before it is
+// sent.
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *responseBuffer) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// split separates the trailers declared in the Trailer header from the
+// header.
+func (b *responseBuffer) split() (http.Header, http.Header) {
+	header := b.header.Clone()
+	trailer := http.Header{}
+	for _, declared := range header.Values("Trailer") {
+		for _, k := range strings.Split(declared, ",") {
+			k = http.CanonicalHeaderKey(strings.TrimSpace(k))
+			if values, ok := header[k]; ok {
+				trailer[k] = values
+				delete(header, k)
+			}
+		}
+	}
+	return header, trailer
+}
+
+func (b *responseBuffer) statusCode() int {
+	if b.status == 0 {
+		return http.StatusOK
+	}
+	return b.status
+}
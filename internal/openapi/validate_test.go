@@ -0,0 +1,244 @@
+package openapi_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/randomenterprisesolutions/stub-server/internal/openapi"
+	"github.com/stretchr/testify/require"
+)
+
+type report struct {
+	Error      string              `json:"error"`
+	Operation  string              `json:"operation"`
+	Violations []openapi.Violation `json:"violations"`
+}
+
+func TestValidatorRequests(t *testing.T) {
+	t.Parallel()
+
+	doc, err := openapi.Load("../../examples/openapi/users.yaml")
+	require.NoError(t, err)
+	handler, err := doc.Validator(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id": "3fa85f64-5717-4562-b3fc-2c963f66afa6", "email": "a@example.com"}`))
+		default:
+			_, _ = w.Write([]byte(`{"users": [], "total": 0}`))
+		}
+	}), openapi.ValidationEnforce)
+	require.NoError(t, err)
+
+	cases := []struct {
+		name           string
+		method         string
+		path           string
+		header         http.Header
+		body           string
+		wantStatus     int
+		wantViolations []openapi.Violation
+	}{
+		{
+			name:       "valid query",
+			method:     http.MethodGet,
+			path:       "/v1/users?limit=10",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "query out of range",
+			method:     http.MethodGet,
+			path:       "/v1/users?limit=1000",
+			wantStatus: http.StatusBadRequest,
+			wantViolations: []openapi.Violation{
+				{In: "query", Name: "limit", Message: "must be at most 100"},
+			},
+		},
+		{
+			name:       "query of wrong type",
+			method:     http.MethodGet,
+			path:       "/v1/users?limit=ten",
+			wantStatus: http.StatusBadRequest,
+			wantViolations: []openapi.Violation{
+				{In: "query", Name: "limit", Message: "must be of type integer, got string"},
+			},
+		},
+		{
+			name:       "valid body",
+			method:     http.MethodPost,
+			path:       "/v1/users",
+			header:     http.Header{"Content-Type": {"application/json"}, "X-Request-Id": {"3fa85f64-5717-4562-b3fc-2c963f66afa6"}},
+			body:       `{"email": "a@example.com"}`,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "invalid body and header",
+			method:     http.MethodPost,
+			path:       "/v1/users",
+			header:     http.Header{"Content-Type": {"application/json"}, "X-Request-Id": {"42"}},
+			body:       `{"email": "not an email", "role": "owner"}`,
+			wantStatus: http.StatusBadRequest,
+			wantViolations: []openapi.Violation{
+				{In: "header", Name: "X-Request-ID", Message: "must be a valid uuid"},
+				{In: "body", Pointer: "/email", Message: "must be a valid email"},
+				{In: "body", Pointer: "/role", Message: `must be one of ["admin","member"]`},
+			},
+		},
+		{
+			name:       "missing body and header",
+			method:     http.MethodPost,
+			path:       "/v1/users",
+			wantStatus: http.StatusBadRequest,
+			wantViolations: []openapi.Violation{
+				{In: "header", Name: "X-Request-ID", Message: "required parameter is missing"},
+				{In: "body", Message: "request body is required"},
+			},
+		},
+		{
+			name:       "wrong content type",
+			method:     http.MethodPost,
+			path:       "/v1/users",
+			header:     http.Header{"Content-Type": {"text/plain"}, "X-Request-Id": {"3fa85f64-5717-4562-b3fc-2c963f66afa6"}},
+			body:       `hello`,
+			wantStatus: http.StatusBadRequest,
+			wantViolations: []openapi.Violation{
+				{In: "body", Message: `content type "text/plain" is not allowed, expected one of [application/json]`},
+			},
+		},
+		{
+			name:       "undocumented path",
+			method:     http.MethodGet,
+			path:       "/other",
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			for k, v := range tc.header {
+				req.Header[k] = v
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tc.wantStatus, rec.Code, rec.Body.String())
+			if tc.wantViolations == nil {
+				return
+			}
+			var got report
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			require.Equal(t, "request does not match the OpenAPI document", got.Error)
+			require.Equal(t, tc.wantViolations, got.Violations)
+		})
+	}
+}
+
+func TestValidatorResponses(t *testing.T) {
+	t.Parallel()
+
+	doc, err := openapi.Load("../../examples/openapi/users.yaml")
+	require.NoError(t, err)
+	stale := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/v1/users/teapot" {
+			w.WriteHeader(http.StatusTeapot)
+			return
+		}
+		_, _ = w.Write([]byte(`{"users": [{"id": 1, "email": "a@example.com"}], "total": 1}`))
+	})
+
+	enforce, err := doc.Validator(stale, openapi.ValidationEnforce)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	enforce.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users", nil))
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	var got report
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	require.Equal(t, "listUsers", got.Operation)
+	require.Equal(t, []openapi.Violation{{In: "response", Pointer: "/users/0/id", Message: "must be of type string, got number"}}, got.Violations)
+
+	rec = httptest.NewRecorder()
+	enforce.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users/teapot", nil))
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.Contains(t, rec.Body.String(), "status 418 is not documented")
+
+	warn, err := doc.Validator(stale, openapi.ValidationWarn)
+	require.NoError(t, err)
+	rec = httptest.NewRecorder()
+	warn.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"users": [{"id": 1, "email": "a@example.com"}], "total": 1}`, rec.Body.String())
+}
+
+func TestParseValidationMode(t *testing.T) {
+	t.Parallel()
+
+	mode, err := openapi.ParseValidationMode("warn")
+	require.NoError(t, err)
+	require.Equal(t, openapi.ValidationWarn, mode)
+
+	_, err = openapi.ParseValidationMode("strict")
+	require.Error(t, err)
+}
+
+func TestValidatorCompressedResponses(t *testing.T) {
+	t.Parallel()
+
+	doc, err := openapi.Load("../../examples/openapi/users.yaml")
+	require.NoError(t, err)
+
+	stale := []byte(`{"users": [{"id": 1, "email": "a@example.com"}], "total": 1}`)
+	encoders := map[string]func(io.Writer) io.WriteCloser{
+		"deflate": func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		"zstd": func(w io.Writer) io.WriteCloser {
+			enc, err := zstd.NewWriter(w)
+			require.NoError(t, err)
+			return enc
+		},
+	}
+	for encoding, newEncoder := range encoders {
+		var compressed bytes.Buffer
+		enc := newEncoder(&compressed)
+		_, err := enc.Write(stale)
+		require.NoError(t, err)
+		require.NoError(t, enc.Close())
+
+		next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", encoding)
+			_, _ = w.Write(compressed.Bytes())
+		})
+		enforce, err := doc.Validator(next, openapi.ValidationEnforce)
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		enforce.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users", nil))
+		require.Equal(t, http.StatusInternalServerError, rec.Code, encoding)
+		var got report
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		require.Equal(t, []openapi.Violation{{In: "response", Pointer: "/users/0/id", Message: "must be of type string, got number"}}, got.Violations, encoding)
+	}
+
+	// Bodies with other codings can't be decoded and are passed through.
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "compress")
+		_, _ = w.Write([]byte("\x1f\x9d"))
+	})
+	enforce, err := doc.Validator(next, openapi.ValidationEnforce)
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	enforce.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "\x1f\x9d", rec.Body.String())
+}
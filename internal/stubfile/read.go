@@ -0,0 +1,256 @@
+package stubfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/diag"
+	"gopkg.in/yaml.v3"
+)
+
+// IsStubFile reports whether path has the extension of a JSON or YAML stub
+// file.
+func IsStubFile(path string) bool {
+	switch filepath.Ext(path) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// Document is a single stub of a stub file, encoded as JSON.
+type Document struct {
+	// Index is the 1-based index of the stub in a file holding several
+	// stubs, or 0 if the file holds a single stub.
+	Index int
+	// Data is the stub as JSON.
+	Data []byte
+
+	// offset is the number of lines before Data in a JSON file.
+	offset int
+	// node is the stub in a YAML file.
+	node *yaml.Node
+}
+
+// Split splits the contents of the stub file at path into its stubs. JSON
+// files hold a single stub object or an array of them. YAML files hold one or
+// more documents, each a stub mapping or a sequence of them; YAML is converted
+// to JSON.
+func Split(path string, data []byte) ([]Document, error) {
+	if filepath.Ext(path) == ".json" {
+		return splitJSON(path, data)
+	}
+	return splitYAML(path, data)
+}
+
+func splitJSON(path string, data []byte) ([]Document, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '[' {
+		return []Document{{Data: data}}, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return nil, diag.Locate(path, data, fmt.Errorf("unmarshal stubs: %w", err))
+	}
+	var docs []Document
+	for dec.More() {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, diag.Locate(path, data, fmt.Errorf("unmarshal stubs: %w", err))
+		}
+		start := dec.InputOffset() - int64(len(raw))
+		docs = append(docs, Document{
+			Index:  len(docs) + 1,
+			Data:   raw,
+			offset: diag.LineAt(data, start) - 1,
+		})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, diag.Locate(path, data, fmt.Errorf("unmarshal stubs: %w", err))
+	}
+	return docs, nil
+}
+
+func splitYAML(path string, data []byte) ([]Document, error) {
+	var nodes []*yaml.Node
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, &diag.Error{File: path, Err: fmt.Errorf("unmarshal stubs: %w", err)}
+		}
+		if len(doc.Content) == 0 || doc.Content[0].ShortTag() == "!!null" {
+			continue
+		}
+		if root := doc.Content[0]; root.Kind == yaml.SequenceNode {
+			nodes = append(nodes, root.Content...)
+		} else {
+			nodes = append(nodes, root)
+		}
+	}
+
+	var docs []Document
+	var errs []error
+	for i, node := range nodes {
+		doc := Document{node: node}
+		if len(nodes) > 1 {
+			doc.Index = i + 1
+		}
+		v, err := yamlValue(node)
+		if err == nil {
+			doc.Data, err = json.Marshal(v)
+		}
+		if err != nil {
+			errs = append(errs, doc.Locate(path, fmt.Errorf("unmarshal stub: %w", err)))
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	return docs, errors.Join(errs...)
+}
+
+// yamlValue converts a YAML node into a value that can be marshaled to JSON.
+func yamlValue(node *yaml.Node) (any, error) {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return yamlValue(node.Alias)
+	case yaml.SequenceNode:
+		values := make([]any, 0, len(node.Content))
+		for _, n := range node.Content {
+			v, err := yamlValue(n)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	case yaml.MappingNode:
+		values := map[string]any{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.ShortTag() == "!!merge" {
+				merged, err := yamlValue(value)
+				if err != nil {
+					return nil, err
+				}
+				if err := merge(values, merged); err != nil {
+					return nil, fmt.Errorf("line %d: %w", key.Line, err)
+				}
+				continue
+			}
+			if key.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: mapping keys must be scalars", key.Line)
+			}
+			v, err := yamlValue(value)
+			if err != nil {
+				return nil, err
+			}
+			values[key.Value] = v
+		}
+		return values, nil
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!str", "!!timestamp", "!!binary":
+			return node.Value, nil
+		}
+		var v any
+		if err := node.Decode(&v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("line %d: unsupported YAML node", node.Line)
+}
+
+// merge adds the entries of the merge key value src, a mapping or a sequence
+// of mappings, missing in dst.
+func merge(dst map[string]any, src any) error {
+	switch src := src.(type) {
+	case map[string]any:
+		for k, v := range src {
+			if _, ok := dst[k]; !ok {
+				dst[k] = v
+			}
+		}
+	case []any:
+		for _, s := range src {
+			if err := merge(dst, s); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.New("merge key value must be a mapping")
+	}
+	return nil
+}
+
+// Locate wraps err, a problem with the stub, in a diag.Error pointing at the
+// line of the problem in the file at path.
+func (d Document) Locate(path string, err error) error {
+	return diag.LocateFunc(path, d.Index, err, d.line)
+}
+
+// KeyLine returns the line of the first occurrence of key in the stub, or 0
+// if it is not present.
+func (d Document) KeyLine(key string) int {
+	if d.node != nil {
+		if n := findKey(d.node, key); n != nil {
+			return n.Line
+		}
+		return 0
+	}
+	if line := diag.KeyLine(d.Data, key); line > 0 {
+		return line + d.offset
+	}
+	return 0
+}
+
+// line returns the line of err in the file. Problems without a known position
+// point at the start of the stub in files holding several stubs.
+func (d Document) line(err error) int {
+	line := 0
+	if d.node != nil {
+		var fieldErr *diag.FieldError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &fieldErr):
+			line = d.KeyLine(fieldErr.Field)
+		case errors.As(err, &typeErr) && typeErr.Field != "":
+			path := strings.Split(typeErr.Field, ".")
+			line = d.KeyLine(path[len(path)-1])
+		}
+	} else if line = diag.JSONLine(d.Data, err); line > 0 {
+		line += d.offset
+	}
+
+	if line == 0 && d.Index > 0 {
+		if d.node != nil {
+			return d.node.Line
+		}
+		return d.offset + 1
+	}
+	return line
+}
+
+// findKey returns the key node of the first mapping entry named key, in
+// document order.
+func findKey(node *yaml.Node, key string) *yaml.Node {
+	for i, n := range node.Content {
+		if node.Kind == yaml.MappingNode && i%2 == 0 && n.Kind == yaml.ScalarNode && n.Value == key {
+			return n
+		}
+		if found := findKey(n, key); found != nil {
+			return found
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package stubfile
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/randomenterprisesolutions/stub-server/internal/diag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplit(t *testing.T) {
+	cases := []struct {
+		name string
+		path string
+		data string
+		want []string
+	}{
+		{
+			name: "json object",
+			path: "stub.json",
+			data: `{"path": "/a"}`,
+			want: []string{`{"path": "/a"}`},
+		},
+		{
+			name: "json array",
+			path: "stubs.json",
+			data: `[{"path": "/a"}, {"path": "/b"}]`,
+			want: []string{`{"path": "/a"}`, `{"path": "/b"}`},
+		},
+		{
+			name: "yaml documents",
+			path: "stubs.yaml",
+			data: "# comment\npath: /a\nstatus: 200\n---\n---\npath: /b\nbody: |\n  multi\n  line\n",
+			want: []string{`{"path": "/a", "status": 200}`, `{"path": "/b", "body": "multi\nline\n"}`},
+		},
+		{
+			name: "yaml sequence with anchors",
+			path: "stubs.yml",
+			data: "- &base\n  method: GET\n  date: 2024-01-01\n- <<: *base\n  path: /b\n",
+			want: []string{`{"method": "GET", "date": "2024-01-01"}`, `{"method": "GET", "date": "2024-01-01", "path": "/b"}`},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			docs, err := Split(tc.path, []byte(tc.data))
+			require.NoError(t, err)
+			require.Len(t, docs, len(tc.want))
+			for i, want := range tc.want {
+				require.JSONEq(t, want, string(docs[i].Data))
+				if len(tc.want) > 1 {
+					require.Equal(t, i+1, docs[i].Index)
+				} else {
+					require.Zero(t, docs[i].Index)
+				}
+			}
+		})
+	}
+}
+
+func TestDocumentLocate(t *testing.T) {
+	fieldErr := diag.Field("status", errors.New("bad status"))
+
+	docs, err := Split("stubs.json", []byte("[\n  {\"path\": \"/a\"},\n  {\n    \"path\": \"/b\",\n    \"status\": 9\n  }\n]"))
+	require.NoError(t, err)
+	require.EqualError(t, docs[1].Locate("stubs.json", fieldErr), "stubs.json:5: document 2: bad status")
+	require.EqualError(t, docs[0].Locate("stubs.json", errors.New("other")), "stubs.json:2: document 1: other")
+
+	docs, err = Split("stubs.yaml", []byte("path: /a\n---\npath: /b\nresponse:\n  status: nine\n"))
+	require.NoError(t, err)
+	require.EqualError(t, docs[1].Locate("stubs.yaml", fieldErr), "stubs.yaml:5: document 2: bad status")
+	var v struct {
+		Response struct {
+			Status int `json:"status"`
+		} `json:"response"`
+	}
+	typeErr := json.Unmarshal(docs[1].Data, &v)
+	require.ErrorContains(t, docs[1].Locate("stubs.yaml", typeErr), "stubs.yaml:5: document 2: json: cannot unmarshal")
+	require.EqualError(t, docs[0].Locate("stubs.yaml", errors.New("other")), "stubs.yaml:1: document 1: other")
+
+	_, err = Split("stubs.yaml", []byte("path: [\n"))
+	require.ErrorContains(t, err, "stubs.yaml: unmarshal stubs: yaml: line")
+	_, err = Split("stubs.json", []byte("[{\"path\": \"/a\"},\n{]"))
+	require.ErrorContains(t, err, "stubs.json:2: unmarshal stubs")
+}